@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"news/database"
+
+	"github.com/pkg/errors"
+)
+
+// Aktor operacji wykonywanych przez procesy w tle, np. czyszczenie kosza
+const SystemActor = "system"
+
+// Wpis dziennika audytu. Before i After to stan newsa przed i po zmianie (nil, jeśli nie istniał).
+type Entry struct {
+	ActorID   string
+	ActorRole string
+	Action    string
+	NewsID    int
+	Before    interface{}
+	After     interface{}
+	ClientIP  string
+	RequestID string
+}
+
+// Zapisanie wpisu w dzienniku audytu w ramach transakcji, w której wykonywana jest zmiana
+func Record(ctx context.Context, tx *sql.Tx, schemaName, tableName string, entry Entry) error {
+	before, err := snapshot(entry.Before)
+	if err != nil {
+		return err
+	}
+	after, err := snapshot(entry.After)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("ActorId", "ActorRole", "Action", "NewsId", "Before", "After", "ClientIp", "RequestId", "CreatedDate") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW())`,
+		schemaName, database.AuditTableName(tableName))
+	_, err = tx.ExecContext(ctx, query, entry.ActorID, entry.ActorRole, entry.Action, entry.NewsID, before, after, nullable(entry.ClientIP), nullable(entry.RequestID))
+	if err != nil {
+		return errors.Wrap(err, "failed to write audit entry")
+	}
+	return nil
+}
+
+func snapshot(state interface{}) ([]byte, error) {
+	if state == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal audit snapshot")
+	}
+	return data, nil
+}
+
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
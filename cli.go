@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"news/audit"
+	"news/config"
+	"news/database"
+	"news/handlers"
+	"news/jobs"
+	"news/logging"
+	"news/settings"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Polecenie wiersza poleceń. Każde polecenie przyjmuje również flagi konfiguracji (-config, -db-host itd.).
+type command struct {
+	name    string // jedno lub dwa słowa, np. "token issue"
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "", "run the HTTP service (default when no command is given)", serve},
+	{"migrate", "", "create or update the tables in the schemas of all tenants", migrate},
+	{"seed", "[-count N] [-tenant NAME]", "insert sample news", seed},
+	{"export", "[-format csv|json|ndjson] [-output FILE] [-tenant NAME]", "export news to a file or standard output", exportNews},
+	{"import", "[-format] [-map column=field]... [-delimiter] [-dry-run] [-skip-invalid] [-tenant NAME] [-actor ID] FILE", "import news from a CSV, JSON or NDJSON file", importNews},
+	{"token issue", "-role ROLE -sub ID [-tenant NAME] [-ttl DURATION]", "print a token signed with the configured jwt.secret for local testing", issueToken},
+	{"purge-trash", "[-older-than-days N] [-tenant NAME]", "permanently delete news that stayed in the trash too long", purgeTrash},
+	{"check-config", "[-connect]", "validate the configuration and optionally the database connection and schema", checkConfig},
+	{"config print", "[-redacted]", "print the resulting configuration", printConfig},
+}
+
+// Polecenie wskazane przez pierwsze argumenty i pozostałe argumenty. Bez polecenia (brak argumentów
+// lub same flagi) uruchamiany jest serwis, tak jak przed wprowadzeniem poleceń.
+func findCommand(args []string) (*command, []string, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return &commands[0], args, nil
+	}
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == commands[i].name {
+			return &commands[i], args[len(words):], nil
+		}
+	}
+	return nil, nil, errors.Errorf("unknown command %q", strings.Join(args, " "))
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: news [command] [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.summary)
+		if c.usage != "" {
+			fmt.Fprintf(w, "  %-14s   news %s %s\n", "", c.name, c.usage)
+		}
+	}
+	fmt.Fprintln(w, "\nRun \"news COMMAND -h\" to list the flags of a command, including the configuration flags.")
+}
+
+// Wspólne dla poleceń wczytanie konfiguracji: flagi polecenia (zarejestrowane wcześniej w fs) i flagi
+// konfiguracji, walidacja oraz ustawienie formatu logów
+func loadConfig(fs *flag.FlagSet, args []string) (config.Config, *config.Flags, error) {
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return config.Config{}, nil, err
+	}
+	cfg, err := flags.Load()
+	if err != nil {
+		return cfg, flags, errors.Wrap(err, "failed to load config")
+	}
+	logging.SetDefault(logging.New(os.Stderr, cfg.LogFormat))
+	return cfg, flags, nil
+}
+
+// Kontekst anulowany przez SIGTERM lub SIGINT
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+}
+
+// Polecenie "serve" uruchamiające serwis
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	cfg, flags, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	logging.RedirectStdLog()
+
+	// SIGTERM (np. przy zatrzymaniu kontenera) i SIGINT rozpoczynają kontrolowane zamykanie serwisu
+	ctx, stop := signalContext()
+	defer stop()
+
+	// Przeładowanie ustawień (CORS, poziom logowania, klucze JWT, przełączniki funkcji) po SIGHUP lub zmianie pliku
+	reloader := settings.NewReloader(cfg, flags.Load)
+	go reloader.Watch(ctx, flags.Path(), configWatchInterval)
+
+	return RunServer(ctx, cfg)
+}
+
+// Polecenie "migrate" tworzące brakujące tabele i kolumny bez uruchamiania serwisu (np. przed wdrożeniem)
+func migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := database.CreateTenantTables(db, cfg); err != nil {
+		return errors.Wrap(err, "failed to create tables")
+	}
+	logging.Info("tables are up to date", "schemas", strings.Join(cfg.Schemas(), ","))
+	return nil
+}
+
+// Treści przykładowych newsów polecenia seed
+var sampleNews = []string{
+	"Zmiana godzin otwarcia czytelni w okresie wakacyjnym",
+	"Nowości wydawnicze w dziale literatury dziecięcej",
+	"Spotkanie autorskie w sali konferencyjnej",
+	"Przerwa techniczna katalogu online",
+	"Zbiórka książek dla bibliotek szkolnych",
+	"Warsztaty z wyszukiwania informacji dla seniorów",
+	"Przypomnienie o zwrocie wypożyczonych materiałów",
+	"Konkurs fotograficzny dla czytelników",
+}
+
+// Polecenie "seed" dodające przykładowe newsy z datami z ostatnich tygodni i różną widocznością
+func seed(args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := fs.Int("count", 20, "number of news to insert")
+	tenantName := fs.String("tenant", "", "name of the tenant to seed (default: schemaName)")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *count < 1 {
+		return errors.New("-count must be at least 1")
+	}
+	schemaName, err := tenantSchema(cfg, *tenantName)
+	if err != nil {
+		return err
+	}
+
+	// Przykładowe newsy dodawane są importem, więc mają wpisy audytu i zdarzenia, a powtórzenie polecenia ich nie dubluje
+	visibility := []string{handlers.VisibilityPublic, handlers.VisibilityPublic, handlers.VisibilityReaders, handlers.VisibilityStaff}
+	now := time.Now().UTC().Truncate(time.Minute)
+	records := make([]handlers.ImportRecord, 0, *count)
+	for i := 0; i < *count; i++ {
+		created := now.Add(-time.Duration(*count-i) * 9 * time.Hour)
+		records = append(records, handlers.ImportRecord{
+			handlers.ImportContent:     fmt.Sprintf("%s (#%d)", sampleNews[i%len(sampleNews)], i+1),
+			handlers.ImportCreatedDate: created.Format(time.RFC3339),
+			handlers.ImportAuthorID:    fmt.Sprintf("seed-%d", i%3+1),
+			handlers.ImportVisibility:  visibility[i%len(visibility)],
+		})
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	report, err := handlers.ImportRecords(ctx, db, schemaName, cfg.TableName, records,
+		audit.Entry{ActorID: audit.SystemActor, ActorRole: "admin"}, handlers.ImportOptions{})
+	if err != nil {
+		return err
+	}
+	logging.Info("sample news inserted", "schema", schemaName, "inserted", report.Imported, "duplicates", report.Duplicates)
+	return nil
+}
+
+// Polecenie "export" zapisujące wszystkie newsy spoza kosza (jak GET /api/News/export administratora)
+func exportNews(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "csv, json or ndjson (default: from the -output extension or csv)")
+	output := fs.String("output", "", "output file (default: standard output)")
+	tenantName := fs.String("tenant", "", "name of the tenant to export (default: schemaName)")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format == "" {
+		*format = handlers.ExportCSV
+		if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(*output)), "."); ext != "" {
+			*format = ext
+		}
+	}
+	schemaName, err := tenantSchema(cfg, *tenantName)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	admin := &handlers.LoginCredentials{ID: audit.SystemActor, GrantType: "admin"}
+	count, err := handlers.WriteNewsExport(ctx, db, schemaName, cfg.TableName, admin, *format, w)
+	if err != nil {
+		return err
+	}
+	if *output != "" {
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	logging.Info("news exported", "schema", schemaName, "format", *format, "count", count)
+	return nil
+}
+
+// Polecenie "import" importujące newsy z pliku CSV, JSON lub NDJSON (jak POST /api/News/import).
+// Raport importu wypisywany jest na standardowe wyjście.
+func importNews(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "file format: csv, json or ndjson (default: from the file extension)")
+	var mapping stringsFlag
+	fs.Var(&mapping, "map", "map a file column to a news field, e.g. \"Treść=content\" (repeatable)")
+	delimiter := fs.String("delimiter", "", "CSV column delimiter, a single character or \"tab\" (default \",\")")
+	dryRun := fs.Bool("dry-run", false, "only validate the file and print the report")
+	skipInvalid := fs.Bool("skip-invalid", false, "import valid rows even if other rows are invalid")
+	tenantName := fs.String("tenant", "", "name of the tenant to import into (default: schemaName)")
+	actor := fs.String("actor", audit.SystemActor, "ID recorded in the audit log and used as the author of rows without authorId")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: news import [flags] FILE")
+	}
+
+	path := fs.Arg(0)
+	opts := handlers.ImportOptions{Format: *format, DryRun: *dryRun, SkipInvalid: *skipInvalid, MaxRows: cfg.Import.MaxRows}
+	if opts.Format == "" {
+		opts.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	if opts.Mapping, err = handlers.ParseImportMapping(mapping); err != nil {
+		return err
+	}
+	if opts.Delimiter, err = handlers.ParseImportDelimiter(*delimiter); err != nil {
+		return err
+	}
+	schemaName, err := tenantSchema(cfg, *tenantName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	records, err := handlers.ReadImport(file, opts)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	report, err := handlers.ImportRecords(ctx, db, schemaName, cfg.TableName, records,
+		audit.Entry{ActorID: *actor, ActorRole: "admin"}, opts)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	logging.Info("import finished", "schema", schemaName, "dry_run", report.DryRun, "total", report.Total,
+		"imported", report.Imported, "duplicates", report.Duplicates, "invalid", report.Invalid)
+	if report.Invalid > 0 && !opts.DryRun && !opts.SkipInvalid {
+		return errors.Errorf("%d invalid rows, nothing was imported (see the report or use -skip-invalid)", report.Invalid)
+	}
+	return nil
+}
+
+// Polecenie "token issue" wypisujące token podpisany kluczem jwt.secret z konfiguracji
+func issueToken(args []string) error {
+	fs := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	role := fs.String("role", "", "role of the user, e.g. admin, employee or reader")
+	subject := fs.String("sub", "", "ID of the user")
+	tenantName := fs.String("tenant", "", "tenant claim of the token")
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime")
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// Do podpisania tokenu potrzebny jest tylko klucz - bez walidacji pozostałej konfiguracji (np. bazy)
+	cfg, err := flags.Build()
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+	if *role == "" || *subject == "" {
+		return errors.New("usage: news token issue -role ROLE -sub ID")
+	}
+	// Przy skonfigurowanych filiach token bez filii jest odrzucany przez serwis
+	if len(cfg.Tenants) > 0 {
+		if *tenantName == "" {
+			return errors.New("-tenant is required when tenants are configured")
+		}
+		if _, err := tenantSchema(cfg, *tenantName); err != nil {
+			return err
+		}
+	}
+	token, err := handlers.IssueToken([]byte(cfg.JWT.Secret), handlers.LoginCredentials{ID: *subject, GrantType: *role, Tenant: *tenantName}, *ttl, time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Println(token)
+	return nil
+}
+
+// Polecenie "purge-trash" usuwające newsy z kosza od razu, bez czekania na zadanie w tle
+func purgeTrash(args []string) error {
+	fs := flag.NewFlagSet("purge-trash", flag.ContinueOnError)
+	olderThanDays := fs.Int("older-than-days", -1, "delete news trashed more than N days ago (default: trash.purgeAfterDays)")
+	tenantName := fs.String("tenant", "", "name of the tenant (default: all tenants)")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	days := *olderThanDays
+	if days < 0 {
+		days = cfg.Trash.PurgeAfterDays
+		if days == 0 {
+			return errors.New("trash.purgeAfterDays is 0 (purging disabled), use -older-than-days")
+		}
+	}
+	schemas := cfg.Schemas()
+	if *tenantName != "" {
+		schemaName, err := tenantSchema(cfg, *tenantName)
+		if err != nil {
+			return err
+		}
+		schemas = []string{schemaName}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	db, err := openDB(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	for _, schemaName := range schemas {
+		purged, err := jobs.PurgeTrash(ctx, db, schemaName, cfg.TableName, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge trash in schema %s", schemaName)
+		}
+		logging.Info("trash purged", "schema", schemaName, "older_than_days", days, "count", purged)
+	}
+	return nil
+}
+
+// Polecenie "check-config" sprawdzające konfigurację, np. przed wdrożeniem. Z -connect sprawdza również
+// połączenie z bazą i strukturę tabel.
+func checkConfig(args []string) error {
+	fs := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	connect := fs.Bool("connect", false, "also connect to the database and check the tables")
+	cfg, _, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *connect {
+		ctx, stop := signalContext()
+		defer stop()
+		db, err := openDB(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if err := database.CheckSchema(ctx, db, cfg); err != nil {
+			return errors.Wrap(err, "database schema check failed (run \"news migrate\")")
+		}
+	}
+	fmt.Println("configuration is valid")
+	return nil
+}
+
+// Polecenie "config print" wypisujące wynikową konfigurację
+func printConfig(args []string) error {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	redacted := fs.Bool("redacted", false, "hide secrets such as the database password")
+	flags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfg, err := flags.Build()
+	if err != nil {
+		return errors.Wrap(err, "failed to load config")
+	}
+	if err := config.Print(os.Stdout, cfg, *redacted); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// Połączenie z bazą z ponawianiem prób - baza może startować razem z serwisem (np. docker compose)
+func openDB(ctx context.Context, cfg config.Config) (*sql.DB, error) {
+	db, err := database.ConnectDB(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to the database")
+	}
+	err = database.WaitForDB(ctx, db, cfg.DB.ConnectAttempts,
+		time.Duration(cfg.DB.ConnectBackoffSeconds)*time.Second,
+		time.Duration(cfg.DB.MaxConnectBackoffSeconds)*time.Second)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Schemat filii o podanej nazwie, a bez nazwy - schemat z konfiguracji
+func tenantSchema(cfg config.Config, name string) (string, error) {
+	if name == "" {
+		return cfg.SchemaName, nil
+	}
+	for _, t := range cfg.Tenants {
+		if t.Name == name {
+			return t.SchemaName, nil
+		}
+	}
+	return "", errors.Errorf("unknown tenant %q", name)
+}
+
+// Flaga, którą można podać wielokrotnie
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
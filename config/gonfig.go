@@ -1,30 +1,248 @@
 package config
 
-import (
-	"encoding/json"
-	"io/ioutil"
+// Konfiguracja serwisu. Wartości ładowane są warstwami (zob. Load): wartości domyślne, plik JSON lub YAML,
+// zmienne środowiskowe (tag env) i flagi wiersza poleceń (tag flag). Pola oznaczone tagiem secret
+// są ukrywane przez Redacted.
+type Config struct {
+	Host       string   `json:"host" yaml:"host" env:"NEWS_DB_HOST" flag:"db-host"`
+	Port       int      `json:"port" yaml:"port" env:"NEWS_DB_PORT" flag:"db-port"`
+	User       string   `json:"user" yaml:"user" env:"NEWS_DB_USER" flag:"db-user"`
+	Password   string   `json:"password" yaml:"password" env:"NEWS_DB_PASSWORD" flag:"db-password" secret:"true"`
+	DBName     string   `json:"dbname" yaml:"dbname" env:"NEWS_DB_NAME" flag:"db-name"`
+	SchemaName string   `json:"schemaName" yaml:"schemaName" env:"NEWS_SCHEMA_NAME" flag:"schema-name"`
+	TableName  string   `json:"tableName" yaml:"tableName" env:"NEWS_TABLE_NAME" flag:"table-name"`
+	DB         DBConfig `json:"db" yaml:"db"`
+
+	Server   ServerConfig   `json:"server" yaml:"server"`
+	Outbox   OutboxConfig   `json:"outbox" yaml:"outbox"`
+	Trash    TrashConfig    `json:"trash" yaml:"trash"`
+	Views    ViewsConfig    `json:"views" yaml:"views"`
+	Featured FeaturedConfig `json:"featured" yaml:"featured"`
+	Health   HealthConfig   `json:"health" yaml:"health"`
+	Metrics  MetricsConfig  `json:"metrics" yaml:"metrics"`
+	Tracing  TracingConfig  `json:"tracing" yaml:"tracing"`
+
+	RateLimit   RateLimitConfig   `json:"rateLimit" yaml:"rateLimit"`
+	Idempotency IdempotencyConfig `json:"idempotency" yaml:"idempotency"`
+	Bulk        BulkConfig        `json:"bulk" yaml:"bulk"`
+	Import      ImportConfig      `json:"import" yaml:"import"`
+
+	Tenants       []TenantConfig `json:"tenants" yaml:"tenants"`
+	DefaultTenant string         `json:"defaultTenant" yaml:"defaultTenant" env:"NEWS_DEFAULT_TENANT" flag:"default-tenant"`
+
+	// Ustawienia z tagiem reload są przeładowywane bez restartu serwisu (zob. pakiet settings)
+	CORS      CORSConfig      `json:"cors" yaml:"cors"`
+	LogLevel  string          `json:"logLevel" yaml:"logLevel" env:"NEWS_LOG_LEVEL" flag:"log-level" reload:"true"`
+	LogFormat string          `json:"logFormat" yaml:"logFormat" env:"NEWS_LOG_FORMAT" flag:"log-format"` // text lub json
+	JWT       JWTConfig       `json:"jwt" yaml:"jwt"`
+	Features  map[string]bool `json:"features" yaml:"features" reload:"true"` // przełączniki funkcji, brak wpisu oznacza funkcję włączoną
+}
+
+// Nazwy funkcji, które można wyłączyć w sekcji features
+const (
+	FeatureComments     = "comments"
+	FeatureReactions    = "reactions"
+	FeatureViewCounting = "viewCounting"
 )
 
-type Config struct {
-	Host       string `json:"host"`
-	Port       int    `json:"port"`
-	User       string `json:"user"`
-	Password   string `json:"password"`
-	DBName     string `json:"dbname"`
-	SchemaName string `json:"schemaName"`
-	TableName  string `json:"tableName"`
+var FeatureNames = []string{FeatureComments, FeatureReactions, FeatureViewCounting}
+
+// Poziomy i formaty logowania
+var (
+	LogLevels  = []string{"debug", "info", "warn", "error"}
+	LogFormats = []string{"text", "json"}
+)
+
+// Ustawienia CORS
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins" yaml:"allowedOrigins" reload:"true"`
+}
+
+// Klucze weryfikacji tokenów JWT. PreviousSecrets pozwalają na wymianę klucza bez unieważniania wydanych tokenów.
+type JWTConfig struct {
+	Secret          string   `json:"secret" yaml:"secret" env:"NEWS_JWT_SECRET" flag:"jwt-secret" secret:"true" reload:"true"`
+	PreviousSecrets []string `json:"previousSecrets" yaml:"previousSecrets" secret:"true" reload:"true"`
+}
+
+// Filia biblioteki obsługiwana przez wspólny proces. Dane każdej filii przechowywane są w osobnym schemacie.
+type TenantConfig struct {
+	Name       string   `json:"name" yaml:"name"`
+	SchemaName string   `json:"schemaName" yaml:"schemaName"`
+	Hosts      []string `json:"hosts" yaml:"hosts"` // nazwy hostów (nagłówek Host) przypisane do filii
 }
 
+// Ustawienia połączenia z bazą i puli połączeń. DSN, jeśli podany, zastępuje host, port, użytkownika,
+// hasło, nazwę bazy i ustawienia SSL.
+type DBConfig struct {
+	DSN                      string `json:"dsn" yaml:"dsn" env:"NEWS_DB_DSN" flag:"db-dsn" secret:"true"`
+	SSLMode                  string `json:"sslMode" yaml:"sslMode" env:"NEWS_DB_SSLMODE" flag:"db-sslmode"` // disable, allow, prefer, require, verify-ca lub verify-full
+	SSLRootCert              string `json:"sslRootCert" yaml:"sslRootCert" env:"NEWS_DB_SSLROOTCERT" flag:"db-sslrootcert"`
+	MaxOpenConns             int    `json:"maxOpenConns" yaml:"maxOpenConns" env:"NEWS_DB_MAX_OPEN_CONNS" flag:"db-max-open-conns"` // 0 oznacza brak limitu
+	MaxIdleConns             int    `json:"maxIdleConns" yaml:"maxIdleConns" env:"NEWS_DB_MAX_IDLE_CONNS" flag:"db-max-idle-conns"`
+	ConnMaxLifetimeSeconds   int    `json:"connMaxLifetimeSeconds" yaml:"connMaxLifetimeSeconds" env:"NEWS_DB_CONN_MAX_LIFETIME_SECONDS" flag:"db-conn-max-lifetime-seconds"`
+	ConnMaxIdleTimeSeconds   int    `json:"connMaxIdleTimeSeconds" yaml:"connMaxIdleTimeSeconds" env:"NEWS_DB_CONN_MAX_IDLE_TIME_SECONDS" flag:"db-conn-max-idle-time-seconds"`
+	ConnectAttempts          int    `json:"connectAttempts" yaml:"connectAttempts" env:"NEWS_DB_CONNECT_ATTEMPTS" flag:"db-connect-attempts"`                           // liczba prób połączenia przy starcie
+	ConnectBackoffSeconds    int    `json:"connectBackoffSeconds" yaml:"connectBackoffSeconds" env:"NEWS_DB_CONNECT_BACKOFF_SECONDS" flag:"db-connect-backoff-seconds"` // odstęp po pierwszej nieudanej próbie, podwajany przy kolejnych
+	MaxConnectBackoffSeconds int    `json:"maxConnectBackoffSeconds" yaml:"maxConnectBackoffSeconds" env:"NEWS_DB_MAX_CONNECT_BACKOFF_SECONDS" flag:"db-max-connect-backoff-seconds"`
+}
+
+// Tryby sslmode obsługiwane przez sterownik lib/pq
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Ustawienia serwera HTTP. Czasy podawane są w sekundach, 0 oznacza brak limitu.
+type ServerConfig struct {
+	Address                  string `json:"address" yaml:"address" env:"NEWS_SERVER_ADDRESS" flag:"server-address"` // np. :8080 lub 127.0.0.1:8080
+	ReadTimeoutSeconds       int    `json:"readTimeoutSeconds" yaml:"readTimeoutSeconds" env:"NEWS_SERVER_READ_TIMEOUT_SECONDS" flag:"server-read-timeout-seconds"`
+	ReadHeaderTimeoutSeconds int    `json:"readHeaderTimeoutSeconds" yaml:"readHeaderTimeoutSeconds" env:"NEWS_SERVER_READ_HEADER_TIMEOUT_SECONDS" flag:"server-read-header-timeout-seconds"`
+	WriteTimeoutSeconds      int    `json:"writeTimeoutSeconds" yaml:"writeTimeoutSeconds" env:"NEWS_SERVER_WRITE_TIMEOUT_SECONDS" flag:"server-write-timeout-seconds"`
+	IdleTimeoutSeconds       int    `json:"idleTimeoutSeconds" yaml:"idleTimeoutSeconds" env:"NEWS_SERVER_IDLE_TIMEOUT_SECONDS" flag:"server-idle-timeout-seconds"`
+	MaxHeaderBytes           int    `json:"maxHeaderBytes" yaml:"maxHeaderBytes" env:"NEWS_SERVER_MAX_HEADER_BYTES" flag:"server-max-header-bytes"`
+	ShutdownDelaySeconds     int    `json:"shutdownDelaySeconds" yaml:"shutdownDelaySeconds" env:"NEWS_SERVER_SHUTDOWN_DELAY_SECONDS" flag:"server-shutdown-delay-seconds"`         // czas obsługi ruchu po zgłoszeniu braku gotowości, zanim serwer przestanie przyjmować połączenia
+	ShutdownTimeoutSeconds   int    `json:"shutdownTimeoutSeconds" yaml:"shutdownTimeoutSeconds" env:"NEWS_SERVER_SHUTDOWN_TIMEOUT_SECONDS" flag:"server-shutdown-timeout-seconds"` // czas na dokończenie żądań po SIGTERM
+	// Adresy lub sieci CIDR proxy (np. load balancera), którym wolno podać adres klienta w nagłówku X-Forwarded-For
+	TrustedProxies []string `json:"trustedProxies" yaml:"trustedProxies" reload:"true"`
+
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+}
+
+// Tryby uwierzytelniania klientów certyfikatem
+const (
+	ClientAuthNone     = "none"     // certyfikat klienta nie jest sprawdzany
+	ClientAuthOptional = "optional" // certyfikat jest weryfikowany, jeśli klient go przedstawi
+	ClientAuthRequire  = "require"  // połączenia bez poprawnego certyfikatu są odrzucane
+)
+
+// Ustawienia HTTPS. Pusty CertFile oznacza serwer HTTP (np. za proxy kończącym TLS).
+type TLSConfig struct {
+	CertFile                 string            `json:"certFile" yaml:"certFile" env:"NEWS_TLS_CERT_FILE" flag:"tls-cert-file"`
+	KeyFile                  string            `json:"keyFile" yaml:"keyFile" env:"NEWS_TLS_KEY_FILE" flag:"tls-key-file"`
+	CertCheckIntervalSeconds int               `json:"certCheckIntervalSeconds" yaml:"certCheckIntervalSeconds" env:"NEWS_TLS_CERT_CHECK_INTERVAL_SECONDS" flag:"tls-cert-check-interval-seconds"` // jak często sprawdzać, czy certyfikat został podmieniony
+	RedirectAddress          string            `json:"redirectAddress" yaml:"redirectAddress" env:"NEWS_TLS_REDIRECT_ADDRESS" flag:"tls-redirect-address"`                                         // adres HTTP przekierowujący na HTTPS, np. :80
+	ClientAuth               string            `json:"clientAuth" yaml:"clientAuth" env:"NEWS_TLS_CLIENT_AUTH" flag:"tls-client-auth"`                                                             // none, optional lub require
+	ClientCAFile             string            `json:"clientCAFile" yaml:"clientCAFile" env:"NEWS_TLS_CLIENT_CA_FILE" flag:"tls-client-ca-file"`
+	ClientRoles              map[string]string `json:"clientRoles" yaml:"clientRoles" reload:"true"`     // podmiot certyfikatu (CN lub pełny DN) -> rola
+	ClientTenants            map[string]string `json:"clientTenants" yaml:"clientTenants" reload:"true"` // podmiot certyfikatu -> filia (wymagana, gdy skonfigurowano filie)
+}
+
+// Czy serwer ma obsługiwać HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// Ustawienia przekazywania zdarzeń z tabeli outbox
+type OutboxConfig struct {
+	Publisher       string `json:"publisher" yaml:"publisher" env:"NEWS_OUTBOX_PUBLISHER" flag:"outbox-publisher"` // log, http lub nats
+	URL             string `json:"url" yaml:"url" env:"NEWS_OUTBOX_URL" flag:"outbox-url"`
+	Subject         string `json:"subject" yaml:"subject" env:"NEWS_OUTBOX_SUBJECT" flag:"outbox-subject"`
+	IntervalSeconds int    `json:"intervalSeconds" yaml:"intervalSeconds" env:"NEWS_OUTBOX_INTERVAL_SECONDS" flag:"outbox-interval-seconds"`
+	BatchSize       int    `json:"batchSize" yaml:"batchSize" env:"NEWS_OUTBOX_BATCH_SIZE" flag:"outbox-batch-size"`
+	MaxAttempts     int    `json:"maxAttempts" yaml:"maxAttempts" env:"NEWS_OUTBOX_MAX_ATTEMPTS" flag:"outbox-max-attempts"` // po tylu nieudanych próbach zdarzenie jest porzucane
+}
+
+// Ustawienia trwałego usuwania newsów z kosza. PurgeAfterDays równe 0 wyłącza czyszczenie.
+type TrashConfig struct {
+	PurgeAfterDays       int `json:"purgeAfterDays" yaml:"purgeAfterDays" env:"NEWS_TRASH_PURGE_AFTER_DAYS" flag:"trash-purge-after-days"`
+	PurgeIntervalMinutes int `json:"purgeIntervalMinutes" yaml:"purgeIntervalMinutes" env:"NEWS_TRASH_PURGE_INTERVAL_MINUTES" flag:"trash-purge-interval-minutes"`
+}
+
+// Ustawienia liczenia wyświetleń i listy popularnych newsów
+type ViewsConfig struct {
+	DedupWindowMinutes   int            `json:"dedupWindowMinutes" yaml:"dedupWindowMinutes" env:"NEWS_VIEWS_DEDUP_WINDOW_MINUTES" flag:"views-dedup-window-minutes"`
+	FlushIntervalSeconds int            `json:"flushIntervalSeconds" yaml:"flushIntervalSeconds" env:"NEWS_VIEWS_FLUSH_INTERVAL_SECONDS" flag:"views-flush-interval-seconds"`
+	PopularPeriods       map[string]int `json:"popularPeriods" yaml:"popularPeriods"` // nazwa okresu -> liczba dni
+	PopularMaxCount      int            `json:"popularMaxCount" yaml:"popularMaxCount" env:"NEWS_VIEWS_POPULAR_MAX_COUNT" flag:"views-popular-max-count"`
+}
+
+// Ustawienia endpointu gotowości /readyz
+type HealthConfig struct {
+	CheckTimeoutSeconds int `json:"checkTimeoutSeconds" yaml:"checkTimeoutSeconds" env:"NEWS_HEALTH_CHECK_TIMEOUT_SECONDS" flag:"health-check-timeout-seconds"` // limit czasu pojedynczego sprawdzenia
+}
+
+// Ustawienia endpointu metryk w formacie Prometheusa
+type MetricsConfig struct {
+	Enabled           bool   `json:"enabled" yaml:"enabled" env:"NEWS_METRICS_ENABLED" flag:"metrics-enabled"`
+	Path              string `json:"path" yaml:"path" env:"NEWS_METRICS_PATH" flag:"metrics-path"`
+	ItemsCacheSeconds int    `json:"itemsCacheSeconds" yaml:"itemsCacheSeconds" env:"NEWS_METRICS_ITEMS_CACHE_SECONDS" flag:"metrics-items-cache-seconds"` // czas ponownego użycia liczby newsów (0 - liczenie przy każdym odczycie)
+}
+
+// Ustawienia śledzenia żądań (spany w formacie OpenTelemetry)
+type TracingConfig struct {
+	Enabled       bool   `json:"enabled" yaml:"enabled" env:"NEWS_TRACING_ENABLED" flag:"tracing-enabled"`
+	Exporter      string `json:"exporter" yaml:"exporter" env:"NEWS_TRACING_EXPORTER" flag:"tracing-exporter"`                       // stdout lub otlp
+	Endpoint      string `json:"endpoint" yaml:"endpoint" env:"NEWS_TRACING_ENDPOINT" flag:"tracing-endpoint"`                       // adres odbiornika OTLP/HTTP
+	ServiceName   string `json:"serviceName" yaml:"serviceName" env:"NEWS_TRACING_SERVICE_NAME" flag:"tracing-service-name"`         // nazwa serwisu w spanach
+	SamplePercent int    `json:"samplePercent" yaml:"samplePercent" env:"NEWS_TRACING_SAMPLE_PERCENT" flag:"tracing-sample-percent"` // odsetek śledzonych żądań bez nagłówka traceparent
+}
+
+// Eksportery spanów
+const (
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// Ograniczenie liczby żądań na użytkownika (Id z tokenu) lub adres IP klienta.
+// Żądania GET, HEAD i OPTIONS korzystają z limitu Read, pozostałe z limitu Write.
+type RateLimitConfig struct {
+	Enabled bool            `json:"enabled" yaml:"enabled" env:"NEWS_RATE_LIMIT_ENABLED" flag:"rate-limit-enabled"`
+	Store   string          `json:"store" yaml:"store" env:"NEWS_RATE_LIMIT_STORE" flag:"rate-limit-store"` // memory lub postgres (limit wspólny dla wszystkich instancji)
+	Read    RateLimitBudget `json:"read" yaml:"read"`
+	Write   RateLimitBudget `json:"write" yaml:"write"`
+}
+
+// Limit żądań: Requests żądań na PeriodSeconds sekund, najwyżej Burst żądań naraz (0 oznacza Requests).
+// Limity są przeładowywane bez restartu serwisu.
+type RateLimitBudget struct {
+	Requests      int `json:"requests" yaml:"requests" reload:"true"`
+	PeriodSeconds int `json:"periodSeconds" yaml:"periodSeconds" reload:"true"`
+	Burst         int `json:"burst" yaml:"burst" reload:"true"`
+}
+
+// Magazyny stanu limitów żądań
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// Przechowywanie kluczy Idempotency-Key i odpowiedzi na żądania utworzenia newsa
+type IdempotencyConfig struct {
+	TTLHours             int `json:"ttlHours" yaml:"ttlHours" env:"NEWS_IDEMPOTENCY_TTL_HOURS" flag:"idempotency-ttl-hours"`                                                   // jak długo ponowienie zwraca zapisaną odpowiedź
+	PurgeIntervalMinutes int `json:"purgeIntervalMinutes" yaml:"purgeIntervalMinutes" env:"NEWS_IDEMPOTENCY_PURGE_INTERVAL_MINUTES" flag:"idempotency-purge-interval-minutes"` // co ile usuwane są wygasłe klucze
+}
+
+// Ustawienia operacji zbiorczych (POST /api/News/bulk)
+type BulkConfig struct {
+	MaxOperations int `json:"maxOperations" yaml:"maxOperations" env:"NEWS_BULK_MAX_OPERATIONS" flag:"bulk-max-operations"` // największa liczba operacji w jednym żądaniu
+}
+
+// Ustawienia importu newsów z plików CSV i JSON
+type ImportConfig struct {
+	MaxRows int `json:"maxRows" yaml:"maxRows" env:"NEWS_IMPORT_MAX_ROWS" flag:"import-max-rows"` // największa liczba wierszy w jednym pliku
+}
+
+// Ustawienia listy wyróżnionych newsów
+type FeaturedConfig struct {
+	MaxCount int `json:"maxCount" yaml:"maxCount" env:"NEWS_FEATURED_MAX_COUNT" flag:"featured-max-count"`
+}
+
+// Odczytanie konfiguracji z domyślnego pliku i zmiennych środowiskowych (bez flag wiersza poleceń)
 func GetConfig() (config Config, err error) {
-	configData, err := ioutil.ReadFile("config/config.json")
-	if err != nil {
-		return config, err
-	}
+	return Load(nil)
+}
 
-	err = json.Unmarshal(configData, &config)
-	if err != nil {
-		return config, err
+// Schematy wszystkich filii, a przy braku filii w konfiguracji - tylko SchemaName
+func (c Config) Schemas() []string {
+	if len(c.Tenants) == 0 {
+		return []string{c.SchemaName}
+	}
+	schemas := make([]string, 0, len(c.Tenants))
+	for _, tenant := range c.Tenants {
+		schemas = append(schemas, tenant.SchemaName)
 	}
+	return schemas
+}
 
-	return config, nil
+// Kopia konfiguracji wskazująca na schemat jednej z filii
+func (c Config) ForSchema(schemaName string) Config {
+	c.SchemaName = schemaName
+	return c
 }
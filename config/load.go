@@ -0,0 +1,362 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Domyślna ścieżka pliku konfiguracyjnego, względna wobec katalogu roboczego
+const DefaultPath = "config/config.json"
+
+// Zmienna środowiskowa ze ścieżką pliku konfiguracyjnego (flaga -config ma pierwszeństwo)
+const PathEnv = "NEWS_CONFIG"
+
+const redactedValue = "******"
+
+// Wartości domyślne - najniższa warstwa konfiguracji
+func Defaults() Config {
+	return Config{
+		Port: 5432,
+		DB: DBConfig{
+			SSLMode:                  "require",
+			MaxOpenConns:             25,
+			MaxIdleConns:             5,
+			ConnMaxLifetimeSeconds:   1800,
+			ConnMaxIdleTimeSeconds:   300,
+			ConnectAttempts:          5,
+			ConnectBackoffSeconds:    1,
+			MaxConnectBackoffSeconds: 30,
+		},
+		Server: ServerConfig{
+			Address:                  ":8080",
+			ReadTimeoutSeconds:       15,
+			ReadHeaderTimeoutSeconds: 5,
+			WriteTimeoutSeconds:      30,
+			IdleTimeoutSeconds:       120,
+			MaxHeaderBytes:           1 << 20,
+			ShutdownDelaySeconds:     5,
+			ShutdownTimeoutSeconds:   30,
+			TLS: TLSConfig{
+				CertCheckIntervalSeconds: 60,
+				ClientAuth:               ClientAuthNone,
+			},
+		},
+		Outbox: OutboxConfig{
+			Publisher:       "log",
+			Subject:         "news.events",
+			IntervalSeconds: 5,
+			BatchSize:       100,
+			MaxAttempts:     10,
+		},
+		Trash: TrashConfig{
+			PurgeIntervalMinutes: 60,
+		},
+		Views: ViewsConfig{
+			DedupWindowMinutes:   30,
+			FlushIntervalSeconds: 10,
+			PopularMaxCount:      20,
+		},
+		Featured: FeaturedConfig{
+			MaxCount: 5,
+		},
+		Health: HealthConfig{
+			CheckTimeoutSeconds: 2,
+		},
+		Metrics: MetricsConfig{
+			Enabled:           true,
+			Path:              "/metrics",
+			ItemsCacheSeconds: 15,
+		},
+		Bulk: BulkConfig{
+			MaxOperations: 100,
+		},
+		Import: ImportConfig{
+			MaxRows: 10000,
+		},
+		Idempotency: IdempotencyConfig{
+			TTLHours:             24,
+			PurgeIntervalMinutes: 60,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   RateLimitStoreMemory,
+			Read:    RateLimitBudget{Requests: 300, PeriodSeconds: 60},
+			Write:   RateLimitBudget{Requests: 30, PeriodSeconds: 60},
+		},
+		Tracing: TracingConfig{
+			Exporter:      TracingExporterStdout,
+			Endpoint:      "http://localhost:4318/v1/traces",
+			ServiceName:   "news",
+			SamplePercent: 100,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: []string{"*"},
+		},
+		LogLevel:  "info",
+		LogFormat: "text",
+		JWT: JWTConfig{
+			// Klucz używany dotychczas przez serwis uwierzytelniania - w produkcji należy go nadpisać (NEWS_JWT_SECRET)
+			Secret: "MySecretKeyIsSecretSoDoNotTell",
+		},
+	}
+}
+
+// Flags to flagi konfiguracji zarejestrowane w zestawie flag polecenia
+type Flags struct {
+	fs        *flag.FlagSet
+	path      *string
+	values    map[string]*string
+	lookupEnv func(string) (string, bool)
+}
+
+// Rejestracja flagi -config oraz flag wszystkich pól konfiguracji z tagiem flag
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{
+		fs:        fs,
+		path:      fs.String("config", "", "path of the JSON or YAML configuration file (env "+PathEnv+", default "+DefaultPath+")"),
+		values:    make(map[string]*string),
+		lookupEnv: os.LookupEnv,
+	}
+	walkFields(reflect.ValueOf(&Config{}).Elem(), "", func(field reflect.StructField, _ reflect.Value, name string) {
+		if flagName := field.Tag.Get("flag"); flagName != "" {
+			usage := "overrides " + name
+			if env := field.Tag.Get("env"); env != "" {
+				usage += " (env " + env + ")"
+			}
+			flags.values[flagName] = fs.String(flagName, "", usage)
+		}
+	})
+	return flags
+}
+
+// Załadowanie i walidacja konfiguracji po sparsowaniu flag
+func (f *Flags) Load() (Config, error) {
+	config, err := f.Build()
+	if err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+// Złożenie konfiguracji z kolejnych warstw bez walidacji: wartości domyślne, plik, zmienne środowiskowe, flagi
+func (f *Flags) Build() (Config, error) {
+	config := Defaults()
+
+	path, explicit := f.resolvePath()
+	if err := loadFile(path, &config); err != nil {
+		// Brak domyślnego pliku nie jest błędem - konfiguracja może pochodzić ze zmiennych środowiskowych
+		if explicit || !os.IsNotExist(errors.Cause(err)) {
+			return config, err
+		}
+	}
+
+	var err error
+	walkFields(reflect.ValueOf(&config).Elem(), "", func(field reflect.StructField, value reflect.Value, name string) {
+		env := field.Tag.Get("env")
+		if env == "" || err != nil {
+			return
+		}
+		if raw, ok := f.lookupEnv(env); ok {
+			if setErr := setValue(value, raw); setErr != nil {
+				err = errors.Wrapf(setErr, "invalid value of %s", env)
+			}
+		}
+	})
+	if err != nil {
+		return config, err
+	}
+
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	walkFields(reflect.ValueOf(&config).Elem(), "", func(field reflect.StructField, value reflect.Value, name string) {
+		flagName := field.Tag.Get("flag")
+		if flagName == "" || !set[flagName] || err != nil {
+			return
+		}
+		if setErr := setValue(value, *f.values[flagName]); setErr != nil {
+			err = errors.Wrapf(setErr, "invalid value of -%s", flagName)
+		}
+	})
+	return config, err
+}
+
+// Ścieżka pliku konfiguracyjnego: flaga -config, zmienna NEWS_CONFIG lub ścieżka domyślna
+func (f *Flags) Path() string {
+	path, _ := f.resolvePath()
+	return path
+}
+
+func (f *Flags) resolvePath() (path string, explicit bool) {
+	path = DefaultPath
+	if env, ok := f.lookupEnv(PathEnv); ok && env != "" {
+		path, explicit = env, true
+	}
+	if *f.path != "" {
+		path, explicit = *f.path, true
+	}
+	return path, explicit
+}
+
+// Załadowanie konfiguracji z flag podanych w args (np. os.Args[1:]), zmiennych środowiskowych i pliku
+func Load(args []string) (Config, error) {
+	fs := flag.NewFlagSet("news", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	return flags.Load()
+}
+
+// Odczytanie pliku JSON lub YAML (na podstawie rozszerzenia). Nieznane pola są błędem, aby literówki nie przechodziły niezauważone.
+func loadFile(path string, config *Config) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read config file %s", path)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(config)
+		if err == io.EOF {
+			err = nil
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(config)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse config file %s", path)
+	}
+	return nil
+}
+
+// Wywołanie fn dla każdego pola typu prostego, listy i mapy (również w zagnieżdżonych strukturach).
+// Name to ścieżka pola złożona z nazw JSON, np. outbox.batchSize.
+func walkFields(v reflect.Value, prefix string, fn func(field reflect.StructField, value reflect.Value, name string)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := prefix + strings.Split(field.Tag.Get("json"), ",")[0]
+		value := v.Field(i)
+		switch value.Kind() {
+		case reflect.Struct:
+			walkFields(value, name+".", fn)
+		case reflect.String, reflect.Int, reflect.Bool, reflect.Slice, reflect.Map:
+			fn(field, value, name)
+		}
+	}
+}
+
+func setValue(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		value.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		value.SetBool(b)
+	}
+	return nil
+}
+
+// Kopia konfiguracji z ukrytymi wartościami pól oznaczonych tagiem secret
+func (c Config) Redacted() Config {
+	walkFields(reflect.ValueOf(&c).Elem(), "", func(field reflect.StructField, value reflect.Value, _ string) {
+		if field.Tag.Get("secret") != "true" {
+			return
+		}
+		switch {
+		case value.Kind() == reflect.String && value.String() != "":
+			value.SetString(redactedValue)
+		case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.String && value.Len() > 0:
+			// Nowa lista, aby nie nadpisać elementów współdzielonych z oryginałem
+			redacted := make([]string, value.Len())
+			for i := range redacted {
+				redacted[i] = redactedValue
+			}
+			value.Set(reflect.ValueOf(redacted))
+		}
+	})
+	return c
+}
+
+// Zmiana pola konfiguracji
+type Change struct {
+	Field    string
+	Old      string
+	New      string
+	Reloaded bool // pole może zostać zmienione bez restartu serwisu
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Lista zmian między dwiema konfiguracjami. Wartości pól z tagiem secret nie są ujawniane.
+func Diff(old, new Config) []Change {
+	newValue := reflect.ValueOf(&new).Elem()
+	values := make(map[string]reflect.Value)
+	walkFields(newValue, "", func(_ reflect.StructField, value reflect.Value, name string) {
+		values[name] = value
+	})
+
+	var changes []Change
+	walkFields(reflect.ValueOf(&old).Elem(), "", func(field reflect.StructField, value reflect.Value, name string) {
+		other := values[name]
+		if reflect.DeepEqual(value.Interface(), other.Interface()) {
+			return
+		}
+		change := Change{Field: name, Reloaded: field.Tag.Get("reload") == "true"}
+		if field.Tag.Get("secret") == "true" {
+			change.Old, change.New = redactedValue, "(changed)"
+		} else {
+			change.Old, change.New = formatValue(value), formatValue(other)
+		}
+		changes = append(changes, change)
+	})
+	return changes
+}
+
+func formatValue(value reflect.Value) string {
+	data, err := json.Marshal(value.Interface())
+	if err != nil {
+		return fmt.Sprint(value.Interface())
+	}
+	return string(data)
+}
+
+// Wypisanie konfiguracji w formacie JSON
+func Print(w io.Writer, config Config, redacted bool) error {
+	if redacted {
+		config = config.Redacted()
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal("cannot write config file:", err)
+	}
+	return path
+}
+
+func buildConfig(t *testing.T, env map[string]string, args ...string) (Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	flags.lookupEnv = func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatal("cannot parse flags:", err)
+	}
+	return flags.Build()
+}
+
+// Test precedence of defaults, file, environment variables and flags
+func TestLayeredConfig(t *testing.T) {
+	path := writeFile(t, "config.json", `{"host": "file-host", "user": "file-user", "password": "file-secret", "tableName": "News", "outbox": {"batchSize": 50}}`)
+
+	cfg, err := buildConfig(t, map[string]string{
+		"NEWS_DB_USER":     "env-user",
+		"NEWS_DB_PASSWORD": "env-secret",
+	}, "-config", path, "-db-user", "flag-user")
+	assert.NoError(t, err)
+	assert.Equal(t, "file-host", cfg.Host)
+	assert.Equal(t, "flag-user", cfg.User)
+	assert.Equal(t, "env-secret", cfg.Password)
+	assert.Equal(t, 50, cfg.Outbox.BatchSize)
+	assert.Equal(t, 5432, cfg.Port)
+	assert.Equal(t, "log", cfg.Outbox.Publisher)
+	assert.Equal(t, 10, cfg.Outbox.MaxAttempts)
+}
+
+// Test the config path from the environment and a missing explicit file
+func TestConfigPath(t *testing.T) {
+	path := writeFile(t, "news.yaml", "host: yaml-host\nviews:\n  popularPeriods:\n    day: 1\n")
+	cfg, err := buildConfig(t, map[string]string{PathEnv: path})
+	assert.NoError(t, err)
+	assert.Equal(t, "yaml-host", cfg.Host)
+	assert.Equal(t, map[string]int{"day": 1}, cfg.Views.PopularPeriods)
+
+	_, err = buildConfig(t, nil, "-config", filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+// Test that typos in the file and malformed values are reported
+func TestConfigErrors(t *testing.T) {
+	path := writeFile(t, "config.yml", "hots: localhost\n")
+	_, err := buildConfig(t, nil, "-config", path)
+	assert.Error(t, err)
+
+	path = writeFile(t, "config.json", `{"prot": 5432}`)
+	_, err = buildConfig(t, nil, "-config", path)
+	assert.Error(t, err)
+
+	_, err = buildConfig(t, map[string]string{"NEWS_DB_PORT": "five"}, "-config", writeFile(t, "empty.json", `{}`))
+	assert.EqualError(t, err, `invalid value of NEWS_DB_PORT: "five" is not an integer`)
+}
+
+// Test that validation lists every problem
+func TestValidate(t *testing.T) {
+	cfg := Defaults()
+	cfg.Port = 0
+	cfg.TableName = `News"`
+	cfg.Outbox.Publisher = "nats"
+	cfg.Outbox.MaxAttempts = 0
+	cfg.Views.PopularPeriods = map[string]int{"week": 0}
+	cfg.Idempotency.TTLHours = 0
+	cfg.Idempotency.PurgeIntervalMinutes = -1
+	cfg.Bulk.MaxOperations = 0
+	cfg.Import.MaxRows = 0
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "proxy.local"}
+
+	err := cfg.Validate()
+	assert.IsType(t, &ValidationError{}, err)
+	assert.ElementsMatch(t, []string{
+		"host is required",
+		"user is required",
+		"dbname is required",
+		"port must be between 1 and 65535, got 0",
+		"tableName must not contain double quotes",
+		"schemaName is required",
+		"outbox.url is required",
+		"outbox.maxAttempts must be at least 1, got 0",
+		"views.popularPeriods.week must be a positive number of days",
+		"idempotency.ttlHours must be at least 1, got 0",
+		"idempotency.purgeIntervalMinutes must not be negative, got -1",
+		"bulk.maxOperations must be at least 1, got 0",
+		"import.maxRows must be at least 1, got 0",
+		`server.trustedProxies: "proxy.local" is not an IP address or CIDR network`,
+	}, err.(*ValidationError).Problems)
+}
+
+// Test that the example configuration files load and validate
+func TestExampleConfigs(t *testing.T) {
+	for _, path := range []string{"configExample.json", "testConfigExample.json"} {
+		cfg, err := buildConfig(t, nil, "-config", path)
+		assert.NoError(t, err, path)
+		assert.NoError(t, cfg.Validate(), path)
+	}
+}
+
+// Test redacting secrets when printing the configuration
+func TestPrintRedacted(t *testing.T) {
+	cfg := Defaults()
+	cfg.Password = "hunter2"
+	cfg.JWT.Secret = "current-key"
+	cfg.JWT.PreviousSecrets = []string{"old-key"}
+
+	var out bytes.Buffer
+	assert.NoError(t, Print(&out, cfg, true))
+	assert.Contains(t, out.String(), `"password": "******"`)
+	assert.NotContains(t, out.String(), "hunter2")
+	assert.NotContains(t, out.String(), "current-key")
+	assert.NotContains(t, out.String(), "old-key")
+	assert.Equal(t, "hunter2", cfg.Password)
+	assert.Equal(t, []string{"old-key"}, cfg.JWT.PreviousSecrets)
+
+	out.Reset()
+	assert.NoError(t, Print(&out, cfg, false))
+	assert.Contains(t, out.String(), `"password": "hunter2"`)
+}
+
+// Test listing changed fields without revealing secrets
+func TestDiff(t *testing.T) {
+	old := Defaults()
+	new := Defaults()
+	new.CORS.AllowedOrigins = []string{"https://library.example"}
+	new.JWT.Secret = "rotated"
+	new.Host = "db2"
+	new.RateLimit.Write.Requests = 60
+	new.RateLimit.Enabled = false
+
+	changes := Diff(old, new)
+	assert.Len(t, changes, 5)
+	byField := make(map[string]Change)
+	for _, change := range changes {
+		byField[change.Field] = change
+	}
+	assert.Equal(t, `cors.allowedOrigins: ["*"] -> ["https://library.example"]`, byField["cors.allowedOrigins"].String())
+	assert.True(t, byField["cors.allowedOrigins"].Reloaded)
+	assert.NotContains(t, byField["jwt.secret"].String(), "rotated")
+	assert.False(t, byField["host"].Reloaded)
+	assert.Equal(t, "rateLimit.write.requests: 30 -> 60", byField["rateLimit.write.requests"].String())
+	assert.True(t, byField["rateLimit.write.requests"].Reloaded)
+	assert.False(t, byField["rateLimit.enabled"].Reloaded)
+	assert.Empty(t, Diff(old, Defaults()))
+}
+
+// Test validating reloadable settings
+func TestValidateRuntimeSettings(t *testing.T) {
+	cfg, err := buildConfig(t, nil, "-config", "testConfigExample.json")
+	assert.NoError(t, err)
+	cfg.LogLevel = "verbose"
+	cfg.LogFormat = "xml"
+	cfg.CORS.AllowedOrigins = nil
+	cfg.Features = map[string]bool{"comments": false, "polls": true}
+
+	err = cfg.Validate()
+	if assert.IsType(t, &ValidationError{}, err) {
+		problems := strings.Join(err.(*ValidationError).Problems, "\n")
+		assert.Contains(t, problems, "logLevel")
+		assert.Contains(t, problems, `logFormat must be one of text, json, got "xml"`)
+		assert.Contains(t, problems, "cors.allowedOrigins")
+		assert.Contains(t, problems, `unknown feature "polls"`)
+		assert.NotContains(t, problems, `"comments"`)
+	}
+}
+
+// Test validating HTTPS and client certificate settings
+func TestValidateTLS(t *testing.T) {
+	cfg, err := buildConfig(t, nil, "-config", "testConfigExample.json")
+	assert.NoError(t, err)
+	cfg.Server.TLS.KeyFile = "server.key"
+	cfg.Server.TLS.ClientAuth = ClientAuthRequire
+	cfg.Server.TLS.RedirectAddress = ":80"
+	cfg.Server.TLS.ClientTenants = map[string]string{"catalog-service": "north"}
+
+	err = cfg.Validate()
+	if assert.IsType(t, &ValidationError{}, err) {
+		problems := strings.Join(err.(*ValidationError).Problems, "\n")
+		assert.Contains(t, problems, "certFile and server.tls.keyFile")
+		assert.Contains(t, problems, "server.tls.clientCAFile is required")
+		assert.Contains(t, problems, "redirectAddress requires")
+		assert.Contains(t, problems, `server.tls.clientTenants.catalog-service: unknown tenant "north"`)
+	}
+
+	cfg.Server.TLS.CertFile = "server.crt"
+	cfg.Server.TLS.ClientCAFile = "ca.crt"
+	cfg.Tenants = []TenantConfig{{Name: "north", SchemaName: "news_north"}}
+	assert.NoError(t, cfg.Validate())
+}
+
+// Test validating the tracing exporter settings
+func TestValidateTracing(t *testing.T) {
+	cfg, err := buildConfig(t, map[string]string{"NEWS_TRACING_ENABLED": "true", "NEWS_TRACING_EXPORTER": "jaeger"},
+		"-config", "testConfigExample.json", "-tracing-sample-percent", "150")
+	assert.NoError(t, err)
+
+	err = cfg.Validate()
+	if assert.IsType(t, &ValidationError{}, err) {
+		problems := strings.Join(err.(*ValidationError).Problems, "\n")
+		assert.Contains(t, problems, `tracing.exporter must be one of stdout, otlp, got "jaeger"`)
+		assert.Contains(t, problems, "tracing.samplePercent must be between 0 and 100")
+	}
+
+	cfg.Tracing.Exporter = TracingExporterOTLP
+	cfg.Tracing.SamplePercent = 10
+	assert.NoError(t, cfg.Validate())
+}
+
+// Test validating the rate limit store and budgets
+func TestValidateRateLimit(t *testing.T) {
+	cfg, err := buildConfig(t, map[string]string{"NEWS_RATE_LIMIT_STORE": "redis"}, "-config", "testConfigExample.json")
+	assert.NoError(t, err)
+	cfg.RateLimit.Write = RateLimitBudget{Requests: 10}
+
+	err = cfg.Validate()
+	if assert.IsType(t, &ValidationError{}, err) {
+		problems := strings.Join(err.(*ValidationError).Problems, "\n")
+		assert.Contains(t, problems, `rateLimit.store must be one of memory, postgres, got "redis"`)
+		assert.Contains(t, problems, "rateLimit.write needs positive requests and periodSeconds")
+		assert.NotContains(t, problems, "rateLimit.read")
+	}
+
+	// Wyłączony limit nie jest sprawdzany
+	cfg.RateLimit.Enabled = false
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Błąd walidacji zawierający wszystkie znalezione problemy konfiguracji
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Sprawdzenie kompletności i poprawności konfiguracji
+func (c Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	required := func(name, value string) {
+		if strings.TrimSpace(value) == "" {
+			problem("%s is required", name)
+		}
+	}
+
+	// Pełny DSN zastępuje pojedyncze parametry połączenia
+	if c.DB.DSN == "" {
+		required("host", c.Host)
+		required("user", c.User)
+		required("dbname", c.DBName)
+		if c.Port < 1 || c.Port > 65535 {
+			problem("port must be between 1 and 65535, got %d", c.Port)
+		}
+		if c.DB.SSLMode != "" && !contains(SSLModes, c.DB.SSLMode) {
+			problem("db.sslMode must be one of %s, got %q", strings.Join(SSLModes, ", "), c.DB.SSLMode)
+		}
+	}
+	if c.DB.MaxOpenConns > 0 && c.DB.MaxIdleConns > c.DB.MaxOpenConns {
+		problem("db.maxIdleConns (%d) must not exceed db.maxOpenConns (%d)", c.DB.MaxIdleConns, c.DB.MaxOpenConns)
+	}
+	if c.DB.ConnectAttempts < 1 {
+		problem("db.connectAttempts must be at least 1, got %d", c.DB.ConnectAttempts)
+	}
+
+	// Nazwy schematów i tabel wstawiane są do zapytań w cudzysłowach
+	identifier := func(name, value string) {
+		if strings.ContainsAny(value, "\"\x00") {
+			problem("%s must not contain double quotes", name)
+		}
+	}
+	required("tableName", c.TableName)
+	identifier("tableName", c.TableName)
+	if len(c.Tenants) == 0 {
+		required("schemaName", c.SchemaName)
+	}
+	identifier("schemaName", c.SchemaName)
+	for i, tenant := range c.Tenants {
+		required(fmt.Sprintf("tenants[%d].name", i), tenant.Name)
+		required(fmt.Sprintf("tenants[%d].schemaName", i), tenant.SchemaName)
+		identifier(fmt.Sprintf("tenants[%d].schemaName", i), tenant.SchemaName)
+	}
+
+	required("server.address", c.Server.Address)
+	if c.Metrics.Enabled && !strings.HasPrefix(c.Metrics.Path, "/") {
+		problem("metrics.path must start with /, got %q", c.Metrics.Path)
+	}
+	if c.Tracing.Enabled {
+		switch c.Tracing.Exporter {
+		case TracingExporterStdout:
+		case TracingExporterOTLP:
+			required("tracing.endpoint", c.Tracing.Endpoint)
+		default:
+			problem("tracing.exporter must be one of stdout, otlp, got %q", c.Tracing.Exporter)
+		}
+		if c.Tracing.SamplePercent < 0 || c.Tracing.SamplePercent > 100 {
+			problem("tracing.samplePercent must be between 0 and 100, got %d", c.Tracing.SamplePercent)
+		}
+	}
+	if c.RateLimit.Enabled {
+		if c.RateLimit.Store != RateLimitStoreMemory && c.RateLimit.Store != RateLimitStorePostgres {
+			problem("rateLimit.store must be one of memory, postgres, got %q", c.RateLimit.Store)
+		}
+		for _, budget := range []struct {
+			name   string
+			budget RateLimitBudget
+		}{{"read", c.RateLimit.Read}, {"write", c.RateLimit.Write}} {
+			if budget.budget.Requests < 1 || budget.budget.PeriodSeconds < 1 || budget.budget.Burst < 0 {
+				problem("rateLimit.%s needs positive requests and periodSeconds and a non-negative burst", budget.name)
+			}
+		}
+	}
+	if _, err := ParseTrustedProxies(c.Server.TrustedProxies); err != nil {
+		problem("server.trustedProxies: %v", err)
+	}
+	tlsConfig := c.Server.TLS
+	if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+		problem("server.tls.certFile and server.tls.keyFile must be set together")
+	}
+	switch tlsConfig.ClientAuth {
+	case "", ClientAuthNone:
+		if len(tlsConfig.ClientRoles) > 0 {
+			problem("server.tls.clientRoles require server.tls.clientAuth optional or require")
+		}
+		if len(tlsConfig.ClientTenants) > 0 {
+			problem("server.tls.clientTenants require server.tls.clientAuth optional or require")
+		}
+	case ClientAuthOptional, ClientAuthRequire:
+		required("server.tls.clientCAFile", tlsConfig.ClientCAFile)
+		if !tlsConfig.Enabled() {
+			problem("server.tls.clientAuth requires server.tls.certFile")
+		}
+	default:
+		problem("server.tls.clientAuth must be one of none, optional, require, got %q", tlsConfig.ClientAuth)
+	}
+	for _, subject := range sortedKeys(tlsConfig.ClientTenants) {
+		if !c.hasTenant(tlsConfig.ClientTenants[subject]) {
+			problem("server.tls.clientTenants.%s: unknown tenant %q", subject, tlsConfig.ClientTenants[subject])
+		}
+	}
+	if tlsConfig.RedirectAddress != "" && !tlsConfig.Enabled() {
+		problem("server.tls.redirectAddress requires server.tls.certFile")
+	}
+
+	switch c.Outbox.Publisher {
+	case "", "log":
+	case "http", "nats":
+		required("outbox.url", c.Outbox.URL)
+	default:
+		problem("outbox.publisher must be one of log, http, nats, got %q", c.Outbox.Publisher)
+	}
+	if c.Outbox.MaxAttempts < 1 {
+		problem("outbox.maxAttempts must be at least 1, got %d", c.Outbox.MaxAttempts)
+	}
+
+	if c.Idempotency.TTLHours < 1 {
+		problem("idempotency.ttlHours must be at least 1, got %d", c.Idempotency.TTLHours)
+	}
+
+	if c.Bulk.MaxOperations < 1 {
+		problem("bulk.maxOperations must be at least 1, got %d", c.Bulk.MaxOperations)
+	}
+
+	if c.Import.MaxRows < 1 {
+		problem("import.maxRows must be at least 1, got %d", c.Import.MaxRows)
+	}
+
+	nonNegative := map[string]int{
+		"idempotency.purgeIntervalMinutes":    c.Idempotency.PurgeIntervalMinutes,
+		"db.maxOpenConns":                     c.DB.MaxOpenConns,
+		"db.maxIdleConns":                     c.DB.MaxIdleConns,
+		"db.connMaxLifetimeSeconds":           c.DB.ConnMaxLifetimeSeconds,
+		"db.connMaxIdleTimeSeconds":           c.DB.ConnMaxIdleTimeSeconds,
+		"db.connectBackoffSeconds":            c.DB.ConnectBackoffSeconds,
+		"db.maxConnectBackoffSeconds":         c.DB.MaxConnectBackoffSeconds,
+		"server.readTimeoutSeconds":           c.Server.ReadTimeoutSeconds,
+		"server.readHeaderTimeoutSeconds":     c.Server.ReadHeaderTimeoutSeconds,
+		"server.writeTimeoutSeconds":          c.Server.WriteTimeoutSeconds,
+		"server.idleTimeoutSeconds":           c.Server.IdleTimeoutSeconds,
+		"server.maxHeaderBytes":               c.Server.MaxHeaderBytes,
+		"server.shutdownDelaySeconds":         c.Server.ShutdownDelaySeconds,
+		"health.checkTimeoutSeconds":          c.Health.CheckTimeoutSeconds,
+		"metrics.itemsCacheSeconds":           c.Metrics.ItemsCacheSeconds,
+		"server.shutdownTimeoutSeconds":       c.Server.ShutdownTimeoutSeconds,
+		"server.tls.certCheckIntervalSeconds": c.Server.TLS.CertCheckIntervalSeconds,
+		"outbox.intervalSeconds":              c.Outbox.IntervalSeconds,
+		"outbox.batchSize":                    c.Outbox.BatchSize,
+		"trash.purgeAfterDays":                c.Trash.PurgeAfterDays,
+		"trash.purgeIntervalMinutes":          c.Trash.PurgeIntervalMinutes,
+		"views.dedupWindowMinutes":            c.Views.DedupWindowMinutes,
+		"views.flushIntervalSeconds":          c.Views.FlushIntervalSeconds,
+		"views.popularMaxCount":               c.Views.PopularMaxCount,
+		"featured.maxCount":                   c.Featured.MaxCount,
+	}
+	for _, name := range sortedKeys(nonNegative) {
+		if nonNegative[name] < 0 {
+			problem("%s must not be negative, got %d", name, nonNegative[name])
+		}
+	}
+	for _, period := range sortedKeys(c.Views.PopularPeriods) {
+		if c.Views.PopularPeriods[period] <= 0 {
+			problem("views.popularPeriods.%s must be a positive number of days", period)
+		}
+	}
+
+	if !contains(LogLevels, c.LogLevel) {
+		problem("logLevel must be one of %s, got %q", strings.Join(LogLevels, ", "), c.LogLevel)
+	}
+	if !contains(LogFormats, c.LogFormat) {
+		problem("logFormat must be one of %s, got %q", strings.Join(LogFormats, ", "), c.LogFormat)
+	}
+	if len(c.CORS.AllowedOrigins) == 0 {
+		problem("cors.allowedOrigins must not be empty")
+	}
+	required("jwt.secret", c.JWT.Secret)
+	for i, secret := range c.JWT.PreviousSecrets {
+		required(fmt.Sprintf("jwt.previousSecrets[%d]", i), secret)
+	}
+	var unknown []string
+	for feature := range c.Features {
+		if !contains(FeatureNames, feature) {
+			unknown = append(unknown, feature)
+		}
+	}
+	sort.Strings(unknown)
+	for _, feature := range unknown {
+		problem("unknown feature %q, expected one of %s", feature, strings.Join(FeatureNames, ", "))
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Czy filia o podanej nazwie jest skonfigurowana
+func (c Config) hasTenant(name string) bool {
+	for _, tenant := range c.Tenants {
+		if tenant.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Sieci zaufanych proxy. Pojedynczy adres oznacza sieć /32 (lub /128 dla IPv6).
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR network", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR network", proxy)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"news/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test building connection parameters from the configuration
+func TestDSN(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Host = "db"
+	cfg.User = "news"
+	cfg.Password = `p@ss 'word\`
+	cfg.DBName = "library"
+	assert.Equal(t, `host='db' port=5432 user='news' password='p@ss \'word\\' dbname='library' sslmode='require'`,
+		DSN(cfg))
+
+	cfg.DB.SSLMode = "verify-full"
+	cfg.DB.SSLRootCert = "/etc/news/root.crt"
+	assert.Contains(t, DSN(cfg), `sslmode='verify-full' sslrootcert='/etc/news/root.crt'`)
+
+	cfg.DB.DSN = "postgres://news@db/library?sslmode=disable"
+	assert.Equal(t, cfg.DB.DSN, DSN(cfg))
+}
+
+// Test applying pool limits and giving up after the configured number of attempts
+func TestConnectDB(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = 1
+	cfg.DB.SSLMode = "disable"
+	cfg.DB.MaxOpenConns = 3
+	db, err := ConnectDB(cfg)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, 3, db.Stats().MaxOpenConnections)
+
+	start := time.Now()
+	err = WaitForDB(context.Background(), db, 3, 10*time.Millisecond, 15*time.Millisecond)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.GreaterOrEqual(t, time.Since(start), 25*time.Millisecond)
+}
+
+// Test listing every table created for a schema
+func TestTableNames(t *testing.T) {
+	assert.Equal(t, []string{"News", "News_outbox", "News_audit", "News_comments", "News_reactions", "News_reads", "News_views", "News_rate_limits", "News_idempotency"},
+		TableNames("News"))
+}
@@ -1,23 +1,88 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"news/config"
+	"news/logging"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 )
 
-func ConnectDB(config config.Config) (*sql.DB, error) {
-
-	dbInfo := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=require", config.Host, config.Port, config.User, config.Password, config.DBName)
-	db, err := sql.Open("postgres", dbInfo)
+// Otwarcie puli połączeń z bazą według konfiguracji. Połączenie nie jest jeszcze nawiązywane - służy do tego WaitForDB.
+// Zapytania przechodzą przez hooki instrumentacji (zob. AddQueryHook).
+func ConnectDB(cfg config.Config) (*sql.DB, error) {
+	connector, err := pq.NewConnector(DSN(cfg))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to connect to the database")
 	}
+	db := sql.OpenDB(instrumentedConnector{connector})
+	db.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.DB.ConnMaxLifetimeSeconds) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(cfg.DB.ConnMaxIdleTimeSeconds) * time.Second)
 	return db, nil
 }
 
+// Parametry połączenia w formacie key=value sterownika lib/pq, a jeśli podano db.dsn - sam DSN
+func DSN(cfg config.Config) string {
+	if cfg.DB.DSN != "" {
+		return cfg.DB.DSN
+	}
+	sslMode := cfg.DB.SSLMode
+	if sslMode == "" {
+		sslMode = "require"
+	}
+	params := []string{
+		"host=" + dsnValue(cfg.Host),
+		"port=" + strconv.Itoa(cfg.Port),
+		"user=" + dsnValue(cfg.User),
+		"password=" + dsnValue(cfg.Password),
+		"dbname=" + dsnValue(cfg.DBName),
+		"sslmode=" + dsnValue(sslMode),
+	}
+	if cfg.DB.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+dsnValue(cfg.DB.SSLRootCert))
+	}
+	return strings.Join(params, " ")
+}
+
+// Wartość parametru w apostrofach, aby spacje i znaki specjalne (np. w haśle) nie psuły DSN
+func dsnValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
+
+// Oczekiwanie na dostępność bazy przy starcie serwisu. Kolejne próby wykonywane są z rosnącym
+// odstępem (backoff podwajany do maxBackoff), a po attempts nieudanych próbach zwracany jest ostatni błąd.
+func WaitForDB(ctx context.Context, db *sql.DB, attempts int, backoff, maxBackoff time.Duration) error {
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = db.PingContext(ctx); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+		logging.Warn("database is not available, retrying", "attempt", attempt, "attempts", attempts, "backoff", backoff.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if maxBackoff > 0 && backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	return errors.Wrapf(err, "database is not available after %d attempts", attempts)
+}
+
 func CreateNewsTable(db *sql.DB, config config.Config) error {
 	query := fmt.Sprintf(`
 		CREATE SCHEMA IF NOT EXISTS "%s";
@@ -26,8 +91,33 @@ func CreateNewsTable(db *sql.DB, config config.Config) error {
 			"Content" TEXT NOT NULL,
 			"CreatedDate" TIMESTAMP NOT NULL,
 			"LastUpdate" TIMESTAMP NOT NULL,
-			"AuthorId" TEXT NOT NULL
-		);`, config.SchemaName, config.SchemaName, config.TableName)
+			"AuthorId" TEXT NOT NULL,
+			"DeletedAt" TIMESTAMP NULL,
+			"DeletedBy" TEXT NULL,
+			"CommentsEnabled" BOOLEAN NOT NULL DEFAULT TRUE,
+			"Pinned" BOOLEAN NOT NULL DEFAULT FALSE,
+			"PinnedUntil" TIMESTAMP NULL,
+			"Featured" BOOLEAN NOT NULL DEFAULT FALSE,
+			"Visibility" TEXT NOT NULL DEFAULT 'public' CHECK ("Visibility" IN ('public', 'readers', 'staff'))
+		);
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "DeletedAt" TIMESTAMP NULL;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "DeletedBy" TEXT NULL;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "CommentsEnabled" BOOLEAN NOT NULL DEFAULT TRUE;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "Pinned" BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "PinnedUntil" TIMESTAMP NULL;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "Featured" BOOLEAN NOT NULL DEFAULT FALSE;
+		ALTER TABLE "%s"."%s" ADD COLUMN IF NOT EXISTS "Visibility" TEXT NOT NULL DEFAULT 'public' CHECK ("Visibility" IN ('public', 'readers', 'staff'));`,
+		config.SchemaName, config.SchemaName, config.TableName,
+		config.SchemaName, config.TableName, config.SchemaName, config.TableName,
+		config.SchemaName, config.TableName, config.SchemaName, config.TableName,
+		config.SchemaName, config.TableName, config.SchemaName, config.TableName,
+		config.SchemaName, config.TableName)
+
+	// Indeks wyrażeniowy na skrócie treści przyspiesza wyszukiwanie duplikatów podczas importu
+	// (indeks na samej kolumnie TEXT przekraczałby limit rozmiaru wpisu dla długich treści)
+	query += fmt.Sprintf(`
+		CREATE INDEX IF NOT EXISTS "%[2]s_content_md5_idx" ON "%[1]s"."%[2]s" (md5("Content"));`,
+		config.SchemaName, config.TableName)
 
 	_, err := db.Exec(query)
 	if err != nil {
@@ -35,3 +125,321 @@ func CreateNewsTable(db *sql.DB, config config.Config) error {
 	}
 	return nil
 }
+
+// Nazwa tabeli outbox tworzona jest na podstawie nazwy tabeli newsów
+func OutboxTableName(tableName string) string {
+	return tableName + "_outbox"
+}
+
+func CreateOutboxTable(db *sql.DB, config config.Config) error {
+	outboxTable := OutboxTableName(config.TableName)
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"Id" BIGSERIAL PRIMARY KEY,
+			"EventId" UUID NOT NULL UNIQUE,
+			"EventType" TEXT NOT NULL,
+			"NewsId" INTEGER NOT NULL,
+			"Payload" JSONB NOT NULL,
+			"CreatedDate" TIMESTAMP NOT NULL,
+			"PublishedDate" TIMESTAMP NULL,
+			"Attempts" INTEGER NOT NULL DEFAULT 0,
+			"LastError" TEXT NULL,
+			"FailedDate" TIMESTAMP NULL,
+			"ClaimedUntil" TIMESTAMPTZ NULL
+		);
+		ALTER TABLE "%[1]s"."%[2]s" ADD COLUMN IF NOT EXISTS "FailedDate" TIMESTAMP NULL;
+		ALTER TABLE "%[1]s"."%[2]s" ADD COLUMN IF NOT EXISTS "ClaimedUntil" TIMESTAMPTZ NULL;
+		DROP INDEX IF EXISTS "%[1]s"."%[2]s_pending_idx";
+		CREATE INDEX IF NOT EXISTS "%[2]s_waiting_idx" ON "%[1]s"."%[2]s" ("Id") WHERE "PublishedDate" IS NULL AND "FailedDate" IS NULL;`,
+		config.SchemaName, outboxTable)
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create outbox table")
+	}
+	return nil
+}
+
+// Nazwa tabeli dziennika audytu tworzona jest na podstawie nazwy tabeli newsów
+func AuditTableName(tableName string) string {
+	return tableName + "_audit"
+}
+
+// Tabela dziennika audytu. Wyzwalacz blokuje modyfikację i usuwanie wpisów, więc dziennik jest tylko do dopisywania.
+func CreateAuditTable(db *sql.DB, config config.Config) error {
+	auditTable := AuditTableName(config.TableName)
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"Id" BIGSERIAL PRIMARY KEY,
+			"ActorId" TEXT NOT NULL,
+			"ActorRole" TEXT NOT NULL,
+			"Action" TEXT NOT NULL,
+			"NewsId" INTEGER NULL,
+			"Before" JSONB NULL,
+			"After" JSONB NULL,
+			"ClientIp" TEXT NULL,
+			"RequestId" TEXT NULL,
+			"CreatedDate" TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		);
+		DO $$
+		BEGIN
+			-- Wpisy zapisane wcześniej jako czas lokalny sesji przeliczane są na chwilę w czasie
+			IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = %[3]s AND table_name = %[4]s
+				AND column_name = 'CreatedDate' AND data_type = 'timestamp without time zone') THEN
+				ALTER TABLE "%[1]s"."%[2]s" ALTER COLUMN "CreatedDate" TYPE TIMESTAMPTZ USING "CreatedDate" AT TIME ZONE current_setting('TimeZone');
+			END IF;
+		END
+		$$;
+		CREATE INDEX IF NOT EXISTS "%[2]s_created_idx" ON "%[1]s"."%[2]s" ("CreatedDate");
+		CREATE INDEX IF NOT EXISTS "%[2]s_news_idx" ON "%[1]s"."%[2]s" ("NewsId");
+		CREATE OR REPLACE FUNCTION "%[1]s"."%[2]s_append_only"() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS "%[2]s_append_only" ON "%[1]s"."%[2]s";
+		CREATE TRIGGER "%[2]s_append_only" BEFORE UPDATE OR DELETE ON "%[1]s"."%[2]s"
+			FOR EACH ROW EXECUTE PROCEDURE "%[1]s"."%[2]s_append_only"();
+		DROP TRIGGER IF EXISTS "%[2]s_no_truncate" ON "%[1]s"."%[2]s";
+		CREATE TRIGGER "%[2]s_no_truncate" BEFORE TRUNCATE ON "%[1]s"."%[2]s"
+			FOR EACH STATEMENT EXECUTE PROCEDURE "%[1]s"."%[2]s_append_only"();`,
+		config.SchemaName, auditTable, pq.QuoteLiteral(config.SchemaName), pq.QuoteLiteral(auditTable))
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create audit table")
+	}
+	return nil
+}
+
+// Nazwa tabeli komentarzy tworzona jest na podstawie nazwy tabeli newsów
+func CommentsTableName(tableName string) string {
+	return tableName + "_comments"
+}
+
+// Tabela komentarzy. Odpowiedzi wskazują komentarz nadrzędny w kolumnie "ParentId".
+func CreateCommentsTable(db *sql.DB, config config.Config) error {
+	commentsTable := CommentsTableName(config.TableName)
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"Id" SERIAL PRIMARY KEY,
+			"NewsId" INTEGER NOT NULL REFERENCES "%[1]s"."%[3]s" ("Id") ON DELETE CASCADE,
+			"ParentId" INTEGER NULL REFERENCES "%[1]s"."%[2]s" ("Id") ON DELETE CASCADE,
+			"AuthorId" TEXT NOT NULL,
+			"Content" TEXT NOT NULL,
+			"Status" TEXT NOT NULL DEFAULT 'pending' CHECK ("Status" IN ('pending', 'approved', 'hidden')),
+			"CreatedDate" TIMESTAMP NOT NULL,
+			"LastUpdate" TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS "%[2]s_news_idx" ON "%[1]s"."%[2]s" ("NewsId", "ParentId", "Id");`,
+		config.SchemaName, commentsTable, config.TableName)
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create comments table")
+	}
+	return nil
+}
+
+// Nazwa tabeli reakcji tworzona jest na podstawie nazwy tabeli newsów
+func ReactionsTableName(tableName string) string {
+	return tableName + "_reactions"
+}
+
+// Nazwa tabeli przeczytanych newsów tworzona jest na podstawie nazwy tabeli newsów
+func ReadsTableName(tableName string) string {
+	return tableName + "_reads"
+}
+
+// Tabele reakcji użytkowników oraz oznaczeń newsów jako przeczytane
+func CreateReactionsTables(db *sql.DB, config config.Config) error {
+	reactionsTable := ReactionsTableName(config.TableName)
+	readsTable := ReadsTableName(config.TableName)
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"NewsId" INTEGER NOT NULL REFERENCES "%[1]s"."%[4]s" ("Id") ON DELETE CASCADE,
+			"UserId" TEXT NOT NULL,
+			"Reaction" TEXT NOT NULL,
+			"CreatedDate" TIMESTAMP NOT NULL,
+			PRIMARY KEY ("NewsId", "UserId", "Reaction")
+		);
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[3]s" (
+			"NewsId" INTEGER NOT NULL REFERENCES "%[1]s"."%[4]s" ("Id") ON DELETE CASCADE,
+			"UserId" TEXT NOT NULL,
+			"ReadDate" TIMESTAMP NOT NULL,
+			PRIMARY KEY ("NewsId", "UserId")
+		);
+		CREATE INDEX IF NOT EXISTS "%[3]s_user_idx" ON "%[1]s"."%[3]s" ("UserId");`,
+		config.SchemaName, reactionsTable, readsTable, config.TableName)
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create reactions tables")
+	}
+	return nil
+}
+
+// Nazwa tabeli wyświetleń tworzona jest na podstawie nazwy tabeli newsów
+func ViewsTableName(tableName string) string {
+	return tableName + "_views"
+}
+
+// Tabela dziennych liczników wyświetleń newsów
+func CreateViewsTable(db *sql.DB, config config.Config) error {
+	viewsTable := ViewsTableName(config.TableName)
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"NewsId" INTEGER NOT NULL REFERENCES "%[1]s"."%[3]s" ("Id") ON DELETE CASCADE,
+			"Day" DATE NOT NULL,
+			"Views" BIGINT NOT NULL DEFAULT 0,
+			PRIMARY KEY ("NewsId", "Day")
+		);
+		CREATE INDEX IF NOT EXISTS "%[2]s_day_idx" ON "%[1]s"."%[2]s" ("Day");`,
+		config.SchemaName, viewsTable, config.TableName)
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create views table")
+	}
+	return nil
+}
+
+// Nazwa tabeli kluczy idempotencji tworzona jest na podstawie nazwy tabeli newsów
+func IdempotencyTableName(tableName string) string {
+	return tableName + "_idempotency"
+}
+
+// Tabela kluczy Idempotency-Key. Klucz jest unikalny w obrębie wykonującego żądanie i przechowuje
+// skrót treści żądania oraz zapisaną odpowiedź, zwracaną przy ponowieniu do czasu ExpiresAt.
+func CreateIdempotencyTable(db *sql.DB, config config.Config) error {
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"Requester" TEXT NOT NULL,
+			"Key" TEXT NOT NULL,
+			"RequestHash" TEXT NOT NULL,
+			"Status" INTEGER NULL,
+			"ContentType" TEXT NULL,
+			"Response" BYTEA NULL,
+			"CreatedAt" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			"ExpiresAt" TIMESTAMPTZ NOT NULL,
+			PRIMARY KEY ("Requester", "Key")
+		);
+		CREATE INDEX IF NOT EXISTS "%[2]s_expires_idx" ON "%[1]s"."%[2]s" ("ExpiresAt");`,
+		config.SchemaName, IdempotencyTableName(config.TableName))
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create idempotency table")
+	}
+	return nil
+}
+
+// Nazwa tabeli limitów żądań tworzona jest na podstawie nazwy tabeli newsów
+func RateLimitsTableName(tableName string) string {
+	return tableName + "_rate_limits"
+}
+
+// Tabela stanu limitów żądań współdzielona przez instancje serwisu (rateLimit.store = postgres).
+// Każdy wiersz to kubełek żetonów jednego użytkownika lub adresu IP.
+func CreateRateLimitsTable(db *sql.DB, config config.Config) error {
+	query := fmt.Sprintf(`
+		CREATE SCHEMA IF NOT EXISTS "%[1]s";
+		CREATE TABLE IF NOT EXISTS "%[1]s"."%[2]s" (
+			"Key" TEXT PRIMARY KEY,
+			"Tokens" DOUBLE PRECISION NOT NULL,
+			"Allowed" BOOLEAN NOT NULL,
+			"UpdatedAt" TIMESTAMPTZ NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS "%[2]s_updated_idx" ON "%[1]s"."%[2]s" ("UpdatedAt");`,
+		config.SchemaName, RateLimitsTableName(config.TableName))
+
+	_, err := db.Exec(query)
+	if err != nil {
+		return errors.Wrap(err, "failed to create rate limits table")
+	}
+	return nil
+}
+
+// Utworzenie wszystkich tabel serwisu w schemacie z konfiguracji
+func CreateTables(db *sql.DB, cfg config.Config) error {
+	steps := []struct {
+		name   string
+		create func(*sql.DB, config.Config) error
+	}{
+		{"News", CreateNewsTable},
+		{"outbox", CreateOutboxTable},
+		{"audit", CreateAuditTable},
+		{"comments", CreateCommentsTable},
+		{"reactions", CreateReactionsTables},
+		{"views", CreateViewsTable},
+		{"rate limits", CreateRateLimitsTable},
+		{"idempotency", CreateIdempotencyTable},
+	}
+	for _, step := range steps {
+		if err := step.create(db, cfg); err != nil {
+			return errors.Wrapf(err, "failed to create %s tables", step.name)
+		}
+	}
+	return nil
+}
+
+// Utworzenie tabel w schemacie każdej filii z konfiguracji
+func CreateTenantTables(db *sql.DB, cfg config.Config) error {
+	for _, schemaName := range cfg.Schemas() {
+		if err := CreateTables(db, cfg.ForSchema(schemaName)); err != nil {
+			return errors.Wrapf(err, "failed to bootstrap schema %s", schemaName)
+		}
+	}
+	return nil
+}
+
+// Kolumny tabeli newsów dodawane w kolejnych wersjach serwisu. Po dodaniu kolumny w CreateNewsTable
+// należy ją dopisać tutaj, aby CheckSchema wykrywał nieaktualny schemat.
+var newsColumns = []string{"Id", "Content", "CreatedDate", "LastUpdate", "AuthorId", "DeletedAt", "DeletedBy",
+	"CommentsEnabled", "Pinned", "PinnedUntil", "Featured", "Visibility"}
+
+// Nazwy wszystkich tabel serwisu w schemacie
+func TableNames(tableName string) []string {
+	return []string{tableName, OutboxTableName(tableName), AuditTableName(tableName), CommentsTableName(tableName),
+		ReactionsTableName(tableName), ReadsTableName(tableName), ViewsTableName(tableName), RateLimitsTableName(tableName),
+		IdempotencyTableName(tableName)}
+}
+
+// Sprawdzenie, czy schemat każdej filii zawiera wszystkie tabele i kolumny wymagane przez tę wersję serwisu
+func CheckSchema(ctx context.Context, db *sql.DB, cfg config.Config) error {
+	for _, schemaName := range cfg.Schemas() {
+		var missing []string
+		rows, err := db.QueryContext(ctx, `
+			SELECT t.name FROM unnest($2::text[]) AS t(name)
+			WHERE NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = $1 AND table_name = t.name)
+			UNION ALL
+			SELECT $3 || '.' || c.name FROM unnest($4::text[]) AS c(name)
+			WHERE NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = $1 AND table_name = $3 AND column_name = c.name)`,
+			schemaName, pq.Array(TableNames(cfg.TableName)), cfg.TableName, pq.Array(newsColumns))
+		if err != nil {
+			return errors.Wrapf(err, "failed to check schema %s", schemaName)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return errors.Wrapf(err, "failed to check schema %s", schemaName)
+			}
+			missing = append(missing, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return errors.Wrapf(err, "failed to check schema %s", schemaName)
+		}
+		if len(missing) > 0 {
+			return errors.Errorf("schema %s is missing %s", schemaName, strings.Join(missing, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Opis zapytania przekazywany do hooków instrumentacji
+type Statement struct {
+	Operation string // select, insert, update, delete, create, alter... lub begin/commit/rollback
+	Table     string // tabela bez nazwy schematu; pusta, jeśli nie udało się jej ustalić
+	Query     string
+}
+
+// Hook wywoływany przed każdym zapytaniem. Zwrócona funkcja wywoływana jest po zakończeniu zapytania
+// z liczbą zmienionych wierszy (-1, jeśli nieznana) i ewentualnym błędem. Zwrócony kontekst
+// przekazywany jest do sterownika (np. z rozpoczętym spanem).
+type QueryHook func(ctx context.Context, stmt Statement) (context.Context, func(rowsAffected int64, err error))
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []QueryHook
+)
+
+// Dodanie hooka instrumentacji zapytań (metryki, tracing). Hooki należy dodać przed otwarciem połączenia.
+func AddQueryHook(hook QueryHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, hook)
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, func(int64, error)) {
+	hooksMu.RLock()
+	current := hooks
+	hooksMu.RUnlock()
+	if len(current) == 0 {
+		return ctx, func(int64, error) {}
+	}
+
+	stmt := ParseStatement(query)
+	finishers := make([]func(int64, error), 0, len(current))
+	for _, hook := range current {
+		var finish func(int64, error)
+		ctx, finish = hook(ctx, stmt)
+		finishers = append(finishers, finish)
+	}
+	return ctx, func(rows int64, err error) {
+		// Zakończenie w odwrotnej kolejności, aby zagnieżdżenie (np. spanów) było zachowane
+		for i := len(finishers) - 1; i >= 0; i-- {
+			finishers[i](rows, err)
+		}
+	}
+}
+
+var (
+	commentPattern = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/`)
+	tablePattern   = regexp.MustCompile(`(?i)\b(?:FROM|INTO|UPDATE|JOIN|TABLE(?: IF (?:NOT )?EXISTS)?)\s+((?:"[^"]+"|[\w]+)(?:\s*\.\s*(?:"[^"]+"|[\w]+))?)`)
+)
+
+// Ustalenie rodzaju zapytania i głównej tabeli. Nazwa schematu jest pomijana, aby metryki filii trafiały do wspólnych serii.
+func ParseStatement(query string) Statement {
+	stmt := Statement{Query: query}
+	trimmed := strings.TrimSpace(commentPattern.ReplaceAllString(query, " "))
+	fields := strings.Fields(trimmed)
+	if len(fields) == 0 {
+		return stmt
+	}
+	stmt.Operation = strings.ToLower(strings.TrimRight(fields[0], ";"))
+
+	// Dla WITH ... istotna jest instrukcja po wyrażeniach CTE - przyjmowana jest pierwsza tabela z FROM/INTO/UPDATE
+	if match := tablePattern.FindStringSubmatch(trimmed); match != nil {
+		name := match[1]
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		stmt.Table = strings.Trim(strings.TrimSpace(name), `"`)
+	}
+	return stmt
+}
+
+// Connector opakowujący sterownik bazy instrumentacją zapytań
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{conn: conn}, nil
+}
+
+// Połączenie przekazujące wywołania do połączenia sterownika. Implementuje interfejsy z kontekstem,
+// dlatego database/sql nie korzysta z przestarzałych wariantów bez kontekstu.
+type instrumentedConn struct {
+	conn driver.Conn
+}
+
+func (c *instrumentedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *instrumentedConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	beginCtx, finish := startQuery(ctx, "BEGIN")
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(beginCtx, opts)
+	} else {
+		tx, err = c.conn.Begin()
+	}
+	finish(-1, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{tx: tx, ctx: ctx}, nil
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, finish := startQuery(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	finish(-1, err)
+	return rows, err
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, finish := startQuery(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	finish(rowsAffected(result, err), err)
+	return result, err
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func rowsAffected(result driver.Result, err error) int64 {
+	if err != nil || result == nil {
+		return -1
+	}
+	rows, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return -1
+	}
+	return rows
+}
+
+type instrumentedTx struct {
+	tx  driver.Tx
+	ctx context.Context // kontekst BeginTx, aby zakończenie transakcji trafiło do tego samego żądania
+}
+
+func (t *instrumentedTx) Commit() error {
+	_, finish := startQuery(t.ctx, "COMMIT")
+	err := t.tx.Commit()
+	finish(-1, err)
+	return err
+}
+
+func (t *instrumentedTx) Rollback() error {
+	_, finish := startQuery(t.ctx, "ROLLBACK")
+	err := t.tx.Rollback()
+	finish(-1, err)
+	return err
+}
+
+type instrumentedStmt struct {
+	stmt  driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *instrumentedStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *instrumentedStmt) Exec(args []driver.Value) (driver.Result, error) {
+	_, finish := startQuery(context.Background(), s.query)
+	result, err := s.stmt.Exec(args)
+	finish(rowsAffected(result, err), err)
+	return result, err
+}
+
+func (s *instrumentedStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, finish := startQuery(context.Background(), s.query)
+	rows, err := s.stmt.Query(args)
+	finish(-1, err)
+	return rows, err
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	ctx, finish := startQuery(ctx, s.query)
+	result, err := execer.ExecContext(ctx, args)
+	finish(rowsAffected(result, err), err)
+	return result, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	ctx, finish := startQuery(ctx, s.query)
+	rows, err := queryer.QueryContext(ctx, args)
+	finish(-1, err)
+	return rows, err
+}
+
+func namedToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, driver.ErrSkip
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
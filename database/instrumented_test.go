@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test recognising the statement type and table without the schema
+func TestParseStatement(t *testing.T) {
+	cases := map[string]Statement{
+		`SELECT n."Id" FROM "north"."News" n LEFT JOIN "north"."News_views" v ON v."NewsId" = n."Id"`: {Operation: "select", Table: "News"},
+		`INSERT INTO "news"."News_outbox" ("Type") VALUES ($1)`:                                       {Operation: "insert", Table: "News_outbox"},
+		`
+		-- odczyt komentarzy
+		UPDATE "news"."News_comments" SET "Status" = $1`: {Operation: "update", Table: "News_comments"},
+		`DELETE FROM news.reads WHERE "NewsId" = $1`:    {Operation: "delete", Table: "reads"},
+		`CREATE TABLE IF NOT EXISTS "s"."News_audit" (`: {Operation: "create", Table: "News_audit"},
+		`BEGIN`: {Operation: "begin"},
+	}
+	for query, expected := range cases {
+		stmt := ParseStatement(query)
+		assert.Equal(t, expected.Operation, stmt.Operation, query)
+		assert.Equal(t, expected.Table, stmt.Table, query)
+	}
+}
+
+// Sterownik testowy zwracający stałe wyniki bez połączenia z bazą
+type fakeConnector struct{}
+
+func (fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{}, nil }
+func (fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return fakeConn{}, nil }
+func (fakeConn) Commit() error                       { return nil }
+func (fakeConn) Rollback() error                     { return nil }
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(3), nil
+}
+
+func (fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return nil, io.ErrUnexpectedEOF
+}
+
+// Test that queries and transactions pass through the query hooks
+func TestQueryHooks(t *testing.T) {
+	type call struct {
+		stmt Statement
+		rows int64
+		err  error
+	}
+	var calls []call
+	hooksMu.Lock()
+	saved := hooks
+	hooks = nil
+	hooksMu.Unlock()
+	defer func() {
+		hooksMu.Lock()
+		hooks = saved
+		hooksMu.Unlock()
+	}()
+	AddQueryHook(func(ctx context.Context, stmt Statement) (context.Context, func(int64, error)) {
+		return ctx, func(rows int64, err error) {
+			stmt.Query = ""
+			calls = append(calls, call{stmt, rows, err})
+		}
+	})
+
+	db := sql.OpenDB(instrumentedConnector{fakeConnector{}})
+	defer db.Close()
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec(`UPDATE "news"."News" SET "Pinned" = $1`, true)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+	_, err = db.Query(`SELECT 1 FROM "news"."News"`)
+	assert.Error(t, err)
+
+	assert.Equal(t, []call{
+		{Statement{Operation: "begin"}, -1, nil},
+		{Statement{Operation: "update", Table: "News"}, 3, nil},
+		{Statement{Operation: "commit"}, -1, nil},
+		{Statement{Operation: "select", Table: "News"}, -1, io.ErrUnexpectedEOF},
+	}, calls)
+}
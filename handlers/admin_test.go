@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that pool statistics are available only to admins
+func TestGetPoolStats(t *testing.T) {
+	// Otwarcie puli nie łączy się z bazą, dlatego test nie wymaga serwera PostgreSQL
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable")
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(7)
+
+	recorder := httptest.NewRecorder()
+	GetPoolStats(db).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/db/stats", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/db/stats", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	GetPoolStats(db).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var stats PoolStats
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &stats))
+	assert.Equal(t, 7, stats.MaxOpenConnections)
+	assert.Equal(t, 0, stats.InUse)
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Wpis dziennika audytu zwracany przez GET /api/audit
+type AuditEntry struct {
+	ID          int64           `json:"id"`
+	ActorID     string          `json:"actorId"`
+	ActorRole   string          `json:"actorRole"`
+	Action      string          `json:"action"`
+	NewsID      *int            `json:"newsId"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	ClientIP    string          `json:"clientIp"`
+	RequestID   string          `json:"requestId"`
+	CreatedDate string          `json:"createdDate"`
+}
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+func GetAuditLog(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		if _, ok := authorize(w, r, "admin"); !ok {
+			return
+		}
+
+		// Budowanie warunków na podstawie parametrów zapytania
+		where, args, err := auditFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit := defaultAuditLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > maxAuditLimit {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit), http.StatusBadRequest)
+				return
+			}
+		}
+		format := r.URL.Query().Get("format")
+		if format != "" && format != "json" && format != "csv" {
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+			return
+		}
+
+		args = append(args, limit)
+		query := fmt.Sprintf(`SELECT "Id", "ActorId", "ActorRole", "Action", "NewsId", "Before", "After", "ClientIp", "RequestId", "CreatedDate" FROM "%s"."%s"%s ORDER BY "Id" DESC LIMIT $%d`,
+			schemaName, database.AuditTableName(tableName), where, len(args))
+		rows, err := db.QueryContext(r.Context(), query, args...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		entries := make([]AuditEntry, 0)
+		for rows.Next() {
+			var entry AuditEntry
+			var newsID sql.NullInt64
+			var before, after []byte
+			var clientIP, requestID sql.NullString
+			err := rows.Scan(&entry.ID, &entry.ActorID, &entry.ActorRole, &entry.Action, &newsID, &before, &after, &clientIP, &requestID, &entry.CreatedDate)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if newsID.Valid {
+				id := int(newsID.Int64)
+				entry.NewsID = &id
+			}
+			if before != nil {
+				entry.Before = before
+			}
+			if after != nil {
+				entry.After = after
+			}
+			entry.ClientIP = clientIP.String
+			entry.RequestID = requestID.String
+			entries = append(entries, entry)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if format == "csv" {
+			writeAuditCSV(w, entries)
+			return
+		}
+
+		jsonData, err := json.Marshal(entries)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// Warunki filtrowania dziennika: actor, action oraz zakres czasu from/to w formacie RFC3339
+func auditFilter(r *http.Request) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	params := r.URL.Query()
+
+	if actor := params.Get("actor"); actor != "" {
+		args = append(args, actor)
+		conditions = append(conditions, fmt.Sprintf(`"ActorId"=$%d`, len(args)))
+	}
+	if action := params.Get("action"); action != "" {
+		args = append(args, action)
+		conditions = append(conditions, fmt.Sprintf(`"Action"=$%d`, len(args)))
+	}
+	if from := params.Get("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid from date, expected RFC3339")
+		}
+		args = append(args, t.UTC())
+		conditions = append(conditions, fmt.Sprintf(`"CreatedDate">=$%d`, len(args)))
+	}
+	if to := params.Get("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid to date, expected RFC3339")
+		}
+		args = append(args, t.UTC())
+		conditions = append(conditions, fmt.Sprintf(`"CreatedDate"<$%d`, len(args)))
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+func writeAuditCSV(w http.ResponseWriter, entries []AuditEntry) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "createdDate", "actorId", "actorRole", "action", "newsId", "clientIp", "requestId", "before", "after"})
+	for _, entry := range entries {
+		newsID := ""
+		if entry.NewsID != nil {
+			newsID = strconv.Itoa(*entry.NewsID)
+		}
+		writer.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedDate,
+			entry.ActorID,
+			entry.ActorRole,
+			entry.Action,
+			newsID,
+			entry.ClientIP,
+			entry.RequestID,
+			string(entry.Before),
+			string(entry.After),
+		})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"news/settings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test building audit log filters from query parameters
+func TestAuditFilter(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/audit?actor=abc&action=news.deleted&from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z", nil)
+	where, args, err := auditFilter(req)
+	assert.NoError(t, err)
+	assert.Equal(t, ` WHERE "ActorId"=$1 AND "Action"=$2 AND "CreatedDate">=$3 AND "CreatedDate"<$4`, where)
+	assert.Len(t, args, 4)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	where, args, err = auditFilter(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "", where)
+	assert.Empty(t, args)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/audit?from=yesterday", nil)
+	_, _, err = auditFilter(req)
+	assert.Error(t, err)
+}
+
+// Test reading client address for audit entries
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.RemoteAddr = "10.0.0.5:51234"
+	assert.Equal(t, "10.0.0.5", clientIP(req))
+
+	// Nagłówek od niezaufanego połączenia jest ignorowany - klient nie może podać dowolnego adresu
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	assert.Equal(t, "10.0.0.5", clientIP(req))
+
+	cfg := config.Defaults()
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/24"}
+	settings.Store(settings.FromConfig(cfg))
+	t.Cleanup(func() { settings.Store(settings.FromConfig(config.Defaults())) })
+
+	// Od zaufanego proxy: ostatni adres spoza zaufanych proxy, a nie adres dopisany przez klienta na początku
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.0.0.1")
+	assert.Equal(t, "203.0.113.7", clientIP(req))
+	req.Header.Set("X-Forwarded-For", "garbage, 10.0.0.1")
+	assert.Equal(t, "10.0.0.1", clientIP(req))
+	req.Header.Del("X-Forwarded-For")
+	assert.Equal(t, "10.0.0.5", clientIP(req))
+}
+
+// Test that the audit log requires the admin role
+func TestGetAuditLogUnauthorized(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	recorder := httptest.NewRecorder()
+	GetAuditLog(nil, "test", "test").ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
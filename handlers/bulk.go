@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/logging"
+	"strings"
+)
+
+// Rodzaje operacji zbiorczych
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// Tryby wykonania operacji zbiorczych: wszystkie operacje w jednej transakcji
+// lub każda operacja w osobnej transakcji
+const (
+	BulkModeTransaction = "transaction"
+	BulkModeItems       = "items"
+)
+
+// Operacja na pojedynczym newsie. Create wymaga treści, update i delete - identyfikatora.
+type BulkOperation struct {
+	Op         string `json:"op"`
+	ID         int    `json:"id,omitempty"`
+	Content    string `json:"content,omitempty"`
+	Visibility string `json:"visibility,omitempty"`
+}
+
+type BulkRequest struct {
+	Mode       string          `json:"mode"` // domyślnie transaction
+	Operations []BulkOperation `json:"operations"`
+}
+
+// Wynik operacji - kod odpowiedzi, jaki zwróciłby odpowiadający jej pojedynczy endpoint
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Op     string `json:"op"`
+	Status int    `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// Sprawdzenie operacji przed wykonaniem. Zwraca opis błędu lub pusty napis.
+func (op *BulkOperation) validate() string {
+	switch op.Op {
+	case BulkCreate:
+		if op.Content == "" {
+			return "News content cannot be empty"
+		}
+		// Domyślnie news jest publiczny
+		if op.Visibility == "" {
+			op.Visibility = VisibilityPublic
+		}
+	case BulkUpdate:
+		if op.ID <= 0 {
+			return "Invalid news ID"
+		}
+		// Zmiana zastępuje treść, więc pominięcie jej usunęłoby treść ogłoszenia
+		if op.Content == "" {
+			return "News content cannot be empty"
+		}
+	case BulkDelete:
+		if op.ID <= 0 {
+			return "Invalid news ID"
+		}
+	default:
+		return fmt.Sprintf("Unknown operation %q, expected one of: create, update, delete", op.Op)
+	}
+	if op.Visibility != "" && !isVisibility(op.Visibility) {
+		return "Unknown visibility, expected one of: " + strings.Join(visibilityLevels, ", ")
+	}
+	return ""
+}
+
+// Zbiorcze tworzenie, zmiana i usuwanie newsów (np. przy przenoszeniu ogłoszeń ze starego systemu).
+// Uprawnienia są takie same jak dla pojedynczych operacji. W trybie transaction błąd dowolnej operacji
+// wycofuje wszystkie zmiany, a w trybie items każda operacja wykonywana jest niezależnie.
+// Odpowiedź zawiera wynik każdej operacji.
+func BulkNews(db *sql.DB, schemaName, tableName string, maxOperations int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin", "employee")
+		if !ok {
+			return
+		}
+
+		var request BulkRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if request.Mode == "" {
+			request.Mode = BulkModeTransaction
+		}
+		if request.Mode != BulkModeTransaction && request.Mode != BulkModeItems {
+			http.Error(w, "Unknown mode, expected one of: transaction, items", http.StatusBadRequest)
+			return
+		}
+		if len(request.Operations) == 0 {
+			http.Error(w, "No operations", http.StatusBadRequest)
+			return
+		}
+		if len(request.Operations) > maxOperations {
+			http.Error(w, fmt.Sprintf("Too many operations, at most %d are allowed", maxOperations), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Sprawdzenie wszystkich operacji przed zmianami w bazie
+		response := BulkResponse{Mode: request.Mode, Results: make([]BulkResult, len(request.Operations))}
+		invalid := false
+		for i := range request.Operations {
+			op := &request.Operations[i]
+			response.Results[i] = BulkResult{Index: i, Op: op.Op, ID: op.ID}
+			if message := op.validate(); message != "" {
+				response.Results[i].Status = http.StatusBadRequest
+				response.Results[i].Error = message
+				invalid = true
+			}
+		}
+
+		status := http.StatusOK
+		switch {
+		case request.Mode == BulkModeItems:
+			for i, op := range request.Operations {
+				if response.Results[i].Status == 0 {
+					response.Results[i] = runBulkOperation(db, r, schemaName, tableName, claims, i, op)
+				}
+			}
+		case invalid:
+			// Niepoprawna operacja w trybie transaction - żadna operacja nie jest wykonywana
+			status = http.StatusBadRequest
+			skipBulkOperations(response.Results, "Not executed, the request contains invalid operations")
+		default:
+			status = runBulkTransaction(db, r, schemaName, tableName, claims, request.Operations, response.Results)
+		}
+
+		for _, result := range response.Results {
+			if result.Status < http.StatusBadRequest {
+				response.Succeeded++
+			} else {
+				response.Failed++
+			}
+		}
+
+		jsonData, err := json.Marshal(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(jsonData)
+	}
+}
+
+// Wykonanie operacji w osobnej transakcji (tryb items)
+func runBulkOperation(db *sql.DB, r *http.Request, schemaName, tableName string, claims *LoginCredentials, index int, op BulkOperation) BulkResult {
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return bulkError(r, index, op, err)
+	}
+	defer tx.Rollback()
+
+	result := applyBulkOperation(tx, r, schemaName, tableName, claims, index, op)
+	if result.Status < http.StatusBadRequest {
+		if err := tx.Commit(); err != nil {
+			return bulkError(r, index, op, err)
+		}
+	}
+	return result
+}
+
+// Wykonanie wszystkich operacji w jednej transakcji (tryb transaction). Po pierwszym błędzie transakcja
+// jest wycofywana, a wcześniejsze i dalsze operacje oznaczane jako niewykonane. Zwraca kod odpowiedzi.
+func runBulkTransaction(db *sql.DB, r *http.Request, schemaName, tableName string, claims *LoginCredentials, operations []BulkOperation, results []BulkResult) int {
+	tx, err := db.BeginTx(r.Context(), nil)
+	if err != nil {
+		results[0] = bulkError(r, 0, operations[0], err)
+		skipBulkOperations(results, "Not executed, the transaction was rolled back")
+		return http.StatusInternalServerError
+	}
+	defer tx.Rollback()
+
+	for i, op := range operations {
+		results[i] = applyBulkOperation(tx, r, schemaName, tableName, claims, i, op)
+		if results[i].Status >= http.StatusBadRequest {
+			skipBulkOperations(results, "Not executed, the transaction was rolled back")
+			return results[i].Status
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		logging.FromContext(r.Context()).Error("bulk transaction failed", "error", err)
+		for i := range results {
+			results[i].Status = http.StatusInternalServerError
+			results[i].Error = "Failed to commit the transaction"
+		}
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// Oznaczenie operacji bez błędu jako niewykonanych (kod 424 Failed Dependency)
+func skipBulkOperations(results []BulkResult, message string) {
+	for i := range results {
+		if results[i].Status < http.StatusBadRequest {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = message
+			// Identyfikator wycofanego newsa nie istnieje
+			if results[i].Op == BulkCreate {
+				results[i].ID = 0
+			}
+		}
+	}
+}
+
+// Wykonanie operacji w podanej transakcji, z tymi samymi kodami wyniku co pojedyncze endpointy
+func applyBulkOperation(tx *sql.Tx, r *http.Request, schemaName, tableName string, claims *LoginCredentials, index int, op BulkOperation) BulkResult {
+	result := BulkResult{Index: index, Op: op.Op, ID: op.ID, Status: http.StatusOK}
+	var err error
+	switch op.Op {
+	case BulkCreate:
+		var news News
+		news, err = insertNews(tx, r, schemaName, tableName, claims, NewNews{Content: op.Content, Visibility: op.Visibility})
+		result.ID = news.ID
+		result.Status = http.StatusCreated
+	case BulkUpdate:
+		_, err = updateNews(tx, r, schemaName, tableName, claims, op.ID, op.Content, op.Visibility)
+	case BulkDelete:
+		err = trashNews(tx, r, schemaName, tableName, claims, op.ID)
+	}
+	if err == sql.ErrNoRows {
+		result.Status = http.StatusNotFound
+		result.Error = "News not found"
+		return result
+	}
+	if err != nil {
+		return bulkError(r, index, op, err)
+	}
+	return result
+}
+
+// Wynik operacji zakończonej błędem bazy. Szczegóły błędu trafiają tylko do logu.
+func bulkError(r *http.Request, index int, op BulkOperation, err error) BulkResult {
+	logging.FromContext(r.Context()).Error("bulk operation failed", "index", index, "op", op.Op, "error", err)
+	return BulkResult{Index: index, Op: op.Op, ID: op.ID, Status: http.StatusInternalServerError, Error: "Database error"}
+}
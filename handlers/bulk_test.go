@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test validation of single bulk operations
+func TestBulkOperationValidate(t *testing.T) {
+	create := BulkOperation{Op: BulkCreate, Content: "Test"}
+	assert.Empty(t, create.validate())
+	assert.Equal(t, VisibilityPublic, create.Visibility)
+
+	assert.Empty(t, (&BulkOperation{Op: BulkUpdate, ID: 1, Content: "Test", Visibility: VisibilityStaff}).validate())
+	assert.Empty(t, (&BulkOperation{Op: BulkDelete, ID: 1}).validate())
+	assert.Equal(t, "News content cannot be empty", (&BulkOperation{Op: BulkCreate}).validate())
+	assert.Equal(t, "Invalid news ID", (&BulkOperation{Op: BulkDelete}).validate())
+	assert.Contains(t, (&BulkOperation{Op: BulkUpdate, ID: 1, Content: "Test", Visibility: "everyone"}).validate(), "Unknown visibility")
+	// Zmiana samej widoczności nie może wyczyścić treści
+	assert.Equal(t, "News content cannot be empty", (&BulkOperation{Op: BulkUpdate, ID: 5, Visibility: VisibilityStaff}).validate())
+	assert.Contains(t, (&BulkOperation{Op: "archive", ID: 1}).validate(), "Unknown operation")
+}
+
+// Test rejecting bulk requests before touching the database
+func TestBulkNewsValidation(t *testing.T) {
+	handler := BulkNews(nil, "test", "test", 2)
+	post := func(body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/News/bulk", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post(`{"operations": [{"op": "delete", "id": 1}]}`, "").Code)
+	assert.Equal(t, http.StatusBadRequest, post(`[]`, adminToken).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"operations": []}`, adminToken).Code)
+	assert.Equal(t, http.StatusBadRequest, post(`{"mode": "best-effort", "operations": [{"op": "delete", "id": 1}]}`, adminToken).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge,
+		post(`{"operations": [{"op": "delete", "id": 1}, {"op": "delete", "id": 2}, {"op": "delete", "id": 3}]}`, adminToken).Code)
+
+	// Jedna niepoprawna operacja w trybie transaction blokuje wszystkie
+	recorder := post(`{"operations": [{"op": "create", "content": "Test"}, {"op": "update", "id": 0}]}`, adminToken)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	var response BulkResponse
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, BulkModeTransaction, response.Mode)
+	assert.Equal(t, 0, response.Succeeded)
+	assert.Equal(t, 2, response.Failed)
+	assert.Equal(t, http.StatusFailedDependency, response.Results[0].Status)
+	assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+	assert.Equal(t, "Invalid news ID", response.Results[1].Error)
+
+	// Zmiana samej widoczności jest odrzucana przed zapisem
+	recorder = post(`{"operations": [{"op": "update", "id": 5, "visibility": "staff"}]}`, adminToken)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	response = BulkResponse{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "News content cannot be empty", response.Results[0].Error)
+
+	// W trybie items każda operacja otrzymuje własny wynik
+	recorder = post(`{"mode": "items", "operations": [{"op": "create"}, {"op": "remove", "id": 1}]}`, adminToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	response = BulkResponse{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Failed)
+	assert.Equal(t, 1, response.Results[1].Index)
+	assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+}
+
+// Test that failed and skipped operations do not report identifiers of rolled back news
+func TestSkipBulkOperations(t *testing.T) {
+	results := []BulkResult{
+		{Index: 0, Op: BulkCreate, ID: 10, Status: http.StatusCreated},
+		{Index: 1, Op: BulkUpdate, ID: 3, Status: http.StatusNotFound, Error: "News not found"},
+		{Index: 2, Op: BulkDelete, ID: 4},
+	}
+	skipBulkOperations(results, "rolled back")
+	assert.Equal(t, BulkResult{Index: 0, Op: BulkCreate, Status: http.StatusFailedDependency, Error: "rolled back"}, results[0])
+	assert.Equal(t, http.StatusNotFound, results[1].Status)
+	assert.Equal(t, BulkResult{Index: 2, Op: BulkDelete, ID: 4, Status: http.StatusFailedDependency, Error: "rolled back"}, results[2])
+}
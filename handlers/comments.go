@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/database"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// Statusy moderacji komentarzy
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentHidden   = "hidden"
+)
+
+// Rodzaje operacji na komentarzach zapisywane w dzienniku audytu i tabeli outbox
+const (
+	commentCreated         = "comment.created"
+	commentApproved        = "comment.approved"
+	commentHidden          = "comment.hidden"
+	commentDeleted         = "comment.deleted"
+	commentSettingsChanged = "news.comments_settings_changed"
+)
+
+const (
+	defaultCommentsPageSize = 20
+	maxCommentsPageSize     = 100
+)
+
+type Comment struct {
+	ID          int       `json:"id"`
+	NewsID      int       `json:"newsId"`
+	ParentID    *int      `json:"parentId"`
+	AuthorID    string    `json:"authorId"`
+	Content     string    `json:"content"`
+	Status      string    `json:"status"`
+	CreatedDate string    `json:"createdDate"`
+	LastUpdate  string    `json:"lastUpdate"`
+	Replies     []Comment `json:"replies,omitempty"`
+}
+
+type NewComment struct {
+	Content  string `json:"content"`
+	ParentID *int   `json:"parentId"`
+}
+
+// Strona komentarzy najwyższego poziomu wraz z odpowiedziami
+type CommentsPage struct {
+	CommentsEnabled bool      `json:"commentsEnabled"`
+	Page            int       `json:"page"`
+	PageSize        int       `json:"pageSize"`
+	Total           int       `json:"total"`
+	Items           []Comment `json:"items"`
+}
+
+const commentColumns = `"Id", "NewsId", "ParentId", "AuthorId", "Content", "Status", "CreatedDate", "LastUpdate"`
+
+func GetComments(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+		page, pageSize, err := parsePagination(r, defaultCommentsPageSize, maxCommentsPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Token jest opcjonalny - pracownicy widzą również komentarze oczekujące i ukryte
+		claims, ok := readerClaims(w, r)
+		if !ok {
+			return
+		}
+		statuses := []string{CommentApproved}
+		if claims != nil && hasRole(claims, "admin", "employee") {
+			statuses = []string{CommentApproved, CommentPending, CommentHidden}
+		}
+
+		enabled, err := commentsEnabled(r.Context(), db, schemaName, tableName, newsID, claims)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		commentsTable := database.CommentsTableName(tableName)
+		result := CommentsPage{CommentsEnabled: enabled, Page: page, PageSize: pageSize, Items: make([]Comment, 0)}
+
+		countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM "%s"."%s" WHERE "NewsId"=$1 AND "ParentId" IS NULL AND "Status" = ANY($2)`, schemaName, commentsTable)
+		err = db.QueryRowContext(r.Context(), countQuery, newsID, pq.Array(statuses)).Scan(&result.Total)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Stronicowane są tylko komentarze najwyższego poziomu, odpowiedzi dołączane są do nich w całości
+		query := fmt.Sprintf(`SELECT %s FROM "%s"."%s" WHERE "NewsId"=$1 AND "ParentId" IS NULL AND "Status" = ANY($2) ORDER BY "Id" LIMIT $3 OFFSET $4`,
+			commentColumns, schemaName, commentsTable)
+		topLevel, err := queryComments(r.Context(), db, query, newsID, pq.Array(statuses), pageSize, (page-1)*pageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if len(topLevel) > 0 {
+			parentIDs := make([]int64, 0, len(topLevel))
+			for _, comment := range topLevel {
+				parentIDs = append(parentIDs, int64(comment.ID))
+			}
+			repliesQuery := fmt.Sprintf(`SELECT %s FROM "%s"."%s" WHERE "ParentId" = ANY($1) AND "Status" = ANY($2) ORDER BY "Id"`,
+				commentColumns, schemaName, commentsTable)
+			replies, err := queryComments(r.Context(), db, repliesQuery, pq.Array(parentIDs), pq.Array(statuses))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result.Items = threadComments(topLevel, replies)
+		}
+
+		jsonData, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+func CreateComment(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		// Komentarze może dodawać każdy zalogowany użytkownik
+		claims, ok := authorize(w, r)
+		if !ok {
+			return
+		}
+
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		var newComment NewComment
+		err = json.NewDecoder(r.Body).Decode(&newComment)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		newComment.Content = strings.TrimSpace(newComment.Content)
+		if newComment.Content == "" {
+			http.Error(w, "Comment content cannot be empty", http.StatusBadRequest)
+			return
+		}
+
+		enabled, err := commentsEnabled(r.Context(), db, schemaName, tableName, newsID, claims)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !enabled {
+			http.Error(w, "Comments are disabled for this news", http.StatusForbidden)
+			return
+		}
+
+		commentsTable := database.CommentsTableName(tableName)
+
+		// Odpowiedzi są możliwe tylko do komentarzy najwyższego poziomu tego samego newsa
+		if newComment.ParentID != nil {
+			var parentNewsID int
+			var grandParentID sql.NullInt64
+			parentQuery := fmt.Sprintf(`SELECT "NewsId", "ParentId" FROM "%s"."%s" WHERE "Id"=$1`, schemaName, commentsTable)
+			err = db.QueryRowContext(r.Context(), parentQuery, *newComment.ParentID).Scan(&parentNewsID, &grandParentID)
+			if err == sql.ErrNoRows || (err == nil && parentNewsID != newsID) {
+				http.Error(w, "Parent comment not found", http.StatusBadRequest)
+				return
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if grandParentID.Valid {
+				http.Error(w, "Replies can only be added to top-level comments", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Komentarze pracowników nie wymagają moderacji
+		status := CommentPending
+		if hasRole(claims, "admin", "employee") {
+			status = CommentApproved
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("NewsId", "ParentId", "AuthorId", "Content", "Status", "CreatedDate", "LastUpdate") VALUES ($1, $2, $3, $4, $5, NOW(), NOW()) RETURNING %s`,
+			schemaName, commentsTable, commentColumns)
+		comment, err := scanComment(tx.QueryRowContext(r.Context(), query, newsID, newComment.ParentID, claims.ID, newComment.Content, status))
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, commentCreated, newsID, nil, comment)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(map[string]interface{}{"id": comment.ID, "status": comment.Status})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(jsonData)
+	}
+}
+
+// Zatwierdzenie komentarza przez moderatora
+func ApproveComment(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return moderateComment(db, schemaName, tableName, CommentApproved, commentApproved)
+}
+
+// Ukrycie komentarza przez moderatora
+func HideComment(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return moderateComment(db, schemaName, tableName, CommentHidden, commentHidden)
+}
+
+func moderateComment(db *sql.DB, schemaName, tableName, status, action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin", "employee")
+		if !ok {
+			return
+		}
+		newsID, commentID, ok := commentPathIDs(w, r)
+		if !ok {
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := lockComment(r.Context(), tx, schemaName, tableName, newsID, commentID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		query := fmt.Sprintf(`UPDATE "%s"."%s" SET "Status"=$1, "LastUpdate"=NOW() WHERE "Id"=$2 RETURNING %s`,
+			schemaName, database.CommentsTableName(tableName), commentColumns)
+		after, err := scanComment(tx.QueryRowContext(r.Context(), query, status, commentID))
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, action, newsID, before, after)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Status komentarza został zmieniony"))
+	}
+}
+
+func DeleteComment(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin", "employee")
+		if !ok {
+			return
+		}
+		newsID, commentID, ok := commentPathIDs(w, r)
+		if !ok {
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		before, err := lockComment(r.Context(), tx, schemaName, tableName, newsID, commentID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Usunięcie komentarza usuwa również odpowiedzi do niego
+		query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "Id"=$1`, schemaName, database.CommentsTableName(tableName))
+		_, err = tx.ExecContext(r.Context(), query, commentID)
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, commentDeleted, newsID, before, nil)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Komentarz został usunięty"))
+	}
+}
+
+// Włączenie lub wyłączenie komentarzy dla newsa
+func UpdateCommentSettings(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin", "employee")
+		if !ok {
+			return
+		}
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		var settings struct {
+			Enabled *bool `json:"enabled"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil || settings.Enabled == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		query := fmt.Sprintf(`SELECT "CommentsEnabled" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL FOR UPDATE`, schemaName, tableName)
+		var before bool
+		err = tx.QueryRowContext(r.Context(), query, newsID).Scan(&before)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		update := fmt.Sprintf(`UPDATE "%s"."%s" SET "CommentsEnabled"=$1 WHERE "Id"=$2`, schemaName, tableName)
+		_, err = tx.ExecContext(r.Context(), update, *settings.Enabled, newsID)
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, commentSettingsChanged, newsID,
+				map[string]bool{"commentsEnabled": before}, map[string]bool{"commentsEnabled": *settings.Enabled})
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Ustawienia komentarzy zostały zmienione"))
+	}
+}
+
+// Sprawdzenie, czy news istnieje poza koszem, jest widoczny dla użytkownika i czy ma włączone komentarze
+func commentsEnabled(ctx context.Context, db *sql.DB, schemaName, tableName string, newsID int, claims *LoginCredentials) (bool, error) {
+	query := fmt.Sprintf(`SELECT "CommentsEnabled" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL AND %s`, schemaName, tableName, visibilityFilter(claims))
+	var enabled bool
+	err := db.QueryRowContext(ctx, query, newsID).Scan(&enabled)
+	return enabled, err
+}
+
+func lockComment(ctx context.Context, tx *sql.Tx, schemaName, tableName string, newsID, commentID int) (Comment, error) {
+	query := fmt.Sprintf(`SELECT %s FROM "%s"."%s" WHERE "Id"=$1 AND "NewsId"=$2 FOR UPDATE`,
+		commentColumns, schemaName, database.CommentsTableName(tableName))
+	return scanComment(tx.QueryRowContext(ctx, query, commentID, newsID))
+}
+
+func commentPathIDs(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	vars := mux.Vars(r)
+	newsID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid news ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	commentID, err := strconv.Atoi(vars["commentId"])
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return newsID, commentID, true
+}
+
+func scanComment(row *sql.Row) (Comment, error) {
+	var comment Comment
+	var parentID sql.NullInt64
+	err := row.Scan(&comment.ID, &comment.NewsID, &parentID, &comment.AuthorID, &comment.Content, &comment.Status, &comment.CreatedDate, &comment.LastUpdate)
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+	return comment, err
+}
+
+func queryComments(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]Comment, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var parentID sql.NullInt64
+		err := rows.Scan(&comment.ID, &comment.NewsID, &parentID, &comment.AuthorID, &comment.Content, &comment.Status, &comment.CreatedDate, &comment.LastUpdate)
+		if err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			comment.ParentID = &id
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// Dołączenie odpowiedzi do komentarzy nadrzędnych z zachowaniem kolejności
+func threadComments(topLevel, replies []Comment) []Comment {
+	index := make(map[int]int, len(topLevel))
+	for i, comment := range topLevel {
+		index[comment.ID] = i
+	}
+	for _, reply := range replies {
+		if reply.ParentID == nil {
+			continue
+		}
+		if i, ok := index[*reply.ParentID]; ok {
+			topLevel[i].Replies = append(topLevel[i].Replies, reply)
+		}
+	}
+	return topLevel
+}
+
+// Największy numer strony - ogranicza przesunięcie (page-1)*pageSize w zapytaniach
+const maxPage = 100000
+
+// Odczytanie parametrów stronicowania page (od 1 do maxPage) i pageSize
+func parsePagination(r *http.Request, defaultSize, maxSize int) (int, int, error) {
+	page, pageSize := 1, defaultSize
+	var err error
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 || page > maxPage {
+			return 0, 0, fmt.Errorf("page must be between 1 and %d", maxPage)
+		}
+	}
+	if value := r.URL.Query().Get("pageSize"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > maxSize {
+			return 0, 0, fmt.Errorf("pageSize must be between 1 and %d", maxSize)
+		}
+	}
+	return page, pageSize, nil
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"news/logging"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Formaty eksportu newsów
+const (
+	ExportCSV    = "csv"
+	ExportJSON   = "json"
+	ExportNDJSON = "ndjson"
+)
+
+var exportFormats = map[string]string{
+	ExportCSV:    "text/csv; charset=utf-8",
+	ExportJSON:   "application/json",
+	ExportNDJSON: "application/x-ndjson",
+}
+
+// Kolumny eksportu CSV - nazwy pól JSON newsa, reakcje w osobnych kolumnach reactions.<rodzaj>
+func exportColumns() []string {
+	columns := []string{"id", "content", "createdDate", "authorId", "lastUpdate", "visibility", "pinned", "pinnedUntil", "featured"}
+	for _, reaction := range reactionTypes {
+		columns = append(columns, "reactions."+reaction)
+	}
+	return columns
+}
+
+// Zapis kolejnych newsów w jednym z formatów eksportu
+type newsEncoder interface {
+	Encode(news News) error
+	Close() error // zakończenie dokumentu i opróżnienie bufora
+}
+
+func newNewsEncoder(format string, w io.Writer) (newsEncoder, error) {
+	switch format {
+	case ExportCSV:
+		encoder := &csvEncoder{writer: csv.NewWriter(w)}
+		return encoder, encoder.writer.Write(exportColumns())
+	case ExportJSON:
+		_, err := io.WriteString(w, "[")
+		return &jsonEncoder{w: w}, err
+	case ExportNDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvEncoder) Encode(news News) error {
+	pinnedUntil := ""
+	if news.PinnedUntil != nil {
+		pinnedUntil = *news.PinnedUntil
+	}
+	record := []string{strconv.Itoa(news.ID), news.Content, news.CreatedDate, news.AuthorID, news.LastUpdate, news.Visibility,
+		strconv.FormatBool(news.Pinned), pinnedUntil, strconv.FormatBool(news.Featured)}
+	for _, reaction := range reactionTypes {
+		record = append(record, strconv.Itoa(news.Reactions[reaction]))
+	}
+	return e.writer.Write(record)
+}
+
+func (e *csvEncoder) Close() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// Tablica JSON zapisywana element po elemencie, bez budowania całej listy w pamięci
+type jsonEncoder struct {
+	w     io.Writer
+	count int
+}
+
+func (e *jsonEncoder) Encode(news News) error {
+	data, err := json.Marshal(news)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+// Jeden news w postaci JSON na linię
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(news News) error {
+	return e.encoder.Encode(news)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+// Zapis newsów widocznych dla użytkownika (jak w GET /api/News) w podanym formacie. Wiersze odczytywane są
+// z kursora zapytania i od razu zapisywane do w, więc zużycie pamięci nie zależy od liczby newsów.
+// Zwraca liczbę zapisanych newsów.
+func WriteNewsExport(ctx context.Context, db *sql.DB, schemaName, tableName string, claims *LoginCredentials, format string, w io.Writer) (int, error) {
+	if _, ok := exportFormats[format]; !ok {
+		return 0, fmt.Errorf("unknown export format %q", format)
+	}
+
+	// Zapis zaczyna się dopiero po wykonaniu zapytania, aby jego błąd można było zgłosić kodem odpowiedzi
+	rows, err := db.QueryContext(ctx, newsWithReactionsQuery(schemaName, tableName, newsListWhere(claims)))
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to query news")
+	}
+	defer rows.Close()
+
+	encoder, err := newNewsEncoder(format, w)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		news, err := scanNewsWithReactions(rows)
+		if err != nil {
+			return count, errors.Wrap(err, "failed to scan news")
+		}
+		if err := encoder.Encode(news); err != nil {
+			return count, errors.Wrap(err, "failed to write news")
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, errors.Wrap(err, "failed to read news")
+	}
+	return count, encoder.Close()
+}
+
+// Eksport newsów do pliku CSV, JSON lub NDJSON (parametr format, domyślnie csv) na potrzeby raportów i kopii
+func ExportNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+
+		format := strings.ToLower(r.URL.Query().Get("format"))
+		if format == "" {
+			format = ExportCSV
+		}
+		contentType, ok := exportFormats[format]
+		if !ok {
+			http.Error(w, "Unknown format, expected one of: csv, json, ndjson", http.StatusBadRequest)
+			return
+		}
+
+		filename := fmt.Sprintf("news-%s-%s.%s", schemaName, time.Now().UTC().Format("20060102T150405Z"), format)
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		sent := newExportWriter(w)
+		count, err := WriteNewsExport(r.Context(), db, schemaName, tableName, claims, format, sent)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("news export failed", "format", format, "exported", count, "error", err)
+			if !sent.sent {
+				w.Header().Del("Content-Disposition")
+				http.Error(w, "Błąd podczas eksportu newsów", http.StatusInternalServerError)
+				return
+			}
+			// Nagłówki zostały już wysłane - przerwanie połączenia, aby klient nie zapisał niepełnego pliku
+			panic(http.ErrAbortHandler)
+		}
+		logging.FromContext(r.Context()).Debug("Wyeksportowano newsy", "format", format, "count", count)
+	}
+}
+
+// Czas na zapisanie kolejnej części eksportu
+const exportWriteTimeout = 30 * time.Second
+
+// Writer odpowiedzi eksportu zapamiętujący, czy odpowiedź zaczęła być wysyłana. Eksport dużej tabeli
+// może trwać dłużej niż server.writeTimeoutSeconds, dlatego limit serwera jest zdejmowany, a termin
+// zapisu przesuwany przed każdym zapisem - klient, który przestał odbierać dane, nadal jest rozłączany.
+type exportWriter struct {
+	http.ResponseWriter
+	controller *http.ResponseController
+	sent       bool
+}
+
+func newExportWriter(w http.ResponseWriter) *exportWriter {
+	controller := http.NewResponseController(w)
+	// http.ErrNotSupported (np. w testach) - obowiązuje limit serwera
+	controller.SetWriteDeadline(time.Time{})
+	return &exportWriter{ResponseWriter: w, controller: controller}
+}
+
+func (w *exportWriter) Write(data []byte) (int, error) {
+	w.sent = true
+	w.controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *exportWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"news/logging"
+	"news/metrics"
+	"news/tracing"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var exportedNews = []News{
+	{ID: 1, Content: "Godziny otwarcia, \"święta\"", CreatedDate: "2024-05-01T10:00:00Z", AuthorID: "7", LastUpdate: "2024-05-01T10:00:00Z",
+		Visibility: VisibilityPublic, Reactions: map[string]int{ReactionLike: 3, ReactionUseful: 1}},
+	{ID: 2, Content: "Zebranie\npracowników", CreatedDate: "2024-05-02T10:00:00Z", AuthorID: "8", LastUpdate: "2024-05-03T10:00:00Z",
+		Visibility: VisibilityStaff, Pinned: true},
+}
+
+func encodeNews(t *testing.T, format string) string {
+	var out bytes.Buffer
+	encoder, err := newNewsEncoder(format, &out)
+	assert.NoError(t, err)
+	for _, news := range exportedNews {
+		assert.NoError(t, encoder.Encode(news))
+	}
+	assert.NoError(t, encoder.Close())
+	return out.String()
+}
+
+// Test the CSV export with a header row and quoted content
+func TestExportCSV(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(encodeNews(t, ExportCSV))).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, exportColumns(), records[0])
+	assert.Equal(t, []string{"1", "Godziny otwarcia, \"święta\"", "2024-05-01T10:00:00Z", "7", "2024-05-01T10:00:00Z", "public", "false", "", "false", "3", "1"}, records[1])
+	assert.Equal(t, "Zebranie\npracowników", records[2][1])
+	assert.Equal(t, "true", records[2][6])
+}
+
+// Test that the JSON and NDJSON exports decode back to the same news
+func TestExportJSON(t *testing.T) {
+	var decoded []News
+	assert.NoError(t, json.Unmarshal([]byte(encodeNews(t, ExportJSON)), &decoded))
+	assert.Equal(t, exportedNews, decoded)
+
+	lines := strings.Split(strings.TrimSpace(encodeNews(t, ExportNDJSON)), "\n")
+	assert.Len(t, lines, 2)
+	var news News
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &news))
+	assert.Equal(t, exportedNews[1], news)
+
+	// Pusty eksport JSON jest poprawną pustą tablicą
+	var out bytes.Buffer
+	encoder, _ := newNewsEncoder(ExportJSON, &out)
+	assert.NoError(t, encoder.Close())
+	assert.Equal(t, "[]\n", out.String())
+
+	_, err := newNewsEncoder("xml", &out)
+	assert.Error(t, err)
+}
+
+// Test that the export requires an admin token and a known format
+func TestExportNewsValidation(t *testing.T) {
+	handler := ExportNews(nil, "test", "test")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/News/export", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/News/export?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// Test that a streamed export outlives the server write timeout behind the logging, metrics and tracing middleware
+func TestExportWriteDeadline(t *testing.T) {
+	slowExport := func(w io.Writer) {
+		encoder, _ := newNewsEncoder(ExportNDJSON, w)
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+			encoder.Encode(exportedNews[0])
+		}
+		encoder.Close()
+	}
+	tracer := tracing.New("news", 100, sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()))
+	router := mux.NewRouter()
+	router.Use(tracer.Middleware)
+	router.Use(metrics.Middleware)
+	router.HandleFunc("/api/News/export", func(w http.ResponseWriter, r *http.Request) {
+		slowExport(newExportWriter(w))
+	})
+	router.HandleFunc("/api/News/slow", func(w http.ResponseWriter, r *http.Request) {
+		slowExport(w)
+	})
+	server := httptest.NewUnstartedServer(logging.RequestID(logging.AccessLog(router)))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/News/export")
+	if assert.NoError(t, err) {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, 3, strings.Count(string(body), "\n"))
+	}
+
+	// Bez przesunięcia terminu zapisu serwer przerywa odpowiedź
+	resp, err = server.Client().Get(server.URL + "/api/News/slow")
+	if err == nil {
+		_, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	assert.Error(t, err)
+}
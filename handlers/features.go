@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+	"news/settings"
+)
+
+// Handler dostępny tylko wtedy, gdy funkcja jest włączona w konfiguracji. Ustawienie sprawdzane jest
+// przy każdym żądaniu, dlatego wyłączenie funkcji działa po przeładowaniu konfiguracji bez restartu.
+func Feature(feature string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !settings.Current().Enabled(feature) {
+			http.NotFound(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Sprawdzenie nagłówka Origin żądań CORS według aktualnej listy dozwolonych adresów
+func OriginAllowed(origin string) bool {
+	return settings.Current().OriginAllowed(origin)
+}
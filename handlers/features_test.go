@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"news/settings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// Podmiana ustawień na czas testu
+func useSettings(t *testing.T, cfg config.Config) {
+	settings.Store(settings.FromConfig(cfg))
+	t.Cleanup(func() { settings.Store(settings.FromConfig(config.Defaults())) })
+}
+
+// Test accepting tokens signed with the current or a previous key after key rotation
+func TestValidateTokenKeyRotation(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.JWT.PreviousSecrets = []string{cfg.JWT.Secret}
+	cfg.JWT.Secret = "rotated-key"
+	useSettings(t, cfg)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/nameidentifier": "7",
+		"http://schemas.microsoft.com/ws/2008/06/identity/claims/role":         "reader",
+	}).SignedString([]byte("rotated-key"))
+	assert.NoError(t, err)
+	claims, err := validateToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "7", claims.ID)
+
+	// Token podpisany poprzednim kluczem jest ważny do czasu usunięcia klucza z previousSecrets
+	_, err = validateToken(adminToken)
+	assert.NoError(t, err)
+
+	cfg.JWT.PreviousSecrets = nil
+	useSettings(t, cfg)
+	_, err = validateToken(adminToken)
+	assert.Error(t, err)
+}
+
+// Test that a disabled feature responds with 404 without restarting the server
+func TestFeatureToggle(t *testing.T) {
+	handler := Feature(config.FeatureComments, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/News/1/comments", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+
+	cfg := config.Defaults()
+	cfg.Features = map[string]bool{config.FeatureComments: false}
+	useSettings(t, cfg)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/News/1/comments", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// Test mapping a verified client certificate to a role
+func TestClientCertClaims(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Server.TLS.ClientRoles = map[string]string{"catalog-service": "employee"}
+	useSettings(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+	assert.Nil(t, clientCertClaims(req))
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "catalog-service"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	claims, err := optionalClaims(req)
+	assert.NoError(t, err)
+	assert.Equal(t, &LoginCredentials{ID: "cert:catalog-service", GrantType: "employee"}, claims)
+
+	// Filia serwisu przypisywana jest według server.tls.clientTenants
+	cfg.Server.TLS.ClientTenants = map[string]string{"catalog-service": "north"}
+	useSettings(t, cfg)
+	assert.Equal(t, &LoginCredentials{ID: "cert:catalog-service", GrantType: "employee", Tenant: "north"}, clientCertClaims(req))
+
+	cert.Subject.CommonName = "unknown-service"
+	assert.Nil(t, clientCertClaims(req))
+
+	// Certyfikat przedstawiony, ale niezweryfikowany, nie daje uprawnień
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "catalog-service"}}}}
+	assert.Nil(t, clientCertClaims(req))
+}
@@ -1,12 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"news/audit"
+	"news/logging"
+	"news/outbox"
+	"news/settings"
+	"news/tenant"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gorilla/mux"
@@ -18,22 +27,39 @@ type News struct {
 	CreatedDate string `json:"createdDate" db:"createdDate"`
 	LastUpdate  string `json:"lastUpdate" db:"lastUpdate"`
 	AuthorID    string `json:"authorId" db:"authorId"`
+	Visibility  string `json:"visibility,omitempty" db:"visibility"`
+
+	Pinned      bool    `json:"pinned,omitempty"`
+	PinnedUntil *string `json:"pinnedUntil,omitempty"`
+	Featured    bool    `json:"featured,omitempty"`
+
+	Reactions map[string]int `json:"reactions,omitempty"`
 }
 
 type NewNews struct {
-	Content string `json:"content"`
+	Content    string `json:"content"`
+	Visibility string `json:"visibility"`
 }
 
 type LoginCredentials struct {
 	ID        string `json:"ID"`
 	GrantType string `json:"grant_type"`
+	Tenant    string `json:"tenant"`
 }
 
 func GetAllNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Wykonanie zapytania SELECT
-		query := fmt.Sprintf(`SELECT "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate" FROM "%s"."%s"`, schemaName, tableName)
-		rows, err := db.Query(query)
+		schemaName := schemaFor(r, schemaName)
+
+		// Token jest opcjonalny - decyduje o tym, które newsy są widoczne
+		claims, ok := readerClaims(w, r)
+		if !ok {
+			return
+		}
+
+		// Wykonanie zapytania SELECT wraz z liczbą reakcji, przypięte newsy są zwracane jako pierwsze
+		query := newsWithReactionsQuery(schemaName, tableName, newsListWhere(claims))
+		rows, err := db.QueryContext(r.Context(), query)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -43,8 +69,7 @@ func GetAllNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 		// Przetwarzanie wyników
 		newsList := make([]News, 0)
 		for rows.Next() {
-			var news News
-			err := rows.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate)
+			news, err := scanNewsWithReactions(rows)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -66,8 +91,15 @@ func GetAllNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	}
 }
 
+// Warunek i kolejność listy newsów: newsy spoza kosza widoczne dla użytkownika, przypięte jako pierwsze
+func newsListWhere(claims *LoginCredentials) string {
+	return `n."DeletedAt" IS NULL AND ` + visibilityFilter(claims) + ` ORDER BY ` + newsListOrder
+}
+
 func GetNewsByID(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
 		// Pobranie wartości parametru "id" z ścieżki
 		vars := mux.Vars(r)
 		idStr := vars["id"]
@@ -79,13 +111,17 @@ func GetNewsByID(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 			return
 		}
 
-		// Wykonanie zapytania SELECT z mapowaniem nazw kolumn
-		query := fmt.Sprintf(`SELECT "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate" FROM "%s"."%s" WHERE "Id"=$1`, schemaName, tableName)
-		row := db.QueryRow(query, id)
+		claims, ok := readerClaims(w, r)
+		if !ok {
+			return
+		}
+
+		// Wykonanie zapytania SELECT z mapowaniem nazw kolumn. News niewidoczny dla użytkownika traktowany jest jak nieistniejący.
+		query := newsWithReactionsQuery(schemaName, tableName, `n."Id"=$1 AND n."DeletedAt" IS NULL AND `+visibilityFilter(claims))
+		row := db.QueryRowContext(r.Context(), query, id)
 
 		// Przetworzenie wyniku
-		var news News
-		err = row.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate)
+		news, err := scanNewsWithReactions(row)
 		if err == sql.ErrNoRows {
 			http.Error(w, "News not found", http.StatusNotFound)
 			return
@@ -108,29 +144,38 @@ func GetNewsByID(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	}
 }
 
-func CreateNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+func CreateNews(db *sql.DB, schemaName, tableName string, idempotencyTTL time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
 		// Sprawdzenie uprawnień użytkownika na podstawie tokenu JWT w nagłówku Authorization
-		tokenString := r.Header.Get("Authorization")
-		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
-		fmt.Println("Token: ", tokenString)
-		claims, err := validateToken(tokenString)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			fmt.Println("Token error: ", err)
+		// lub certyfikatu klienta
+		claims, ok := authorize(w, r)
+		if !ok {
 			return
 		}
 
 		// odczytujemy role z tokena
 		if claims.GrantType != "admin" && claims.GrantType != "employee" {
-			fmt.Println("Brak roli admin lub employee")
+			logging.FromContext(r.Context()).Debug("Brak roli admin lub employee", "user", claims.ID, "role", claims.GrantType)
 			return
 		}
 		authorID := claims.ID
 
+		// Klucz idempotencji pozwala bezpiecznie ponowić żądanie, np. po przekroczeniu czasu odpowiedzi
+		key, ok := idempotencyKey(w, r)
+		if !ok {
+			return
+		}
+
 		// Odczytanie danych nowego news'a z ciała żądania
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 		var newNews NewNews
-		err = json.NewDecoder(r.Body).Decode(&newNews)
+		err = json.Unmarshal(body, &newNews)
 		if err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
@@ -142,23 +187,67 @@ func CreateNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 			return
 		}
 
-		// Wstawienie nowego news'a do bazy danych
-		query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("Content", "CreatedDate", "AuthorId", "LastUpdate") VALUES ($1, NOW(), $2, NOW()) RETURNING "Id"`, schemaName, tableName)
-		var newsID int
-		err = db.QueryRow(query, newNews.Content, authorID).Scan(&newsID)
+		// Domyślnie news jest publiczny
+		if newNews.Visibility == "" {
+			newNews.Visibility = VisibilityPublic
+		}
+		if !isVisibility(newNews.Visibility) {
+			http.Error(w, "Unknown visibility, expected one of: "+strings.Join(visibilityLevels, ", "), http.StatusBadRequest)
+			return
+		}
+
+		// Wstawienie nowego news'a do bazy danych wraz ze zdarzeniem w tabeli outbox
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		// Ponowienie z użytym już kluczem zwraca zapisaną odpowiedź zamiast tworzyć kolejny news
+		if key != "" {
+			stored, err := reserveIdempotencyKey(r.Context(), tx, schemaName, tableName, authorID, key, requestHash(r, body), idempotencyTTL)
+			if err == errIdempotencyKeyReused {
+				http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusUnprocessableEntity)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if stored != nil {
+				writeStoredResponse(w, *stored)
+				return
+			}
+		}
+
+		news, err := insertNews(tx, r, schemaName, tableName, claims, newNews)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		// Utworzenie odpowiedzi zawierającej ID utworzonego news'a
-		response := map[string]int{"id": newsID}
+		response := map[string]int{"id": news.ID}
 		jsonData, err := json.Marshal(response)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
+		// Odpowiedź dla klucza idempotencji zapisywana jest w tej samej transakcji co news
+		if key != "" {
+			err = saveIdempotentResponse(r.Context(), tx, schemaName, tableName, authorID, key,
+				storedResponse{Status: http.StatusCreated, ContentType: "application/json", Body: jsonData})
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
 		// Ustawienie nagłówka i zwrócenie odpowiedzi
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -168,45 +257,63 @@ func CreateNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 
 func UpdateNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Pobranie tokena z nagłówka Authorization
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Brak tokena uwierzytelniającego", http.StatusUnauthorized)
-			return
-		}
-
-		// Wyodrębnienie samego tokenu bez prefiksu "Bearer "
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		schemaName := schemaFor(r, schemaName)
 
-		// Parsowanie i weryfikacja tokenu
-		claims, err := validateToken(tokenString)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			fmt.Println("Token error: ", err)
+		// Weryfikacja tokenu z nagłówka Authorization lub certyfikatu klienta
+		claims, ok := authorize(w, r)
+		if !ok {
 			return
 		}
 
 		if claims.GrantType != "admin" && claims.GrantType != "employee" {
-			fmt.Println("Brak roli admin lub employee")
+			logging.FromContext(r.Context()).Debug("Brak roli admin lub employee", "user", claims.ID, "role", claims.GrantType)
 			return
 		}
 		// Pobranie identyfikatora newsa z parametru ścieżki
 		vars := mux.Vars(r)
-		newsID := vars["id"]
+		newsID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
 
 		// Odczytanie treści newsa z ciała żądania
 		var newsData struct {
-			Content string `json:"content"`
+			Content    string `json:"content"`
+			Visibility string `json:"visibility"`
 		}
 		err = json.NewDecoder(r.Body).Decode(&newsData)
 		if err != nil {
 			http.Error(w, "Błąd odczytu danych żądania", http.StatusBadRequest)
 			return
 		}
+		// Treść jest zastępowana, więc jej pominięcie usunęłoby treść ogłoszenia
+		if newsData.Content == "" {
+			http.Error(w, "News content cannot be empty", http.StatusBadRequest)
+			return
+		}
+		// Pominięcie widoczności pozostawia dotychczasową
+		if newsData.Visibility != "" && !isVisibility(newsData.Visibility) {
+			http.Error(w, "Unknown visibility, expected one of: "+strings.Join(visibilityLevels, ", "), http.StatusBadRequest)
+			return
+		}
 
-		// Aktualizacja newsa w bazie danych
-		query := fmt.Sprintf(`UPDATE "%s"."%s" SET "Content"=$1, "LastUpdate"=NOW() WHERE "Id"=$2`, schemaName, tableName)
-		_, err = db.Exec(query, newsData.Content, newsID)
+		// Aktualizacja newsa w bazie danych wraz z wpisem audytu i zdarzeniem w tabeli outbox
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, "Błąd podczas aktualizacji newsa", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = updateNews(tx, r, schemaName, tableName, claims, newsID, newsData.Content, newsData.Visibility)
+		if err == sql.ErrNoRows {
+			// Brak newsa - nic nie zostało zmienione, więc nie ma też wpisu audytu ani zdarzenia
+			err = nil
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
 		if err != nil {
 			http.Error(w, "Błąd podczas aktualizacji newsa", http.StatusInternalServerError)
 			return
@@ -220,53 +327,48 @@ func UpdateNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 
 func DeleteNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Pobranie tokena z nagłówka Authorization
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Brak tokena uwierzytelniającego", http.StatusUnauthorized)
-			return
-		}
+		schemaName := schemaFor(r, schemaName)
 
-		// Wyodrębnienie samego tokenu bez prefiksu "Bearer "
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-		claims, err := validateToken(tokenString)
-		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			fmt.Println("Token error: ", err)
+		// Weryfikacja tokenu z nagłówka Authorization lub certyfikatu klienta
+		claims, ok := authorize(w, r)
+		if !ok {
 			return
 		}
 
 		if claims.GrantType != "admin" && claims.GrantType != "employee" {
-			fmt.Println("Brak roli admin lub employee")
+			logging.FromContext(r.Context()).Debug("Brak roli admin lub employee", "user", claims.ID, "role", claims.GrantType)
 			return
 		}
 
 		// Pobranie identyfikatora newsa z parametru ścieżki
 		vars := mux.Vars(r)
-		newsID := vars["id"]
-
-		// Usunięcie newsa z bazy danych
-		// ...
-		query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "Id"=$1`, schemaName, tableName)
-		result, err := db.Exec(query, newsID)
+		newsID, err := strconv.Atoi(vars["id"])
 		if err != nil {
-			http.Error(w, "Błąd podczas usuwania newsa z bazy danych", http.StatusInternalServerError)
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
 			return
 		}
 
-		// Sprawdzenie liczby usuniętych wierszy
-		rowsAffected, err := result.RowsAffected()
+		// Przeniesienie newsa do kosza wraz z wpisem audytu i zdarzeniem w tabeli outbox
+		tx, err := db.BeginTx(r.Context(), nil)
 		if err != nil {
-			http.Error(w, "Błąd podczas pobierania liczby usuniętych wierszy", http.StatusInternalServerError)
+			http.Error(w, "Błąd podczas usuwania newsa z bazy danych", http.StatusInternalServerError)
 			return
 		}
+		defer tx.Rollback()
 
-		// Sprawdzenie, czy jakikolwiek wiersz został usunięty
-		if rowsAffected == 0 {
+		// Brak newsa lub news znajdujący się już w koszu
+		err = trashNews(tx, r, schemaName, tableName, claims, newsID)
+		if err == sql.ErrNoRows {
 			http.Error(w, "Nie znaleziono newsa o podanym identyfikatorze", http.StatusNotFound)
 			return
 		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, "Błąd podczas usuwania newsa z bazy danych", http.StatusInternalServerError)
+			return
+		}
 
 		// Zwrócenie odpowiedzi sukcesu
 		w.WriteHeader(http.StatusOK)
@@ -274,8 +376,236 @@ func DeleteNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
 	}
 }
 
-// Funkcja do weryfikacji tokenu JWT i odczytu informacji
+// Wstawienie newsa w transakcji wraz z wpisem audytu i zdarzeniem w tabeli outbox
+func insertNews(tx *sql.Tx, r *http.Request, schemaName, tableName string, claims *LoginCredentials, newNews NewNews) (News, error) {
+	query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility") VALUES ($1, NOW(), $2, NOW(), $3) RETURNING "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility"`, schemaName, tableName)
+	var news News
+	err := tx.QueryRowContext(r.Context(), query, newNews.Content, claims.ID, newNews.Visibility).Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility)
+	if err != nil {
+		return News{}, err
+	}
+	return news, recordChange(tx, r, schemaName, tableName, claims, outbox.NewsCreated, news.ID, nil, news)
+}
+
+// Zmiana treści (i widoczności, jeśli podana) newsa w transakcji wraz z wpisem audytu i zdarzeniem.
+// Zwraca sql.ErrNoRows, jeśli newsa nie ma lub znajduje się w koszu.
+func updateNews(tx *sql.Tx, r *http.Request, schemaName, tableName string, claims *LoginCredentials, newsID int, content, visibility string) (News, error) {
+	before, err := lockNews(r.Context(), tx, schemaName, tableName, newsID)
+	if err != nil {
+		return News{}, err
+	}
+	query := fmt.Sprintf(`UPDATE "%s"."%s" SET "Content"=$1, "Visibility"=COALESCE(NULLIF($3, ''), "Visibility"), "LastUpdate"=NOW() WHERE "Id"=$2 RETURNING "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility"`, schemaName, tableName)
+	var news News
+	err = tx.QueryRowContext(r.Context(), query, content, newsID, visibility).Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility)
+	if err != nil {
+		return News{}, err
+	}
+	return news, recordChange(tx, r, schemaName, tableName, claims, outbox.NewsUpdated, newsID, before, news)
+}
+
+// Przeniesienie newsa do kosza w transakcji wraz z wpisem audytu i zdarzeniem.
+// Zwraca sql.ErrNoRows, jeśli newsa nie ma lub znajduje się już w koszu.
+func trashNews(tx *sql.Tx, r *http.Request, schemaName, tableName string, claims *LoginCredentials, newsID int) error {
+	before, err := lockNews(r.Context(), tx, schemaName, tableName, newsID)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf(`UPDATE "%s"."%s" SET "DeletedAt"=NOW(), "DeletedBy"=$2 WHERE "Id"=$1 RETURNING "DeletedAt", "DeletedBy"`, schemaName, tableName)
+	after := DeletedNews{News: before}
+	err = tx.QueryRowContext(r.Context(), query, newsID, claims.ID).Scan(&after.DeletedAt, &after.DeletedBy)
+	if err != nil {
+		return err
+	}
+	return recordChange(tx, r, schemaName, tableName, claims, outbox.NewsDeleted, newsID, before, after)
+}
+
+// Odczytanie newsa spoza kosza z blokadą wiersza do końca transakcji
+func lockNews(ctx context.Context, tx *sql.Tx, schemaName, tableName string, newsID int) (News, error) {
+	query := fmt.Sprintf(`SELECT "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL FOR UPDATE`, schemaName, tableName)
+	var news News
+	err := tx.QueryRowContext(ctx, query, newsID).Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility)
+	return news, err
+}
+
+// Sprawdzenie, czy news istnieje poza koszem i jest widoczny dla użytkownika
+func newsExists(ctx context.Context, db *sql.DB, schemaName, tableName string, newsID int, claims *LoginCredentials) (bool, error) {
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL AND %s)`, schemaName, tableName, visibilityFilter(claims))
+	var exists bool
+	err := db.QueryRowContext(ctx, query, newsID).Scan(&exists)
+	return exists, err
+}
+
+// Zapisanie zmiany newsa w dzienniku audytu oraz zdarzenia domenowego w tabeli outbox
+// w ramach transakcji zmiany. Before i after to stan newsa przed i po zmianie (nil, jeśli nie istniał).
+func recordChange(tx *sql.Tx, r *http.Request, schemaName, tableName string, claims *LoginCredentials, action string, newsID int, before, after interface{}) error {
+	entry := actorEntry(r, claims)
+	entry.Action = action
+	entry.NewsID = newsID
+	entry.Before = before
+	entry.After = after
+	return recordEntry(r.Context(), tx, schemaName, tableName, entry)
+}
+
+// Wpis audytu z danymi użytkownika i żądania, uzupełniany o opis zmiany
+func actorEntry(r *http.Request, claims *LoginCredentials) audit.Entry {
+	return audit.Entry{
+		ActorID:   claims.ID,
+		ActorRole: claims.GrantType,
+		ClientIP:  clientIP(r),
+		RequestID: r.Header.Get("X-Request-ID"),
+	}
+}
+
+// Zapisanie wpisu audytu i zdarzenia domenowego (ze stanem newsa po zmianie) w transakcji zmiany
+func recordEntry(ctx context.Context, tx *sql.Tx, schemaName, tableName string, entry audit.Entry) error {
+	err := audit.Record(ctx, tx, schemaName, tableName, entry)
+	if err != nil {
+		return err
+	}
+
+	payload := entry.After
+	if payload == nil {
+		payload = map[string]int{"id": entry.NewsID}
+	}
+	event, err := outbox.NewEvent(entry.Action, entry.NewsID, payload)
+	if err != nil {
+		return err
+	}
+	return outbox.Enqueue(ctx, tx, schemaName, tableName, event)
+}
+
+// Adres klienta. Nagłówek X-Forwarded-For jest brany pod uwagę tylko dla połączeń od zaufanego proxy
+// (server.trustedProxies) - klientem jest wtedy ostatni adres z nagłówka, który nie należy do zaufanego proxy.
+// Wcześniejsze adresy nagłówka może dopisać sam klient, więc nie są brane pod uwagę.
+func clientIP(r *http.Request) string {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	current := settings.Current()
+	if !current.TrustedProxy(client) {
+		return client
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(addr) == nil {
+			// Niepoprawny wpis - ostatni sprawdzony adres jest najdalszym wiarygodnym
+			break
+		}
+		client = addr
+		if !current.TrustedProxy(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Weryfikacja tokenu z nagłówka Authorization i sprawdzenie, czy użytkownik ma jedną z ról
+// (bez podania ról wystarczy dowolny poprawny token). W przypadku braku uprawnień
+// zapisuje odpowiedź z błędem i zwraca false.
+func authorize(w http.ResponseWriter, r *http.Request, roles ...string) (*LoginCredentials, bool) {
+	claims, err := optionalClaims(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		logging.FromContext(r.Context()).Debug("Token error", "error", err)
+		return nil, false
+	}
+	if claims == nil {
+		http.Error(w, "Brak tokena uwierzytelniającego", http.StatusUnauthorized)
+		return nil, false
+	}
+	logger := logging.FromContext(r.Context())
+	logger.Debug("Uwierzytelniono użytkownika", "user", claims.ID, "role", claims.GrantType)
+
+	if len(roles) == 0 {
+		return claims, true
+	}
+	if hasRole(claims, roles...) {
+		return claims, true
+	}
+	logger.Debug("Brak wymaganej roli", "user", claims.ID, "role", claims.GrantType, "required", strings.Join(roles, ","))
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return nil, false
+}
+
+// Odczytanie tokenu dla zapytań, w których uwierzytelnienie jest opcjonalne. Bez nagłówka
+// Authorization użytkownik rozpoznawany jest po certyfikacie klienta (mTLS), a jeśli go nie ma -
+// jest anonimowy (nil). Niepoprawny token jest błędem.
+func optionalClaims(r *http.Request) (*LoginCredentials, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return clientCertClaims(r), nil
+	}
+	return validateToken(strings.TrimPrefix(authHeader, "Bearer "))
+}
+
+// Tożsamość serwisu wywołującego na podstawie zweryfikowanego certyfikatu klienta. Rola przypisywana
+// jest według server.tls.clientRoles, a filia według server.tls.clientTenants - po pełnym podmiocie (DN)
+// lub nazwie CN certyfikatu.
+func clientCertClaims(r *http.Request) *LoginCredentials {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	current := settings.Current()
+	for _, name := range []string{subject.String(), subject.CommonName} {
+		if role, ok := current.ClientRoles[name]; ok && name != "" {
+			return &LoginCredentials{ID: "cert:" + subject.CommonName, GrantType: role, Tenant: current.ClientTenants[name]}
+		}
+	}
+	return nil
+}
+
+// Nazwa filii z tokenu JWT lub certyfikatu klienta, używana do ustalenia filii przez tenant.Resolver.
+// Zwraca false dla żądań anonimowych i z niepoprawnym tokenem.
+func TenantClaim(r *http.Request) (string, bool) {
+	claims, err := optionalClaims(r)
+	if err != nil || claims == nil {
+		return "", false
+	}
+	return claims.Tenant, true
+}
+
+// Schemat filii ustalonej dla żądania, a jeśli filia nie została ustalona - schemat podany przy tworzeniu handlera
+func schemaFor(r *http.Request, schemaName string) string {
+	if t, ok := tenant.FromContext(r.Context()); ok {
+		return t.SchemaName
+	}
+	return schemaName
+}
+
+func hasRole(claims *LoginCredentials, roles ...string) bool {
+	for _, role := range roles {
+		if claims.GrantType == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Funkcja do weryfikacji tokenu JWT i odczytu informacji. Token jest sprawdzany aktualnym kluczem,
+// a następnie poprzednimi kluczami z konfiguracji (wymiana klucza bez unieważniania tokenów).
 func validateToken(tokenString string) (*LoginCredentials, error) {
+	secrets := settings.Current().JWTSecrets
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("brak klucza weryfikacji tokenu")
+	}
+	var err error
+	for _, secret := range secrets {
+		var claims *LoginCredentials
+		if claims, err = validateTokenWithKey(tokenString, secret); err == nil {
+			return claims, nil
+		}
+	}
+	return nil, err
+}
+
+func validateTokenWithKey(tokenString string, secret []byte) (*LoginCredentials, error) {
 	// Parsowanie tokena JWT
 	// Parsowanie i weryfikacja tokenu
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -285,9 +615,7 @@ func validateToken(tokenString string) (*LoginCredentials, error) {
 		}
 
 		// Klucz tajny używany do weryfikacji tokenu (ten sam klucz, który został użyty do podpisania tokenu)
-		secretKey := []byte("MySecretKeyIsSecretSoDoNotTell")
-
-		return secretKey, nil
+		return secret, nil
 	})
 
 	if err != nil {
@@ -302,18 +630,21 @@ func validateToken(tokenString string) (*LoginCredentials, error) {
 			claimsMap[key] = value
 		}
 
-		nameIdentifier := claimsMap["http://schemas.xmlsoap.org/ws/2005/05/identity/claims/nameidentifier"]
-		roleUser := claimsMap["http://schemas.microsoft.com/ws/2008/06/identity/claims/role"]
+		nameIdentifier := claimsMap[nameIdentifierClaim]
+		roleUser := claimsMap[roleClaim]
 		IDstr := fmt.Sprint(nameIdentifier)
 		rolestr := fmt.Sprint(roleUser)
 
 		loginCredentials.ID = IDstr
-		fmt.Println("ID:", loginCredentials.ID)
 		loginCredentials.GrantType = rolestr
-		fmt.Println("Grant Type:", loginCredentials.GrantType)
+
+		// Filia użytkownika jest opcjonalna
+		if tenantClaim, ok := claimsMap["tenant"].(string); ok {
+			loginCredentials.Tenant = tenantClaim
+		}
 
 	} else {
-		fmt.Println("Nieprawidłowy format tokenu")
+		logging.Debug("Nieprawidłowy format tokenu")
 		return nil, err
 	}
 	return &loginCredentials, err
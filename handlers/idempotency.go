@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"news/database"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Nagłówek z kluczem pozwalającym bezpiecznie ponowić żądanie utworzenia
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Maksymalna długość klucza idempotencji
+const maxIdempotencyKeyLength = 255
+
+// Klucz został już użyty z inną treścią żądania
+var errIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+// Odpowiedź zapisana dla klucza idempotencji
+type storedResponse struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Odczytanie klucza z nagłówka Idempotency-Key. Pusty klucz oznacza żądanie bez idempotencji,
+// a false - niepoprawny klucz (odpowiedź z błędem została już zapisana).
+func idempotencyKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, fmt.Sprintf("Idempotency-Key must not be longer than %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+		return "", false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			http.Error(w, "Idempotency-Key must contain only printable ASCII characters", http.StatusBadRequest)
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// Skrót żądania porównywany przy ponowieniu - ten sam klucz z inną treścią jest błędem klienta
+func requestHash(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Zarezerwowanie klucza w transakcji tworzenia. Jeśli klucz został już użyty, zwracana jest zapisana
+// odpowiedź. Równoległe żądanie z tym samym kluczem czeka na blokadzie wiersza do zakończenia
+// pierwszej transakcji, a następnie otrzymuje jej odpowiedź (lub rezerwuje klucz, jeśli została wycofana).
+func reserveIdempotencyKey(ctx context.Context, tx *sql.Tx, schemaName, tableName, requester, key, hash string, ttl time.Duration) (*storedResponse, error) {
+	table := database.IdempotencyTableName(tableName)
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "Requester"=$1 AND "Key"=$2 AND "ExpiresAt" < NOW()`, schemaName, table),
+		requester, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to remove expired idempotency key")
+	}
+
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO "%s"."%s" ("Requester", "Key", "RequestHash", "ExpiresAt")
+		VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second') ON CONFLICT ("Requester", "Key") DO NOTHING`, schemaName, table),
+		requester, key, hash, ttl.Seconds())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to reserve idempotency key")
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+		return nil, err
+	}
+
+	var storedHash string
+	var status sql.NullInt64
+	var contentType sql.NullString
+	var body []byte
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT "RequestHash", "Status", "ContentType", "Response" FROM "%s"."%s" WHERE "Requester"=$1 AND "Key"=$2`, schemaName, table),
+		requester, key).Scan(&storedHash, &status, &contentType, &body)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read idempotency key")
+	}
+	if storedHash != hash {
+		return nil, errIdempotencyKeyReused
+	}
+	return &storedResponse{Status: int(status.Int64), ContentType: contentType.String, Body: body}, nil
+}
+
+// Zapisanie odpowiedzi dla zarezerwowanego klucza w tej samej transakcji, w której tworzony jest news
+func saveIdempotentResponse(ctx context.Context, tx *sql.Tx, schemaName, tableName, requester, key string, response storedResponse) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE "%s"."%s" SET "Status"=$3, "ContentType"=$4, "Response"=$5 WHERE "Requester"=$1 AND "Key"=$2`,
+		schemaName, database.IdempotencyTableName(tableName)),
+		requester, key, response.Status, response.ContentType, response.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to save idempotent response")
+	}
+	return nil
+}
+
+// Odtworzenie zapisanej odpowiedzi z nagłówkiem Idempotent-Replayed
+func writeStoredResponse(w http.ResponseWriter, response storedResponse) {
+	if response.ContentType != "" {
+		w.Header().Set("Content-Type", response.ContentType)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(response.Status)
+	w.Write(response.Body)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test validation of the Idempotency-Key header
+func TestIdempotencyKey(t *testing.T) {
+	cases := []struct {
+		Key   string
+		Valid bool
+	}{
+		{"", true},
+		{"3f2c9a1e-7b44-4d0e-9f61-0c5a8e2d1b7a", true},
+		{"create news #1", true},
+		{strings.Repeat("a", maxIdempotencyKeyLength), true},
+		{strings.Repeat("a", maxIdempotencyKeyLength+1), false},
+		{"key\twith tab", false},
+		{"klucz-żółty", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/News", nil)
+		req.Header.Set(IdempotencyKeyHeader, tc.Key)
+		recorder := httptest.NewRecorder()
+		key, ok := idempotencyKey(recorder, req)
+		assert.Equal(t, tc.Valid, ok, tc.Key)
+		if tc.Valid {
+			assert.Equal(t, tc.Key, key)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		}
+	}
+}
+
+// Test that the request hash depends on the method, path and body
+func TestRequestHash(t *testing.T) {
+	body := []byte(`{"content": "Test"}`)
+	post := httptest.NewRequest(http.MethodPost, "/api/News", nil)
+	hash := requestHash(post, body)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, requestHash(httptest.NewRequest(http.MethodPost, "/api/News?x=1", nil), body))
+	assert.NotEqual(t, hash, requestHash(post, []byte(`{"content": "Inny"}`)))
+	assert.NotEqual(t, hash, requestHash(httptest.NewRequest(http.MethodPut, "/api/News", nil), body))
+}
+
+// Test rejecting an invalid Idempotency-Key before touching the database
+func TestCreateNewsInvalidIdempotencyKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/News", strings.NewReader(`{"content": "Test"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set(IdempotencyKeyHeader, strings.Repeat("k", maxIdempotencyKeyLength+1))
+	recorder := httptest.NewRecorder()
+	CreateNews(nil, "test", "test", time.Hour).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
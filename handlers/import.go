@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"news/audit"
+	"news/logging"
+	"news/outbox"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Pola newsa, do których można przypisać kolumny importowanego pliku
+const (
+	ImportContent     = "content"
+	ImportCreatedDate = "createdDate"
+	ImportLastUpdate  = "lastUpdate"
+	ImportAuthorID    = "authorId"
+	ImportVisibility  = "visibility"
+)
+
+var importFields = []string{ImportContent, ImportCreatedDate, ImportLastUpdate, ImportAuthorID, ImportVisibility}
+
+// Wynik importu wiersza
+const (
+	ImportStatusImported  = "imported"
+	ImportStatusValid     = "valid" // poprawny, ale nie zaimportowany (próba lub błędy w innych wierszach)
+	ImportStatusDuplicate = "duplicate"
+	ImportStatusInvalid   = "invalid"
+)
+
+// Największy rozmiar importowanego pliku przesyłanego przez API
+const maxImportSize = 32 << 20
+
+// Obsługiwane formaty dat. Daty bez strefy czasowej zapisywane są bez zmian, daty ze strefą - w UTC.
+var importDateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// Przekroczenie import.maxRows
+var errImportTooLarge = errors.New("too many rows to import")
+
+// Ustawienia importu
+type ImportOptions struct {
+	Format      string            // csv, json lub ndjson
+	Mapping     map[string]string // nazwa kolumny pliku -> pole newsa; kolumny o nazwach pól przypisywane są bez mapowania
+	Delimiter   rune              // separator kolumn CSV, domyślnie przecinek
+	DryRun      bool              // tylko sprawdzenie pliku, bez zapisu
+	SkipInvalid bool              // import poprawnych wierszy mimo błędów w innych
+	MaxRows     int
+}
+
+// Wiersz pliku - wartości pól newsa po zastosowaniu mapowania kolumn
+type ImportRecord map[string]string
+
+type ImportRowResult struct {
+	Row     int      `json:"row"` // numer rekordu w pliku (bez wiersza nagłówka), od 1
+	Status  string   `json:"status"`
+	ID      int      `json:"id,omitempty"`      // utworzony news lub istniejący news z tą samą treścią
+	Content string   `json:"content,omitempty"` // początek treści ułatwiający odnalezienie wiersza
+	Errors  []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun     bool              `json:"dryRun"`
+	Total      int               `json:"total"`
+	Imported   int               `json:"imported"`
+	Valid      int               `json:"valid"`
+	Duplicates int               `json:"duplicates"`
+	Invalid    int               `json:"invalid"`
+	Rows       []ImportRowResult `json:"rows"`
+}
+
+// Odczytanie mapowania kolumn w postaci "kolumna=pole"
+func ParseImportMapping(pairs []string) (map[string]string, error) {
+	mapping := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		separator := strings.LastIndex(pair, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid column mapping %q, expected column=field", pair)
+		}
+		column, field := strings.TrimSpace(pair[:separator]), importField(pair[separator+1:])
+		if field == "" {
+			return nil, fmt.Errorf("unknown field in column mapping %q, expected one of: %s", pair, strings.Join(importFields, ", "))
+		}
+		mapping[column] = field
+	}
+	return mapping, nil
+}
+
+// Pole newsa o podanej nazwie (bez względu na wielkość liter) lub pusty napis
+func importField(name string) string {
+	name = strings.TrimSpace(name)
+	for _, field := range importFields {
+		if strings.EqualFold(field, name) {
+			return field
+		}
+	}
+	return ""
+}
+
+// Pole newsa przypisane do kolumny pliku lub pusty napis dla kolumn pomijanych
+func mapImportColumn(column string, mapping map[string]string) string {
+	column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	if field, ok := mapping[column]; ok {
+		return field
+	}
+	return importField(column)
+}
+
+// Odczytanie rekordów pliku CSV (z wierszem nagłówka), tablicy JSON lub pliku NDJSON
+func ReadImport(r io.Reader, opts ImportOptions) ([]ImportRecord, error) {
+	var records []ImportRecord
+	add := func(record ImportRecord) error {
+		if opts.MaxRows > 0 && len(records) >= opts.MaxRows {
+			return errImportTooLarge
+		}
+		records = append(records, record)
+		return nil
+	}
+
+	switch opts.Format {
+	case ExportCSV:
+		reader := csv.NewReader(r)
+		if opts.Delimiter != 0 {
+			reader.Comma = opts.Delimiter
+		}
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read CSV header")
+		}
+		fields := make([]string, len(header))
+		for i, column := range header {
+			fields[i] = mapImportColumn(column, opts.Mapping)
+		}
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return records, nil
+			}
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read CSV")
+			}
+			record := make(ImportRecord)
+			for i, value := range row {
+				if i < len(fields) && fields[i] != "" {
+					record[fields[i]] = value
+				}
+			}
+			if err := add(record); err != nil {
+				return nil, err
+			}
+		}
+
+	case ExportJSON, ExportNDJSON:
+		decoder := json.NewDecoder(r)
+		decoder.UseNumber()
+		if opts.Format == ExportJSON {
+			if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+				return nil, errors.New("failed to read JSON, expected an array of objects")
+			}
+		}
+		for decoder.More() {
+			var object map[string]interface{}
+			if err := decoder.Decode(&object); err != nil {
+				return nil, errors.Wrapf(err, "failed to read JSON object %d", len(records)+1)
+			}
+			record := make(ImportRecord)
+			for key, value := range object {
+				field := mapImportColumn(key, opts.Mapping)
+				switch value := value.(type) {
+				case string:
+					record[field] = value
+				case json.Number:
+					record[field] = value.String()
+				}
+			}
+			delete(record, "")
+			if err := add(record); err != nil {
+				return nil, err
+			}
+		}
+		return records, nil
+	}
+	return nil, fmt.Errorf("unknown import format %q", opts.Format)
+}
+
+// News gotowy do zapisania
+type importedNews struct {
+	Content     string
+	CreatedDate time.Time
+	LastUpdate  time.Time
+	AuthorID    string
+	Visibility  string
+}
+
+// Sprawdzenie rekordu. Brak daty utworzenia oznacza datę importu, brak daty zmiany - datę utworzenia,
+// a brak autora - importującego.
+func validateImportRecord(record ImportRecord, defaultAuthor string, now time.Time) (importedNews, []string) {
+	var problems []string
+	news := importedNews{
+		Content:    record[ImportContent],
+		AuthorID:   strings.TrimSpace(record[ImportAuthorID]),
+		Visibility: strings.ToLower(strings.TrimSpace(record[ImportVisibility])),
+	}
+	if strings.TrimSpace(news.Content) == "" {
+		problems = append(problems, "content is empty")
+	}
+	if !utf8.ValidString(news.Content) {
+		problems = append(problems, "content is not valid UTF-8")
+	}
+	if news.AuthorID == "" {
+		news.AuthorID = defaultAuthor
+	}
+	if news.Visibility == "" {
+		news.Visibility = VisibilityPublic
+	}
+	if !isVisibility(news.Visibility) {
+		problems = append(problems, fmt.Sprintf("unknown visibility %q, expected one of: %s", news.Visibility, strings.Join(visibilityLevels, ", ")))
+	}
+
+	news.CreatedDate = now
+	if value := strings.TrimSpace(record[ImportCreatedDate]); value != "" {
+		date, err := parseImportDate(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid createdDate %q", value))
+		} else if date.After(now) {
+			problems = append(problems, fmt.Sprintf("createdDate %q is in the future", value))
+		} else {
+			news.CreatedDate = date
+		}
+	}
+	news.LastUpdate = news.CreatedDate
+	if value := strings.TrimSpace(record[ImportLastUpdate]); value != "" {
+		date, err := parseImportDate(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid lastUpdate %q", value))
+		} else if date.Before(news.CreatedDate) {
+			problems = append(problems, fmt.Sprintf("lastUpdate %q is before createdDate", value))
+		} else {
+			news.LastUpdate = date
+		}
+	}
+	return news, problems
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown date format %q", value)
+}
+
+// Początek treści do raportu
+func contentPreview(content string) string {
+	const length = 60
+	content = strings.Join(strings.Fields(content), " ")
+	if utf8.RuneCountInString(content) <= length {
+		return content
+	}
+	return string([]rune(content)[:length]) + "…"
+}
+
+// Klucz blokady doradczej importu do tabeli newsów
+func importLockKey(schemaName, tableName string) string {
+	return "news-import:" + schemaName + "." + tableName
+}
+
+// Wyszukiwanie newsa o tej samej treści. Warunek na md5 korzysta z indeksu wyrażeniowego, a porównanie
+// pełnej treści wyklucza kolizje skrótów.
+func importDuplicateQuery(schemaName, tableName string) string {
+	return fmt.Sprintf(`SELECT "Id" FROM "%s"."%s" WHERE md5("Content")=md5($1) AND "Content"=$1 ORDER BY "Id" LIMIT 1`, schemaName, tableName)
+}
+
+// Import rekordów w jednej transakcji. Rekordy z treścią identyczną z istniejącym newsem (również w koszu)
+// lub z wcześniejszym rekordem pliku są pomijane. Niepoprawne rekordy blokują import, chyba że ustawiono
+// SkipInvalid. Każdy zaimportowany news ma wpis audytu (z danymi aktora z actor) i zdarzenie news.created.
+func ImportRecords(ctx context.Context, db *sql.DB, schemaName, tableName string, records []ImportRecord, actor audit.Entry, opts ImportOptions) (ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun, Total: len(records), Rows: make([]ImportRowResult, len(records))}
+	now := time.Now().UTC()
+	valid := make([]importedNews, len(records))
+	for i, record := range records {
+		news, problems := validateImportRecord(record, actor.ActorID, now)
+		report.Rows[i] = ImportRowResult{Row: i + 1, Status: ImportStatusValid, Content: contentPreview(news.Content), Errors: problems}
+		if len(problems) > 0 {
+			report.Rows[i].Status = ImportStatusInvalid
+			report.Invalid++
+		}
+		valid[i] = news
+	}
+	write := !opts.DryRun && (report.Invalid == 0 || opts.SkipInvalid)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return report, errors.Wrap(err, "failed to begin import transaction")
+	}
+	defer tx.Rollback()
+
+	// Równoległe importy do tej samej tabeli są szeregowane, aby nie zapisały dwukrotnie tej samej treści
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, importLockKey(schemaName, tableName)); err != nil {
+		return report, errors.Wrap(err, "failed to lock news table for import")
+	}
+
+	duplicateQuery := importDuplicateQuery(schemaName, tableName)
+	insertQuery := fmt.Sprintf(`INSERT INTO "%s"."%s" ("Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility") VALUES ($1, $2, $3, $4, $5) RETURNING "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility"`, schemaName, tableName)
+	seen := make(map[string]int) // treść -> numer rekordu
+	for i := range records {
+		row := &report.Rows[i]
+		if row.Status == ImportStatusInvalid {
+			continue
+		}
+		news := valid[i]
+
+		if first, ok := seen[news.Content]; ok {
+			row.Status = ImportStatusDuplicate
+			row.Errors = []string{fmt.Sprintf("same content as row %d", first)}
+			report.Duplicates++
+			continue
+		}
+		seen[news.Content] = row.Row
+		err := tx.QueryRowContext(ctx, duplicateQuery, news.Content).Scan(&row.ID)
+		if err == nil {
+			row.Status = ImportStatusDuplicate
+			row.Errors = []string{fmt.Sprintf("same content as news %d", row.ID)}
+			report.Duplicates++
+			continue
+		} else if err != sql.ErrNoRows {
+			return report, errors.Wrapf(err, "failed to check row %d for duplicates", row.Row)
+		}
+
+		if !write {
+			report.Valid++
+			continue
+		}
+		// Daty zapisywane są jako tekst, aby kolumna TIMESTAMP otrzymała dokładnie datę z pliku
+		var created News
+		err = tx.QueryRowContext(ctx, insertQuery, news.Content, news.CreatedDate.Format("2006-01-02 15:04:05.999999"),
+			news.AuthorID, news.LastUpdate.Format("2006-01-02 15:04:05.999999"), news.Visibility).
+			Scan(&created.ID, &created.Content, &created.CreatedDate, &created.AuthorID, &created.LastUpdate, &created.Visibility)
+		if err != nil {
+			return report, errors.Wrapf(err, "failed to import row %d", row.Row)
+		}
+		entry := actor
+		entry.Action = outbox.NewsCreated
+		entry.NewsID = created.ID
+		entry.After = created
+		if err := recordEntry(ctx, tx, schemaName, tableName, entry); err != nil {
+			return report, errors.Wrapf(err, "failed to import row %d", row.Row)
+		}
+		row.Status = ImportStatusImported
+		row.ID = created.ID
+		report.Imported++
+	}
+
+	if !write {
+		return report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return report, errors.Wrap(err, "failed to commit import transaction")
+	}
+	return report, nil
+}
+
+// Import newsów z pliku CSV, JSON lub NDJSON przesłanego w treści żądania (np. ogłoszeń ze starego systemu).
+// Format wskazuje parametr format lub nagłówek Content-Type. Parametry: map (powtarzany, "kolumna=pole"),
+// delimiter (separator CSV), dryRun (tylko raport) i skipInvalid (import mimo niepoprawnych wierszy).
+func ImportNews(db *sql.DB, schemaName, tableName string, maxRows int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		opts := ImportOptions{Format: strings.ToLower(query.Get("format")), MaxRows: maxRows}
+		if opts.Format == "" {
+			opts.Format = importFormatFromContentType(r.Header.Get("Content-Type"))
+		}
+		if _, ok := exportFormats[opts.Format]; !ok {
+			http.Error(w, "Unknown format, expected one of: csv, json, ndjson", http.StatusBadRequest)
+			return
+		}
+		var err error
+		opts.Mapping, err = ParseImportMapping(query["map"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Delimiter, err = ParseImportDelimiter(query.Get("delimiter"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for name, target := range map[string]*bool{"dryRun": &opts.DryRun, "skipInvalid": &opts.SkipInvalid} {
+			if value := query.Get(name); value != "" {
+				if *target, err = strconv.ParseBool(value); err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s, expected true or false", name), http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		records, err := ReadImport(http.MaxBytesReader(w, r.Body, maxImportSize), opts)
+		if err == errImportTooLarge {
+			http.Error(w, fmt.Sprintf("Too many rows, at most %d are allowed", maxRows), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("File too large, at most %d bytes are allowed", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		report, err := ImportRecords(r.Context(), db, schemaName, tableName, records, actorEntry(r, claims), opts)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("news import failed", "error", err)
+			http.Error(w, "Błąd podczas importu newsów", http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(report)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status := http.StatusOK
+		if report.Invalid > 0 && !opts.DryRun && !opts.SkipInvalid {
+			// Nic nie zostało zaimportowane z powodu niepoprawnych wierszy
+			status = http.StatusUnprocessableEntity
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(jsonData)
+	}
+}
+
+// Format importu na podstawie nagłówka Content-Type, domyślnie csv
+func importFormatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for format, formatType := range exportFormats {
+		if exportType, _, _ := mime.ParseMediaType(formatType); exportType == mediaType {
+			return format
+		}
+	}
+	return ExportCSV
+}
+
+// Odczytanie separatora kolumn CSV - pojedynczego znaku lub "tab"
+func ParseImportDelimiter(value string) (rune, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if strings.EqualFold(value, "tab") {
+		return '\t', nil
+	}
+	delimiter, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || delimiter == '"' || delimiter == '\r' || delimiter == '\n' {
+		return 0, fmt.Errorf("invalid CSV delimiter %q", value)
+	}
+	return delimiter, nil
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test parsing the column mapping
+func TestParseImportMapping(t *testing.T) {
+	mapping, err := ParseImportMapping([]string{"Treść=content", "Data dodania = createdDate", "a=b=AuthorId"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Treść": ImportContent, "Data dodania": ImportCreatedDate, "a=b": ImportAuthorID}, mapping)
+
+	_, err = ParseImportMapping([]string{"Treść"})
+	assert.Error(t, err)
+	_, err = ParseImportMapping([]string{"Tytuł=title"})
+	assert.Error(t, err)
+}
+
+// Test reading CSV files with mapped columns, a custom delimiter and a byte order mark
+func TestReadImportCSV(t *testing.T) {
+	file := "\ufeffTreść;Data;Autor;Uwagi\n" +
+		"\"Godziny otwarcia; zmiana\";01.05.2024 10:00;7;x\n" +
+		"Zebranie;2024-05-02;;\n"
+	records, err := ReadImport(strings.NewReader(file), ImportOptions{
+		Format:    ExportCSV,
+		Delimiter: ';',
+		Mapping:   map[string]string{"Treść": ImportContent, "Data": ImportCreatedDate, "Autor": ImportAuthorID},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRecord{
+		{ImportContent: "Godziny otwarcia; zmiana", ImportCreatedDate: "01.05.2024 10:00", ImportAuthorID: "7"},
+		{ImportContent: "Zebranie", ImportCreatedDate: "2024-05-02", ImportAuthorID: ""},
+	}, records)
+
+	_, err = ReadImport(strings.NewReader(file), ImportOptions{Format: ExportCSV, Delimiter: ';', MaxRows: 1})
+	assert.Equal(t, errImportTooLarge, err)
+}
+
+// Test reading the JSON and NDJSON files produced by the export
+func TestReadImportJSON(t *testing.T) {
+	file := `[{"id": 3, "content": "Godziny otwarcia", "createdDate": "2024-05-01T10:00:00Z", "authorId": 7, "pinned": true, "reactions": {"like": 1}}]`
+	records, err := ReadImport(strings.NewReader(file), ImportOptions{Format: ExportJSON})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRecord{{ImportContent: "Godziny otwarcia", ImportCreatedDate: "2024-05-01T10:00:00Z", ImportAuthorID: "7"}}, records)
+
+	records, err = ReadImport(strings.NewReader("{\"tekst\": \"A\"}\n{\"tekst\": \"B\"}\n"),
+		ImportOptions{Format: ExportNDJSON, Mapping: map[string]string{"tekst": ImportContent}})
+	assert.NoError(t, err)
+	assert.Equal(t, []ImportRecord{{ImportContent: "A"}, {ImportContent: "B"}}, records)
+
+	_, err = ReadImport(strings.NewReader(`{"content": "A"}`), ImportOptions{Format: ExportJSON})
+	assert.Error(t, err)
+}
+
+// Test validation and defaults of imported rows
+func TestValidateImportRecord(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	news, problems := validateImportRecord(ImportRecord{
+		ImportContent:     "Godziny otwarcia",
+		ImportCreatedDate: "2024-05-01T10:00:00+02:00",
+		ImportLastUpdate:  "02.05.2024",
+		ImportAuthorID:    "7",
+		ImportVisibility:  "Readers",
+	}, "admin", now)
+	assert.Empty(t, problems)
+	assert.Equal(t, importedNews{
+		Content:     "Godziny otwarcia",
+		CreatedDate: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+		LastUpdate:  time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC),
+		AuthorID:    "7",
+		Visibility:  VisibilityReaders,
+	}, news)
+
+	news, problems = validateImportRecord(ImportRecord{ImportContent: "Zebranie"}, "admin", now)
+	assert.Empty(t, problems)
+	assert.Equal(t, importedNews{Content: "Zebranie", CreatedDate: now, LastUpdate: now, AuthorID: "admin", Visibility: VisibilityPublic}, news)
+
+	_, problems = validateImportRecord(ImportRecord{
+		ImportContent:     " ",
+		ImportCreatedDate: "2024-05-03",
+		ImportLastUpdate:  "2024-05-01",
+		ImportVisibility:  "everyone",
+	}, "admin", now)
+	assert.Len(t, problems, 3)
+	_, problems = validateImportRecord(ImportRecord{ImportContent: "A", ImportCreatedDate: "wczoraj"}, "admin", now)
+	assert.Equal(t, []string{`invalid createdDate "wczoraj"`}, problems)
+	_, problems = validateImportRecord(ImportRecord{ImportContent: "A", ImportCreatedDate: "2030-01-01"}, "admin", now)
+	assert.Equal(t, []string{`createdDate "2030-01-01" is in the future`}, problems)
+}
+
+// Test that the import requires an admin token and valid parameters
+func TestImportNewsValidation(t *testing.T) {
+	handler := ImportNews(nil, "test", "test", 10)
+	post := func(target, contentType string) int {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader("content\nA\n"))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/News/import", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	assert.Equal(t, http.StatusBadRequest, post("/api/News/import?format=xlsx", "text/csv"))
+	assert.Equal(t, http.StatusBadRequest, post("/api/News/import?map=Tytuł%3Dtitle", "text/csv"))
+	assert.Equal(t, http.StatusBadRequest, post("/api/News/import?delimiter=%22", "text/csv"))
+	assert.Equal(t, http.StatusBadRequest, post("/api/News/import?dryRun=maybe", "text/csv"))
+	// Treść CSV nie jest poprawną tablicą JSON
+	assert.Equal(t, http.StatusBadRequest, post("/api/News/import", "application/json"))
+
+	// Plik większy niż limit rozmiaru
+	large := strings.Repeat("a", maxImportSize)
+	for contentType, body := range map[string]string{
+		"application/json": `[{"content": "` + large + `"}]`,
+		"text/csv":         "content\n" + large + "\n",
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/News/import", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("Content-Type", contentType)
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code, contentType)
+	}
+}
+
+// Test choosing the import format from the Content-Type header
+func TestImportFormatFromContentType(t *testing.T) {
+	assert.Equal(t, ExportJSON, importFormatFromContentType("application/json; charset=utf-8"))
+	assert.Equal(t, ExportNDJSON, importFormatFromContentType("application/x-ndjson"))
+	assert.Equal(t, ExportCSV, importFormatFromContentType("text/csv"))
+	assert.Equal(t, ExportCSV, importFormatFromContentType(""))
+}
+
+// Test that the duplicate lookup uses the content hash index and the lock key is per table
+func TestImportDuplicateQuery(t *testing.T) {
+	query := importDuplicateQuery("news", "News")
+	assert.Contains(t, query, `FROM "news"."News"`)
+	assert.Contains(t, query, `md5("Content")=md5($1) AND "Content"=$1`)
+
+	assert.Equal(t, importLockKey("news", "News"), importLockKey("news", "News"))
+	assert.NotEqual(t, importLockKey("news", "News"), importLockKey("other", "News"))
+}
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"news/health"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Ścieżka dokumentu OpenAPI, strony Swagger UI i jej plików
+const (
+	OpenAPIPath         = "/api/openapi.json"
+	SwaggerUIPath       = "/api/docs"
+	SwaggerUIAssetsPath = SwaggerUIPath + "/assets/"
+)
+
+const openAPISecurityScheme = "bearerAuth"
+
+// Sposób uwierzytelnienia endpointu
+const (
+	authNone     = iota // bez tokenu (endpointy zdrowia, metryki, dokumentacja)
+	authOptional        // token opcjonalny - decyduje o widoczności wpisów
+	authRequired        // token wymagany, ewentualnie z jedną z ról
+)
+
+// Parametr zapytania (query) endpointu
+type apiParam struct {
+	name        string
+	typ         string // string, integer lub boolean
+	description string
+	enum        []string
+}
+
+// Odpowiedź endpointu. Body nil oznacza odpowiedź tekstową, a contentTypes - inne formaty niż application/json.
+type apiResponse struct {
+	status       int
+	description  string
+	body         interface{}
+	contentTypes []string
+}
+
+// Opis endpointu w dokumencie OpenAPI
+type apiOperation struct {
+	method      string
+	path        string
+	tag         string
+	summary     string
+	auth        int
+	roles       []string
+	params      []apiParam
+	body        interface{} // wartość typu ciała żądania JSON
+	bodyTypes   []string    // typy ciała żądania innego niż JSON (np. pliki importu)
+	responses   []apiResponse
+	description string
+}
+
+// Treść odpowiedzi zapytań zmieniających stan, które zwracają tylko komunikat tekstowy
+func textResponse(description string) apiResponse {
+	return apiResponse{status: http.StatusOK, description: description}
+}
+
+func jsonResponse(status int, description string, body interface{}) apiResponse {
+	return apiResponse{status: status, description: description, body: body}
+}
+
+var (
+	visibilityEnum = []string{VisibilityPublic, VisibilityReaders, VisibilityStaff}
+	limitParam     = apiParam{name: "limit", typ: "integer", description: "maximum number of items"}
+)
+
+// Wszystkie endpointy serwisu. Test w pakiecie main sprawdza, czy każda trasa routera ma tu swój opis.
+func apiOperations(metricsPath string) []apiOperation {
+	exportTypes := make([]string, 0, len(exportFormats))
+	for _, contentType := range exportFormats {
+		exportTypes = append(exportTypes, contentType)
+	}
+	sort.Strings(exportTypes)
+	exportFormatNames := make([]string, 0, len(exportFormats))
+	for format := range exportFormats {
+		exportFormatNames = append(exportFormatNames, format)
+	}
+	sort.Strings(exportFormatNames)
+
+	operations := []apiOperation{
+		// News
+		{method: "GET", path: "/api/News", tag: "News", summary: "List news, pinned first", auth: authOptional,
+			responses: []apiResponse{jsonResponse(http.StatusOK, "News visible to the user", []News{})}},
+		{method: "POST", path: "/api/News", tag: "News", summary: "Create news", auth: authRequired, roles: []string{"admin", "employee"},
+			body: NewNews{},
+			responses: []apiResponse{
+				jsonResponse(http.StatusCreated, "Created news (repeated request with the same Idempotency-Key returns the stored response)", News{}),
+				{status: http.StatusUnprocessableEntity, description: "Idempotency-Key reused with a different body"},
+			}},
+		{method: "GET", path: "/api/News/{id}", tag: "News", summary: "Get news and count a view", auth: authOptional,
+			responses: []apiResponse{jsonResponse(http.StatusOK, "News", News{})}},
+		{method: "PUT", path: "/api/News/{id}", tag: "News", summary: "Update news", auth: authRequired, roles: []string{"admin", "employee"},
+			body:        NewNews{},
+			description: "Omitted visibility keeps the current value.",
+			responses:   []apiResponse{textResponse("News updated")}},
+		{method: "DELETE", path: "/api/News/{id}", tag: "News", summary: "Move news to the trash", auth: authRequired, roles: []string{"admin", "employee"},
+			responses: []apiResponse{textResponse("News moved to the trash")}},
+		{method: "POST", path: "/api/News/bulk", tag: "News", summary: "Create, update and delete news in one request", auth: authRequired, roles: []string{"admin", "employee"},
+			body: BulkRequest{},
+			responses: []apiResponse{
+				jsonResponse(http.StatusOK, "Result of every operation", BulkResponse{}),
+				{status: http.StatusRequestEntityTooLarge, description: "Too many operations (bulk.maxOperations)"},
+			}},
+		{method: "GET", path: "/api/News/export", tag: "News", summary: "Export news", auth: authRequired, roles: []string{"admin"},
+			params: []apiParam{{name: "format", typ: "string", description: "file format (default csv)", enum: exportFormatNames}},
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "Exported news (JSON formats contain News objects)", contentTypes: exportTypes},
+			}},
+		{method: "POST", path: "/api/News/import", tag: "News", summary: "Import news from a file", auth: authRequired, roles: []string{"admin"},
+			params: []apiParam{
+				{name: "format", typ: "string", description: "file format (default from Content-Type)", enum: exportFormatNames},
+				{name: "map", typ: "string", description: "column=field mapping, can be repeated"},
+				{name: "delimiter", typ: "string", description: "CSV delimiter, e.g. ; or tab"},
+				{name: "dryRun", typ: "boolean", description: "only validate the file"},
+				{name: "skipInvalid", typ: "boolean", description: "import valid rows despite invalid ones"},
+			},
+			bodyTypes: exportTypes,
+			responses: []apiResponse{
+				jsonResponse(http.StatusOK, "Import report", ImportReport{}),
+				jsonResponse(http.StatusUnprocessableEntity, "Invalid rows, nothing imported", ImportReport{}),
+				{status: http.StatusRequestEntityTooLarge, description: "File too large or too many rows (import.maxRows)"},
+			}},
+
+		// Kosz
+		{method: "GET", path: "/api/News/trash", tag: "Trash", summary: "List news in the trash", auth: authRequired, roles: []string{"admin"},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Trashed news", []DeletedNews{})}},
+		{method: "POST", path: "/api/News/{id}/restore", tag: "Trash", summary: "Restore news from the trash", auth: authRequired, roles: []string{"admin"},
+			responses: []apiResponse{textResponse("News restored")}},
+
+		// Przypięte i wyróżnione
+		{method: "PUT", path: "/api/News/{id}/pin", tag: "Pinned and featured", summary: "Pin or unpin news", auth: authRequired, roles: []string{"admin"},
+			body:      PinSettings{},
+			responses: []apiResponse{textResponse("Pin changed")}},
+		{method: "PUT", path: "/api/News/{id}/featured", tag: "Pinned and featured", summary: "Feature or unfeature news", auth: authRequired, roles: []string{"admin"},
+			body: struct {
+				Featured *bool `json:"featured"`
+			}{},
+			responses: []apiResponse{textResponse("Featured flag changed")}},
+		{method: "GET", path: "/api/News/featured", tag: "Pinned and featured", summary: "List featured news", auth: authOptional,
+			params:    []apiParam{limitParam},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Featured news", []News{})}},
+
+		// Komentarze
+		{method: "GET", path: "/api/News/{id}/comments", tag: "Comments", summary: "List comments with replies", auth: authOptional,
+			params: []apiParam{
+				{name: "page", typ: "integer", description: "page number, from 1"},
+				{name: "pageSize", typ: "integer", description: "comments per page"},
+			},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Page of comments", CommentsPage{})}},
+		{method: "POST", path: "/api/News/{id}/comments", tag: "Comments", summary: "Add a comment or a reply", auth: authRequired,
+			body:      NewComment{},
+			responses: []apiResponse{jsonResponse(http.StatusCreated, "Created comment", Comment{})}},
+		{method: "PUT", path: "/api/News/{id}/comments/settings", tag: "Comments", summary: "Enable or disable comments", auth: authRequired, roles: []string{"admin", "employee"},
+			body: struct {
+				Enabled *bool `json:"enabled"`
+			}{},
+			responses: []apiResponse{textResponse("Comment settings changed")}},
+		{method: "POST", path: "/api/News/{id}/comments/{commentId}/approve", tag: "Comments", summary: "Approve a comment", auth: authRequired, roles: []string{"admin", "employee"},
+			responses: []apiResponse{textResponse("Comment approved")}},
+		{method: "POST", path: "/api/News/{id}/comments/{commentId}/hide", tag: "Comments", summary: "Hide a comment", auth: authRequired, roles: []string{"admin", "employee"},
+			responses: []apiResponse{textResponse("Comment hidden")}},
+		{method: "DELETE", path: "/api/News/{id}/comments/{commentId}", tag: "Comments", summary: "Delete a comment with its replies", auth: authRequired, roles: []string{"admin", "employee"},
+			responses: []apiResponse{textResponse("Comment deleted")}},
+
+		// Reakcje i nieprzeczytane
+		{method: "PUT", path: "/api/News/{id}/reactions/{reaction}", tag: "Reactions", summary: "Add a reaction", auth: authRequired,
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Reaction counts of the news", map[string]int{})}},
+		{method: "DELETE", path: "/api/News/{id}/reactions/{reaction}", tag: "Reactions", summary: "Remove a reaction", auth: authRequired,
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Reaction counts of the news", map[string]int{})}},
+		{method: "POST", path: "/api/News/{id}/read", tag: "Reactions", summary: "Mark news as read", auth: authRequired,
+			responses: []apiResponse{textResponse("News marked as read")}},
+		{method: "GET", path: "/api/News/unread", tag: "Reactions", summary: "List news not read by the user", auth: authRequired,
+			params: []apiParam{
+				{name: "page", typ: "integer", description: "page number, from 1"},
+				{name: "pageSize", typ: "integer", description: "news per page"},
+			},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Page of unread news", UnreadNews{})}},
+
+		// Statystyki
+		{method: "GET", path: "/api/News/popular", tag: "Statistics", summary: "List the most viewed news", auth: authOptional,
+			params:    []apiParam{{name: "period", typ: "string", description: "one of views.popularPeriods, e.g. day, week or month"}, limitParam},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Popular news", []PopularNews{})}},
+		{method: "GET", path: "/api/stats", tag: "Statistics", summary: "Statistics of authors and views", auth: authRequired, roles: []string{"admin"},
+			params: []apiParam{
+				{name: "from", typ: "string", description: "first day, YYYY-MM-DD (default 30 days ago)"},
+				{name: "to", typ: "string", description: "last day, YYYY-MM-DD (default today)"},
+			},
+			description: "avgTimeToPublishSeconds is the average time from creating a news item to the moment it first became visible " +
+				"to readers (visibility public or readers), taken from the audit log. News created as visible count as 0; " +
+				"news created in the range that have never been visible to readers are not counted.",
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Statistics", Statistics{})}},
+
+		// Administracja
+		{method: "GET", path: "/api/audit", tag: "Administration", summary: "Browse the audit log", auth: authRequired, roles: []string{"admin"},
+			params: []apiParam{
+				{name: "actor", typ: "string", description: "ID of the user"},
+				{name: "action", typ: "string", description: "action, e.g. news.deleted"},
+				{name: "from", typ: "string", description: "RFC3339 time"},
+				{name: "to", typ: "string", description: "RFC3339 time"},
+				limitParam,
+				{name: "format", typ: "string", description: "response format (default json)", enum: []string{"json", "csv"}},
+			},
+			responses: []apiResponse{{status: http.StatusOK, description: "Audit entries", body: []AuditEntry{}, contentTypes: []string{"application/json", "text/csv"}}}},
+		{method: "GET", path: "/api/admin/db/stats", tag: "Administration", summary: "Database connection pool statistics", auth: authRequired, roles: []string{"admin"},
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Pool statistics", PoolStats{})}},
+
+		// Endpointy poza routerem API - bez filii, CORS i limitów żądań
+		{method: "GET", path: "/healthz", tag: "Operations", summary: "Liveness probe", auth: authNone,
+			responses: []apiResponse{jsonResponse(http.StatusOK, "Process is running", health.Report{})}},
+		{method: "GET", path: "/readyz", tag: "Operations", summary: "Readiness probe", auth: authNone,
+			responses: []apiResponse{
+				jsonResponse(http.StatusOK, "Service accepts traffic", health.Report{}),
+				jsonResponse(http.StatusServiceUnavailable, "A check failed or the service is shutting down", health.Report{}),
+			}},
+		{method: "GET", path: OpenAPIPath, tag: "Operations", summary: "This OpenAPI document", auth: authNone,
+			responses: []apiResponse{{status: http.StatusOK, description: "OpenAPI 3 document", contentTypes: []string{"application/json"}}}},
+		{method: "GET", path: SwaggerUIPath, tag: "Operations", summary: "Swagger UI for this document", auth: authNone,
+			responses: []apiResponse{{status: http.StatusOK, description: "HTML page", contentTypes: []string{"text/html"}}}},
+	}
+	if metricsPath != "" {
+		operations = append(operations, apiOperation{method: "GET", path: metricsPath, tag: "Operations", summary: "Prometheus metrics", auth: authNone,
+			responses: []apiResponse{{status: http.StatusOK, description: "Metrics in the Prometheus text format", contentTypes: []string{"text/plain"}}}})
+	}
+	return operations
+}
+
+var pathParamPattern = regexp.MustCompile(`{([^}]+)}`)
+
+// Dokument OpenAPI 3 opisujący endpointy serwisu. Pusty metricsPath oznacza wyłączone metryki.
+func OpenAPIDocument(metricsPath string) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+	for _, op := range apiOperations(metricsPath) {
+		item, ok := paths[op.path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.path] = item
+		}
+		item[strings.ToLower(op.method)] = op.document(schemas)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "News API",
+			"version": "1.0.0",
+			"description": "News of the library. With several tenants configured, API paths can be prefixed with the tenant name (e.g. /north/api/News). " +
+				"Reading endpoints accept an optional token that decides which news are visible.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				openAPISecurityScheme: map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "HS256 token signed with jwt.secret, with the nameidentifier, role and optional tenant claims",
+				},
+			},
+		},
+	}
+}
+
+func (op apiOperation) document(schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{
+		"tags":        []string{op.tag},
+		"summary":     op.summary,
+		"operationId": operationID(op.method, op.path),
+	}
+	if description := op.fullDescription(); description != "" {
+		doc["description"] = description
+	}
+
+	var params []interface{}
+	for _, name := range pathParamPattern.FindAllStringSubmatch(op.path, -1) {
+		params = append(params, map[string]interface{}{
+			"name": name[1], "in": "path", "required": true, "schema": pathParamSchema(name[1]),
+		})
+	}
+	for _, p := range op.params {
+		schema := map[string]interface{}{"type": p.typ}
+		if len(p.enum) > 0 {
+			schema["enum"] = p.enum
+		}
+		params = append(params, map[string]interface{}{
+			"name": p.name, "in": "query", "description": p.description, "schema": schema,
+		})
+	}
+	if op.method == "POST" && op.path == "/api/News" {
+		params = append(params, map[string]interface{}{
+			"name": IdempotencyKeyHeader, "in": "header", "description": "key that makes retries of the request safe",
+			"schema": map[string]interface{}{"type": "string", "maxLength": maxIdempotencyKeyLength},
+		})
+	}
+	if len(params) > 0 {
+		doc["parameters"] = params
+	}
+
+	switch {
+	case op.body != nil:
+		doc["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(op.body), schemas)}},
+		}
+	case len(op.bodyTypes) > 0:
+		content := make(map[string]interface{})
+		for _, contentType := range op.bodyTypes {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+		doc["requestBody"] = map[string]interface{}{"required": true, "content": content}
+	}
+
+	responses := make(map[string]interface{})
+	for _, response := range op.responses {
+		responses[strconv.Itoa(response.status)] = response.document(schemas)
+	}
+	// Odpowiedzi wspólne dla wielu endpointów - zwracane jako tekst przez http.Error
+	if len(pathParamPattern.FindAllString(op.path, -1)) > 0 {
+		addTextResponse(responses, http.StatusBadRequest, "Invalid path parameter or request")
+		addTextResponse(responses, http.StatusNotFound, "News (or comment) not found, not visible to the user or the feature is disabled")
+	} else if op.body != nil || len(op.params) > 0 {
+		addTextResponse(responses, http.StatusBadRequest, "Invalid request")
+	}
+	switch op.auth {
+	case authOptional:
+		addTextResponse(responses, http.StatusUnauthorized, "Invalid token")
+	case authRequired:
+		addTextResponse(responses, http.StatusUnauthorized, "Missing or invalid token")
+		if len(op.roles) > 0 {
+			addTextResponse(responses, http.StatusForbidden, "Role not allowed")
+		}
+	}
+	if strings.HasPrefix(op.path, "/api/") && op.auth != authNone {
+		addTextResponse(responses, http.StatusTooManyRequests, "Rate limit exceeded")
+	}
+	doc["responses"] = responses
+
+	switch op.auth {
+	case authNone:
+		doc["security"] = []interface{}{}
+	case authOptional:
+		doc["security"] = []interface{}{map[string]interface{}{}, map[string]interface{}{openAPISecurityScheme: []string{}}}
+	case authRequired:
+		doc["security"] = []interface{}{map[string]interface{}{openAPISecurityScheme: []string{}}}
+	}
+	return doc
+}
+
+func (op apiOperation) fullDescription() string {
+	var parts []string
+	if op.description != "" {
+		parts = append(parts, op.description)
+	}
+	if len(op.roles) > 0 {
+		parts = append(parts, "Requires the role: "+strings.Join(op.roles, " or ")+".")
+	} else if op.auth == authRequired {
+		parts = append(parts, "Requires a token with any role.")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (response apiResponse) document(schemas map[string]interface{}) map[string]interface{} {
+	doc := map[string]interface{}{"description": response.description}
+	content := make(map[string]interface{})
+	switch {
+	case response.body != nil:
+		schema := schemaOf(reflect.TypeOf(response.body), schemas)
+		content["application/json"] = map[string]interface{}{"schema": schema}
+		for _, contentType := range response.contentTypes {
+			if contentType != "application/json" {
+				content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+			}
+		}
+	case len(response.contentTypes) > 0:
+		for _, contentType := range response.contentTypes {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+	default:
+		content["text/plain"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+	}
+	doc["content"] = content
+	return doc
+}
+
+func addTextResponse(responses map[string]interface{}, status int, description string) {
+	key := strconv.Itoa(status)
+	if _, ok := responses[key]; ok {
+		return
+	}
+	responses[key] = apiResponse{status: status, description: description}.document(nil)
+}
+
+func pathParamSchema(name string) map[string]interface{} {
+	if name == "reaction" {
+		return map[string]interface{}{"type": "string", "enum": reactionTypes}
+	}
+	return map[string]interface{}{"type": "integer"}
+}
+
+// Identyfikator operacji z metody i ścieżki, np. GET /api/News/{id} -> getApiNewsId
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '{' || r == '}' || r == '.' }) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// Schemat JSON typu Go na podstawie tagów json. Nazwane struktury trafiają do components/schemas i są wskazywane przez $ref.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(json.RawMessage{}) {
+		return map[string]interface{}{"description": "any JSON value", "nullable": true}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := schemaOf(t.Elem(), schemas)
+		if _, ok := schema["$ref"]; ok {
+			return map[string]interface{}{"allOf": []interface{}{schema}, "nullable": true}
+		}
+		schema["nullable"] = true
+		return schema
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Int32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; !ok {
+			// Wpis rezerwowany przed opisaniem pól, aby typy rekurencyjne (np. odpowiedzi komentarzy) nie zapętliły generowania
+			schemas[t.Name()] = nil
+			schemas[t.Name()] = structSchema(t, schemas)
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	addStructProperties(t, properties, schemas)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func addStructProperties(t reflect.Type, properties, schemas map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		// Pola osadzonej struktury (np. News w DeletedNews) są w JSON na tym samym poziomie
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructProperties(field.Type, properties, schemas)
+			continue
+		}
+		if field.PkgPath != "" || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema := schemaOf(field.Type, schemas)
+		if name == "visibility" && field.Type.Kind() == reflect.String {
+			schema["enum"] = visibilityEnum
+		}
+		properties[name] = schema
+	}
+}
+
+//go:embed swagger.html
+var swaggerPage string
+
+// Pliki Swagger UI osadzone w binarce (opis w swaggerui/README.md)
+//
+//go:generate sh -c "curl -sSfL https://registry.npmjs.org/swagger-ui-dist/-/swagger-ui-dist-5.11.0.tgz | tar -xzf - -C swaggerui --strip-components=1 package/swagger-ui.css package/swagger-ui-bundle.js"
+//go:embed swaggerui
+var swaggerAssets embed.FS
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerPage))
+
+// GET /api/openapi.json - dokument OpenAPI generowany raz przy starcie serwisu
+func ServeOpenAPI(metricsPath string) http.HandlerFunc {
+	jsonData, err := json.MarshalIndent(OpenAPIDocument(metricsPath), "", "  ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// GET /api/docs - strona Swagger UI wczytująca dokument spod specURL. Skrypty Swagger UI serwowane są
+// z binarki (SwaggerUIAssets), a nie z zewnętrznego CDN.
+func SwaggerUI(specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		swaggerTemplate.Execute(w, struct{ SpecURL, AssetsURL string }{specURL, SwaggerUIAssetsPath})
+	}
+}
+
+// GET /api/docs/assets/ - osadzone pliki Swagger UI
+func SwaggerUIAssets() http.Handler {
+	assets, err := fs.Sub(swaggerAssets, "swaggerui")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(SwaggerUIAssetsPath, http.FileServer(http.FS(assets)))
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the OpenAPI document is valid JSON with resolvable schema references
+func TestOpenAPIDocument(t *testing.T) {
+	data, err := json.Marshal(OpenAPIDocument("/metrics"))
+	require.NoError(t, err)
+
+	var document struct {
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas         map[string]map[string]interface{} `json:"schemas"`
+			SecuritySchemes map[string]map[string]interface{} `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.Unmarshal(data, &document))
+
+	// Schematy typów z pakietu handlers
+	news := document.Components.Schemas["News"]
+	require.NotNil(t, news)
+	properties := news["properties"].(map[string]interface{})
+	for _, field := range []string{"id", "content", "createdDate", "lastUpdate", "authorId", "visibility", "reactions"} {
+		assert.Contains(t, properties, field)
+	}
+	assert.Contains(t, document.Components.Schemas, "NewNews")
+	assert.Contains(t, document.Components.Schemas, "BulkRequest")
+	assert.Contains(t, document.Components.Schemas, "ImportReport")
+
+	// News osadzony w DeletedNews opisany jest polami na tym samym poziomie
+	deleted := document.Components.Schemas["DeletedNews"]["properties"].(map[string]interface{})
+	assert.Contains(t, deleted, "content")
+	assert.Contains(t, deleted, "deletedAt")
+
+	assert.Equal(t, "bearer", document.Components.SecuritySchemes[openAPISecurityScheme]["scheme"])
+
+	// Każde odwołanie $ref wskazuje istniejący schemat
+	for _, ref := range strings.Split(string(data), `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.Index(ref, `"`)]
+		assert.NotNil(t, document.Components.Schemas[name], "schema %s is missing", name)
+	}
+
+	// Metryki wyłączone - brak ścieżki metryk
+	assert.Contains(t, document.Paths, "/metrics")
+	assert.NotContains(t, OpenAPIDocument("")["paths"], "/metrics")
+
+	// Endpoint wymagający roli ma opis błędów uwierzytelnienia, a publiczny - brak wymagań
+	trash := document.Paths["/api/News/trash"]["get"].(map[string]interface{})
+	assert.Contains(t, trash["responses"], "401")
+	assert.Contains(t, trash["responses"], "403")
+	assert.Empty(t, document.Paths["/healthz"]["get"].(map[string]interface{})["security"])
+}
+
+// Test serving the document and the Swagger UI page
+func TestServeOpenAPI(t *testing.T) {
+	rr := httptest.NewRecorder()
+	ServeOpenAPI("")(rr, httptest.NewRequest(http.MethodGet, OpenAPIPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.True(t, json.Valid(rr.Body.Bytes()))
+
+	rr = httptest.NewRecorder()
+	SwaggerUI(OpenAPIPath)(rr, httptest.NewRequest(http.MethodGet, SwaggerUIPath, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rr.Body.String(), "swagger-ui")
+	assert.Contains(t, rr.Body.String(), `openapi.json`)
+	// Skrypty wczytywane są z serwisu, a token nie jest zapisywany w przeglądarce
+	assert.Contains(t, rr.Body.String(), `src="`+SwaggerUIAssetsPath+`swagger-ui-bundle.js"`)
+	assert.NotContains(t, rr.Body.String(), "unpkg.com")
+	assert.NotContains(t, rr.Body.String(), "persistAuthorization")
+}
+
+// Test serving the embedded Swagger UI assets
+func TestSwaggerUIAssets(t *testing.T) {
+	rr := httptest.NewRecorder()
+	SwaggerUIAssets().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, SwaggerUIAssetsPath+"README.md", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "swagger-ui-dist")
+
+	rr = httptest.NewRecorder()
+	SwaggerUIAssets().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, SwaggerUIAssetsPath+"missing.js", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	newsPinChanged       = "news.pin_changed"
+	newsFeatureChanged   = "news.featured_changed"
+	defaultFeaturedLimit = 5
+)
+
+// Warunek przypięcia newsa (alias n) - przypięcie z datą wygaśnięcia przestaje obowiązywać po jej upływie
+const pinnedActive = `(n."Pinned" AND (n."PinnedUntil" IS NULL OR n."PinnedUntil" > NOW()))`
+
+// Kolejność listy newsów: najpierw przypięte, następnie od najnowszych
+const newsListOrder = pinnedActive + ` DESC, n."CreatedDate" DESC, n."Id" DESC`
+
+// Ustawienia przypięcia newsa
+type PinSettings struct {
+	Pinned      *bool   `json:"pinned"`
+	PinnedUntil *string `json:"pinnedUntil"`
+}
+
+// Przypięcie newsa na górze listy (opcjonalnie do podanej daty) lub jego odpięcie
+func PinNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		var settings PinSettings
+		err = json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil || settings.Pinned == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		pinnedUntil, err := parsePinnedUntil(settings, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		query := fmt.Sprintf(`SELECT "Pinned", "PinnedUntil" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL FOR UPDATE`, schemaName, tableName)
+		var before PinSettings
+		err = tx.QueryRowContext(r.Context(), query, newsID).Scan(&before.Pinned, &before.PinnedUntil)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Data przekazywana jest ze strefą czasową, aby była porównywalna z NOW() w kolumnie bez strefy
+		update := fmt.Sprintf(`UPDATE "%s"."%s" SET "Pinned"=$1, "PinnedUntil"=$2::timestamptz WHERE "Id"=$3 RETURNING "Pinned", "PinnedUntil"`, schemaName, tableName)
+		var after PinSettings
+		err = tx.QueryRowContext(r.Context(), update, *settings.Pinned, pinnedUntil, newsID).Scan(&after.Pinned, &after.PinnedUntil)
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, newsPinChanged, newsID, before, after)
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Przypięcie newsa zostało zmienione"))
+	}
+}
+
+// Oznaczenie newsa jako wyróżnionego lub usunięcie wyróżnienia
+func FeatureNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		var settings struct {
+			Featured *bool `json:"featured"`
+		}
+		err = json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil || settings.Featured == nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		query := fmt.Sprintf(`SELECT "Featured" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL FOR UPDATE`, schemaName, tableName)
+		var before bool
+		err = tx.QueryRowContext(r.Context(), query, newsID).Scan(&before)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		update := fmt.Sprintf(`UPDATE "%s"."%s" SET "Featured"=$1 WHERE "Id"=$2`, schemaName, tableName)
+		_, err = tx.ExecContext(r.Context(), update, *settings.Featured, newsID)
+		if err == nil {
+			err = recordChange(tx, r, schemaName, tableName, claims, newsFeatureChanged, newsID,
+				map[string]bool{"featured": before}, map[string]bool{"featured": *settings.Featured})
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Wyróżnienie newsa zostało zmienione"))
+	}
+}
+
+// Lista wyróżnionych newsów, maksymalnie maxCount pozycji (parametr limit może ją zmniejszyć)
+func GetFeaturedNews(db *sql.DB, schemaName, tableName string, maxCount int) http.HandlerFunc {
+	if maxCount <= 0 {
+		maxCount = defaultFeaturedLimit
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := readerClaims(w, r)
+		if !ok {
+			return
+		}
+		limit := maxCount
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > maxCount {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxCount), http.StatusBadRequest)
+				return
+			}
+		}
+
+		query := newsWithReactionsQuery(schemaName, tableName, `n."Featured" AND n."DeletedAt" IS NULL AND `+visibilityFilter(claims)+` ORDER BY `+newsListOrder+` LIMIT $1`)
+		rows, err := db.QueryContext(r.Context(), query, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		newsList := make([]News, 0)
+		for rows.Next() {
+			news, err := scanNewsWithReactions(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			newsList = append(newsList, news)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(newsList)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// Data wygaśnięcia przypięcia w formacie RFC3339 - dozwolona tylko przy przypinaniu i musi być w przyszłości
+func parsePinnedUntil(settings PinSettings, now time.Time) (*time.Time, error) {
+	if settings.PinnedUntil == nil || *settings.PinnedUntil == "" {
+		return nil, nil
+	}
+	if !*settings.Pinned {
+		return nil, fmt.Errorf("pinnedUntil can only be set when pinning news")
+	}
+	until, err := time.Parse(time.RFC3339, *settings.PinnedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pinnedUntil date, expected RFC3339")
+	}
+	if !until.After(now) {
+		return nil, fmt.Errorf("pinnedUntil must be in the future")
+	}
+	return &until, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test validation of the pin expiry date
+func TestParsePinnedUntil(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	pinned, unpinned := true, false
+	future, past, invalid := "2024-05-06T08:00:00Z", "2024-04-30T08:00:00Z", "next monday"
+
+	until, err := parsePinnedUntil(PinSettings{Pinned: &pinned}, now)
+	assert.NoError(t, err)
+	assert.Nil(t, until)
+
+	until, err = parsePinnedUntil(PinSettings{Pinned: &pinned, PinnedUntil: &future}, now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 6, 8, 0, 0, 0, time.UTC), until.UTC())
+
+	_, err = parsePinnedUntil(PinSettings{Pinned: &pinned, PinnedUntil: &past}, now)
+	assert.Error(t, err)
+	_, err = parsePinnedUntil(PinSettings{Pinned: &pinned, PinnedUntil: &invalid}, now)
+	assert.Error(t, err)
+	_, err = parsePinnedUntil(PinSettings{Pinned: &unpinned, PinnedUntil: &future}, now)
+	assert.Error(t, err)
+}
+
+// Test that pinning requires an admin token and a valid body
+func TestPinNewsValidation(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/News/{id}/pin", PinNews(nil, "test", "test")).Methods("PUT")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/News/1/pin", strings.NewReader(`{"pinned": true}`))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/News/1/pin", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/News/1/pin", strings.NewReader(`{"pinned": true, "pinnedUntil": "2000-01-01T00:00:00Z"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// Test rejecting a featured list limit above the configured maximum
+func TestGetFeaturedNewsLimit(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/News/featured?limit=6", nil)
+	recorder := httptest.NewRecorder()
+	GetFeaturedNews(nil, "test", "test", 5).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,12 @@
+package handlers
+
+import "net/http"
+
+// Klucz limitu żądań: Id użytkownika z poprawnego tokenu lub certyfikatu klienta, a dla żądań
+// anonimowych i z niepoprawnym tokenem - adres IP klienta
+func RateLimitKey(r *http.Request) string {
+	if claims, err := optionalClaims(r); err == nil && claims != nil {
+		return "user:" + claims.ID
+	}
+	return "ip:" + clientIP(r)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test keying rate limits by user for valid tokens and by client IP otherwise
+func TestRateLimitKey(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/News", nil)
+	req.RemoteAddr = "10.0.0.7:51234"
+	assert.Equal(t, "ip:10.0.0.7", RateLimitKey(req))
+
+	// Losowy X-Forwarded-For od niezaufanego połączenia nie tworzy nowego klucza (i nowego kubełka)
+	for _, spoofed := range []string{"198.51.100.1", "198.51.100.2, 203.0.113.9"} {
+		req.Header.Set("X-Forwarded-For", spoofed)
+		assert.Equal(t, "ip:10.0.0.7", RateLimitKey(req))
+	}
+	req.Header.Del("X-Forwarded-For")
+
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	claims, err := validateToken(adminToken)
+	assert.NoError(t, err)
+	assert.Equal(t, "user:"+claims.ID, RateLimitKey(req))
+
+	// Niepoprawny token nie pozwala ominąć limitu adresu IP
+	req.Header.Set("Authorization", "Bearer invalid")
+	assert.Equal(t, "ip:10.0.0.7", RateLimitKey(req))
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/database"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Dostępne rodzaje reakcji
+const (
+	ReactionLike   = "like"
+	ReactionUseful = "useful"
+)
+
+var reactionTypes = []string{ReactionLike, ReactionUseful}
+
+const (
+	defaultUnreadPageSize = 20
+	maxUnreadPageSize     = 100
+)
+
+// Strona nieprzeczytanych newsów zalogowanego użytkownika. Count to liczba wszystkich nieprzeczytanych newsów.
+type UnreadNews struct {
+	Count    int    `json:"count"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	Items    []News `json:"items"`
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Zapytanie o newsy (alias n) wraz z przypięciem, wyróżnieniem i liczbą reakcji każdego rodzaju w postaci obiektu JSON
+func newsWithReactionsQuery(schemaName, tableName, where string) string {
+	return fmt.Sprintf(`SELECT n."Id", n."Content", n."CreatedDate", n."AuthorId", n."LastUpdate", n."Visibility",
+		%[5]s, n."PinnedUntil", n."Featured",
+		COALESCE((SELECT json_object_agg(c."Reaction", c."Count") FROM (
+			SELECT "Reaction", COUNT(*) AS "Count" FROM "%[1]s"."%[3]s" WHERE "NewsId"=n."Id" GROUP BY "Reaction"
+		) c), '{}')
+		FROM "%[1]s"."%[2]s" n WHERE %[4]s`,
+		schemaName, tableName, database.ReactionsTableName(tableName), where, pinnedActive)
+}
+
+func scanNewsWithReactions(row scanner) (News, error) {
+	var news News
+	var reactions []byte
+	err := row.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility,
+		&news.Pinned, &news.PinnedUntil, &news.Featured, &reactions)
+	if err != nil {
+		return news, err
+	}
+	news.Reactions, err = reactionCounts(reactions)
+	return news, err
+}
+
+// Liczba reakcji każdego dostępnego rodzaju, również tych, których jeszcze nie ma
+func reactionCounts(data []byte) (map[string]int, error) {
+	counts := make(map[string]int, len(reactionTypes))
+	for _, reaction := range reactionTypes {
+		counts[reaction] = 0
+	}
+	if len(data) == 0 {
+		return counts, nil
+	}
+	if err := json.Unmarshal(data, &counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func isReactionType(reaction string) bool {
+	for _, known := range reactionTypes {
+		if reaction == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Dodanie reakcji zalogowanego użytkownika do newsa
+func AddReaction(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r)
+		if !ok {
+			return
+		}
+		newsID, reaction, ok := reactionPathParams(w, r)
+		if !ok {
+			return
+		}
+
+		// Reakcja jest zapisywana tylko dla newsa spoza kosza widocznego dla użytkownika, ponowne dodanie nic nie zmienia
+		query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("NewsId", "UserId", "Reaction", "CreatedDate")
+			SELECT "Id", $2, $3, NOW() FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL AND %s
+			ON CONFLICT DO NOTHING`,
+			schemaName, database.ReactionsTableName(tableName), schemaName, tableName, visibilityFilter(claims))
+		_, err := db.ExecContext(r.Context(), query, newsID, claims.ID, reaction)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeReactionCounts(r.Context(), w, db, schemaName, tableName, newsID, claims)
+	}
+}
+
+// Usunięcie reakcji zalogowanego użytkownika
+func RemoveReaction(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r)
+		if !ok {
+			return
+		}
+		newsID, reaction, ok := reactionPathParams(w, r)
+		if !ok {
+			return
+		}
+
+		query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "NewsId"=$1 AND "UserId"=$2 AND "Reaction"=$3`,
+			schemaName, database.ReactionsTableName(tableName))
+		_, err := db.ExecContext(r.Context(), query, newsID, claims.ID, reaction)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeReactionCounts(r.Context(), w, db, schemaName, tableName, newsID, claims)
+	}
+}
+
+// Oznaczenie newsa jako przeczytanego przez zalogowanego użytkownika
+func MarkAsRead(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r)
+		if !ok {
+			return
+		}
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("NewsId", "UserId", "ReadDate")
+			SELECT "Id", $2, NOW() FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NULL AND %s
+			ON CONFLICT DO NOTHING`,
+			schemaName, database.ReadsTableName(tableName), schemaName, tableName, visibilityFilter(claims))
+		result, err := db.ExecContext(r.Context(), query, newsID, claims.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Brak wstawionego wiersza oznacza nieistniejący news albo news już przeczytany
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected == 0 {
+			exists, err := newsExists(r.Context(), db, schemaName, tableName, newsID, claims)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !exists {
+				http.Error(w, "News not found", http.StatusNotFound)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("News został oznaczony jako przeczytany"))
+	}
+}
+
+// Strona newsów, których zalogowany użytkownik jeszcze nie przeczytał (parametry page i pageSize jak dla komentarzy)
+func GetUnreadNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		page, pageSize, err := parsePagination(r, defaultUnreadPageSize, maxUnreadPageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		claims, ok := authorize(w, r)
+		if !ok {
+			return
+		}
+
+		unread := UnreadNews{Page: page, PageSize: pageSize, Items: make([]News, 0)}
+		filter := fmt.Sprintf(`n."DeletedAt" IS NULL AND %s AND NOT EXISTS (SELECT 1 FROM "%s"."%s" rd WHERE rd."NewsId"=n."Id" AND rd."UserId"=$1)`,
+			visibilityFilter(claims), schemaName, database.ReadsTableName(tableName))
+
+		countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM "%s"."%s" n WHERE %s`, schemaName, tableName, filter)
+		if err := db.QueryRowContext(r.Context(), countQuery, claims.ID).Scan(&unread.Count); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		where := filter + ` ORDER BY n."CreatedDate" DESC, n."Id" DESC LIMIT $2 OFFSET $3`
+		rows, err := db.QueryContext(r.Context(), newsWithReactionsQuery(schemaName, tableName, where), claims.ID, pageSize, (page-1)*pageSize)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			news, err := scanNewsWithReactions(rows)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			unread.Items = append(unread.Items, news)
+		}
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(unread)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+func reactionPathParams(w http.ResponseWriter, r *http.Request) (int, string, bool) {
+	vars := mux.Vars(r)
+	newsID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid news ID", http.StatusBadRequest)
+		return 0, "", false
+	}
+	reaction := vars["reaction"]
+	if !isReactionType(reaction) {
+		http.Error(w, "Unknown reaction", http.StatusBadRequest)
+		return 0, "", false
+	}
+	return newsID, reaction, true
+}
+
+// Zwrócenie aktualnej liczby reakcji newsa lub 404, jeśli news nie istnieje albo nie jest widoczny dla użytkownika
+func writeReactionCounts(ctx context.Context, w http.ResponseWriter, db *sql.DB, schemaName, tableName string, newsID int, claims *LoginCredentials) {
+	query := newsWithReactionsQuery(schemaName, tableName, `n."Id"=$1 AND n."DeletedAt" IS NULL AND `+visibilityFilter(claims))
+	news, err := scanNewsWithReactions(db.QueryRowContext(ctx, query, newsID))
+	if err == sql.ErrNoRows {
+		http.Error(w, "News not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	jsonData, err := json.Marshal(news.Reactions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonData)
+}
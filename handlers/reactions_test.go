@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that every reaction type is present in aggregated counts
+func TestReactionCounts(t *testing.T) {
+	counts, err := reactionCounts([]byte(`{"like": 3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{ReactionLike: 3, ReactionUseful: 0}, counts)
+
+	counts, err = reactionCounts(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{ReactionLike: 0, ReactionUseful: 0}, counts)
+}
+
+// Test rejecting unknown reaction types before touching the database
+func TestAddReactionUnknownType(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/api/News/{id}/reactions/{reaction}", AddReaction(nil, "test", "test")).Methods("PUT")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/News/1/reactions/angry", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/News/1/reactions/like", nil)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test reactions and read tracking for api/News/{id}/reactions and api/News/unread endpoints
+func TestReactionsAndUnread(t *testing.T) {
+	db, testConfig, err := RunTestingServer()
+	if err != nil {
+		t.Fatal("cannot run server on port 8080:", err)
+	}
+	defer db.Close()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/News/unread", GetUnreadNews(db, testConfig.SchemaName, testConfig.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/{id}/reactions/{reaction}", AddReaction(db, testConfig.SchemaName, testConfig.TableName)).Methods("PUT")
+	router.HandleFunc("/api/News/{id}/read", MarkAsRead(db, testConfig.SchemaName, testConfig.TableName)).Methods("POST")
+
+	//podwójne dodanie reakcji liczone jest raz
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPut, "/api/News/1/reactions/like", nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/News/1/read", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	//przeczytany news nie pojawia się na liście nieprzeczytanych
+	req = httptest.NewRequest(http.MethodGet, "/api/News/unread", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var unread UnreadNews
+	json.Unmarshal(recorder.Body.Bytes(), &unread)
+	for _, news := range unread.Items {
+		assert.NotEqual(t, 1, news.ID)
+	}
+	assert.Equal(t, 1, unread.Page)
+	assert.Equal(t, 20, unread.PageSize)
+
+	//strona zawiera najwyżej pageSize wpisów, a count - liczbę wszystkich nieprzeczytanych
+	req = httptest.NewRequest(http.MethodGet, "/api/News/unread?page=1&pageSize=1", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var firstPage UnreadNews
+	json.Unmarshal(recorder.Body.Bytes(), &firstPage)
+	assert.LessOrEqual(t, len(firstPage.Items), 1)
+	assert.Equal(t, unread.Count, firstPage.Count)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/News/999/read", nil)
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+// Test rejecting invalid paging parameters of the unread news list
+func TestUnreadNewsPagination(t *testing.T) {
+	handler := GetUnreadNews(nil, "news", "News")
+	for _, query := range []string{"page=0", "pageSize=101", "pageSize=x"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/News/unread?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
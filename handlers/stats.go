@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/config"
+	"news/database"
+	"news/outbox"
+	"news/settings"
+	"news/views"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// News wraz z liczbą wyświetleń w wybranym okresie
+type PopularNews struct {
+	News
+	Views int64 `json:"views"`
+}
+
+// Statystyki dla administratorów
+type Statistics struct {
+	From                    string        `json:"from"`
+	To                      string        `json:"to"`
+	Authors                 []AuthorStats `json:"authors"`
+	ViewsOverTime           []DailyViews  `json:"viewsOverTime"`
+	TotalViews              int64         `json:"totalViews"`
+	TopNews                 []PopularNews `json:"topNews"`
+	AvgTimeToPublishSeconds *float64      `json:"avgTimeToPublishSeconds"` // null, jeśli żaden news nie był jeszcze widoczny dla czytelników
+}
+
+type AuthorStats struct {
+	AuthorID                string   `json:"authorId"`
+	NewsCount               int      `json:"newsCount"`
+	Views                   int64    `json:"views"`
+	AvgTimeToPublishSeconds *float64 `json:"avgTimeToPublishSeconds"`
+}
+
+type DailyViews struct {
+	Day   string `json:"day"`
+	Views int64  `json:"views"`
+}
+
+const statsDateLayout = "2006-01-02"
+
+// Okresy listy popularnych newsów używane, gdy konfiguracja ich nie określa
+var defaultPopularPeriods = map[string]int{"day": 1, "week": 7, "month": 30}
+
+const defaultPopularMaxCount = 20
+
+// Zliczanie wyświetleń newsa zwróconego z powodzeniem przez handler GetNewsByID
+func CountViews(counter *views.Counter, schemaName string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+		if recorder.status != http.StatusOK || !settings.Current().Enabled(config.FeatureViewCounting) {
+			return
+		}
+		newsID, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			return
+		}
+
+		// Zalogowani użytkownicy rozróżniani są po Id z tokenu, pozostali po adresie IP
+		client := "ip:" + clientIP(r)
+		if claims, err := optionalClaims(r); err == nil && claims != nil {
+			client = "user:" + claims.ID
+		}
+		counter.Record(schemaFor(r, schemaName), newsID, client)
+	}
+}
+
+// Najczęściej wyświetlane newsy w jednym ze skonfigurowanych okresów (parametr period)
+func GetPopularNews(db *sql.DB, schemaName, tableName string, periods map[string]int, maxCount int) http.HandlerFunc {
+	if len(periods) == 0 {
+		periods = defaultPopularPeriods
+	}
+	if maxCount <= 0 {
+		maxCount = defaultPopularMaxCount
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := readerClaims(w, r)
+		if !ok {
+			return
+		}
+		period := r.URL.Query().Get("period")
+		if period == "" {
+			period = defaultPeriod(periods)
+		}
+		days, ok := periods[period]
+		if !ok || days <= 0 {
+			http.Error(w, "Unknown period, expected one of: "+strings.Join(periodNames(periods), ", "), http.StatusBadRequest)
+			return
+		}
+		limit := maxCount
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit <= 0 || limit > maxCount {
+				http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxCount), http.StatusBadRequest)
+				return
+			}
+		}
+
+		since := time.Now().AddDate(0, 0, -(days - 1)).Format(statsDateLayout)
+		popular, err := queryPopularNews(r.Context(), db, schemaName, tableName, since, "", limit, claims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(popular)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// Statystyki publikacji i wyświetleń w zakresie dat from-to (domyślnie ostatnie 30 dni)
+func GetStatistics(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+
+		from, to, err := statsRange(r, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		stats := Statistics{
+			From:          from.Format(statsDateLayout),
+			To:            to.Format(statsDateLayout),
+			Authors:       make([]AuthorStats, 0),
+			ViewsOverTime: make([]DailyViews, 0),
+		}
+		viewsTable := database.ViewsTableName(tableName)
+
+		// Liczba newsów opublikowanych przez każdego autora oraz wyświetlenia jego newsów w zakresie dat
+		authorsQuery := fmt.Sprintf(`SELECT a."AuthorId", a."NewsCount", COALESCE(v."Views", 0) FROM (
+				SELECT "AuthorId", COUNT(*) AS "NewsCount" FROM "%[1]s"."%[2]s"
+				WHERE "DeletedAt" IS NULL AND "CreatedDate" >= $1 AND "CreatedDate" < $2::date + 1 GROUP BY "AuthorId"
+			) a LEFT JOIN (
+				SELECT n."AuthorId", SUM(vw."Views") AS "Views" FROM "%[1]s"."%[3]s" vw JOIN "%[1]s"."%[2]s" n ON n."Id" = vw."NewsId"
+				WHERE vw."Day" BETWEEN $1 AND $2 GROUP BY n."AuthorId"
+			) v ON v."AuthorId" = a."AuthorId" ORDER BY a."NewsCount" DESC, a."AuthorId"`,
+			schemaName, tableName, viewsTable)
+		rows, err := db.QueryContext(r.Context(), authorsQuery, stats.From, stats.To)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for rows.Next() {
+			var author AuthorStats
+			if err := rows.Scan(&author.AuthorID, &author.NewsCount, &author.Views); err != nil {
+				rows.Close()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			stats.Authors = append(stats.Authors, author)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Wyświetlenia wszystkich newsów dzień po dniu
+		viewsQuery := fmt.Sprintf(`SELECT to_char("Day", 'YYYY-MM-DD'), SUM("Views") FROM "%s"."%s" WHERE "Day" BETWEEN $1 AND $2 GROUP BY "Day" ORDER BY "Day"`,
+			schemaName, viewsTable)
+		rows, err = db.QueryContext(r.Context(), viewsQuery, stats.From, stats.To)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for rows.Next() {
+			var daily DailyViews
+			if err := rows.Scan(&daily.Day, &daily.Views); err != nil {
+				rows.Close()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			stats.TotalViews += daily.Views
+			stats.ViewsOverTime = append(stats.ViewsOverTime, daily)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// Średni czas do udostępnienia czytelnikom - łącznie (wiersz z grouping = 1) i dla każdego autora
+		rows, err = db.QueryContext(r.Context(), timeToPublishQuery(schemaName, tableName), stats.From, stats.To,
+			outbox.NewsCreated, outbox.NewsUpdated, VisibilityPublic, VisibilityReaders)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		byAuthor := make(map[string]float64)
+		for rows.Next() {
+			var authorID sql.NullString
+			var total bool
+			var seconds sql.NullFloat64 // łączny wiersz bez opublikowanych newsów ma średnią NULL
+			if err := rows.Scan(&authorID, &total, &seconds); err != nil {
+				rows.Close()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			switch {
+			case !seconds.Valid:
+			case total:
+				stats.AvgTimeToPublishSeconds = &seconds.Float64
+			default:
+				byAuthor[authorID.String] = seconds.Float64
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for i := range stats.Authors {
+			if seconds, ok := byAuthor[stats.Authors[i].AuthorID]; ok {
+				stats.Authors[i].AvgTimeToPublishSeconds = &seconds
+			}
+		}
+
+		stats.TopNews, err = queryPopularNews(r.Context(), db, schemaName, tableName, stats.From, stats.To, 10, claims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		jsonData, err := json.Marshal(stats)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+// Najczęściej wyświetlane newsy widoczne dla użytkownika w dniach od since do until włącznie (pusty until - do dziś)
+func queryPopularNews(ctx context.Context, db *sql.DB, schemaName, tableName, since, until string, limit int, claims *LoginCredentials) ([]PopularNews, error) {
+	query, args := popularNewsQuery(schemaName, tableName, since, until, limit, claims)
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	popular := make([]PopularNews, 0)
+	for rows.Next() {
+		var news PopularNews
+		err := rows.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility, &news.Views)
+		if err != nil {
+			return nil, err
+		}
+		popular = append(popular, news)
+	}
+	return popular, rows.Err()
+}
+
+// Średni czas od utworzenia newsa do chwili, w której po raz pierwszy stał się widoczny dla czytelników
+// (widoczność public lub readers). Chwilę tę wskazuje najwcześniejszy wpis dziennika audytu z taką widocznością
+// (dla utworzenia - data utworzenia, więc news utworzony jako widoczny ma czas 0). News bez wpisów w dzienniku
+// (np. sprzed jego wprowadzenia), który jest widoczny, traktowany jest jak widoczny od utworzenia.
+// Liczone są newsy utworzone w zakresie dat, które były już widoczne dla czytelników.
+func timeToPublishQuery(schemaName, tableName string) string {
+	return fmt.Sprintf(`SELECT n."AuthorId", GROUPING(n."AuthorId") = 1, AVG(EXTRACT(EPOCH FROM p."VisibleAt" - n."CreatedDate"::timestamptz))::double precision
+		FROM "%[1]s"."%[2]s" n JOIN LATERAL (
+			SELECT COALESCE(
+				(SELECT MIN(CASE WHEN a."Action" = $3 THEN n."CreatedDate"::timestamptz ELSE a."CreatedDate" END)
+					FROM "%[1]s"."%[3]s" a
+					WHERE a."NewsId" = n."Id" AND a."Action" IN ($3, $4) AND a."After"->>'visibility' IN ($5, $6)),
+				CASE WHEN n."Visibility" IN ($5, $6) AND NOT EXISTS (SELECT 1 FROM "%[1]s"."%[3]s" a WHERE a."NewsId" = n."Id")
+					THEN n."CreatedDate"::timestamptz END
+			) AS "VisibleAt"
+		) p ON p."VisibleAt" IS NOT NULL
+		WHERE n."DeletedAt" IS NULL AND n."CreatedDate" >= $1 AND n."CreatedDate" < $2::date + 1
+		GROUP BY GROUPING SETS ((n."AuthorId"), ())`,
+		schemaName, tableName, database.AuditTableName(tableName))
+}
+
+func popularNewsQuery(schemaName, tableName, since, until string, limit int, claims *LoginCredentials) (string, []interface{}) {
+	where := `v."Day" >= $1`
+	args := []interface{}{since}
+	if until != "" {
+		where += ` AND v."Day" <= $2`
+		args = append(args, until)
+	}
+	args = append(args, limit)
+	query := fmt.Sprintf(`SELECT n."Id", n."Content", n."CreatedDate", n."AuthorId", n."LastUpdate", n."Visibility", SUM(v."Views") AS "Views"
+		FROM "%[1]s"."%[3]s" v JOIN "%[1]s"."%[2]s" n ON n."Id" = v."NewsId"
+		WHERE %[4]s AND n."DeletedAt" IS NULL AND %[5]s
+		GROUP BY n."Id" ORDER BY "Views" DESC, n."Id" DESC LIMIT $%[6]d`,
+		schemaName, tableName, database.ViewsTableName(tableName), where, visibilityFilter(claims), len(args))
+	return query, args
+}
+
+// Zakres dat statystyk z parametrów from i to (RRRR-MM-DD), domyślnie ostatnie 30 dni
+func statsRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	from := now.AddDate(0, 0, -29)
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		from, err = time.Parse(statsDateLayout, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from date, expected YYYY-MM-DD")
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		to, err = time.Parse(statsDateLayout, value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid to date, expected YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, fmt.Errorf("from date must not be after to date")
+	}
+	return from, to, nil
+}
+
+// Domyślny okres listy popularnych newsów - "week", a jeśli go nie ma, najkrótszy ze skonfigurowanych
+func defaultPeriod(periods map[string]int) string {
+	if _, ok := periods["week"]; ok {
+		return "week"
+	}
+	names := periodNames(periods)
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
+
+// Nazwy okresów posortowane według liczby dni
+func periodNames(periods map[string]int) []string {
+	names := make([]string, 0, len(periods))
+	for name := range periods {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if periods[names[i]] != periods[names[j]] {
+			return periods[names[i]] < periods[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// Zapamiętanie kodu odpowiedzi zapisanego przez handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
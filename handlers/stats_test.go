@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test default and explicit statistics date ranges
+func TestStatsRange(t *testing.T) {
+	now := time.Date(2024, 5, 31, 15, 0, 0, 0, time.UTC)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stats", nil)
+	from, to, err := statsRange(req, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-05-02", from.Format(statsDateLayout))
+	assert.Equal(t, "2024-05-31", to.Format(statsDateLayout))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/stats?from=2024-01-01&to=2024-01-31", nil)
+	from, to, err = statsRange(req, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-01-01", from.Format(statsDateLayout))
+	assert.Equal(t, "2024-01-31", to.Format(statsDateLayout))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/stats?from=2024-02-01&to=2024-01-01", nil)
+	_, _, err = statsRange(req, now)
+	assert.Error(t, err)
+}
+
+// Test ordering of configured popularity periods
+func TestPeriodNames(t *testing.T) {
+	periods := map[string]int{"month": 30, "day": 1, "quarter": 90}
+	assert.Equal(t, []string{"day", "month", "quarter"}, periodNames(periods))
+	assert.Equal(t, "day", defaultPeriod(periods))
+	assert.Equal(t, "week", defaultPeriod(defaultPopularPeriods))
+}
+
+// Test rejecting unknown popularity periods
+func TestGetPopularNewsUnknownPeriod(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/News/popular?period=year", nil)
+	recorder := httptest.NewRecorder()
+	GetPopularNews(nil, "test", "test", nil, 0).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// Test that top news of the statistics are bounded by the whole date range
+func TestPopularNewsQuery(t *testing.T) {
+	query, args := popularNewsQuery("test", "News", "2024-01-01", "2024-01-31", 10, nil)
+	assert.Contains(t, query, `v."Day" >= $1 AND v."Day" <= $2`)
+	assert.True(t, strings.HasSuffix(query, "LIMIT $3"))
+	assert.Equal(t, []interface{}{"2024-01-01", "2024-01-31", 10}, args)
+
+	// Lista popularnych newsów liczy wyświetlenia do dziś
+	query, args = popularNewsQuery("test", "News", "2024-01-01", "", 5, nil)
+	assert.NotContains(t, query, "$3")
+	assert.True(t, strings.HasSuffix(query, "LIMIT $2"))
+	assert.Equal(t, []interface{}{"2024-01-01", 5}, args)
+}
+
+// Test the average time-to-publish query: drafts are published by the first change that shows them to readers
+func TestTimeToPublishQuery(t *testing.T) {
+	query := timeToPublishQuery("test", "News")
+	assert.Contains(t, query, `FROM "test"."News_audit" a`)
+	assert.Contains(t, query, `a."After"->>'visibility' IN ($5, $6)`)
+	assert.Contains(t, query, `n."CreatedDate" >= $1 AND n."CreatedDate" < $2::date + 1`)
+	assert.Contains(t, query, "GROUPING SETS")
+	// Widoczny news bez historii w dzienniku liczony jest jako widoczny od utworzenia
+	assert.Contains(t, query, `CASE WHEN n."Visibility" IN ($5, $6) AND NOT EXISTS`)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"news/database"
+	"news/tenant"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that handlers use the schema of the tenant resolved for the request
+func TestSchemaFor(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	assert.Equal(t, "fallback", schemaFor(req, "fallback"))
+
+	req = req.WithContext(tenant.WithTenant(req.Context(), tenant.Tenant{Name: "north", SchemaName: "north"}))
+	assert.Equal(t, "north", schemaFor(req, "fallback"))
+}
+
+// Test that with tenants configured a token without the tenant claim is refused on every branch
+func TestTenantClaimRequired(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Tenants = []config.TenantConfig{
+		{Name: "central", SchemaName: "news_central"},
+		{Name: "north", SchemaName: "news_north"},
+	}
+	cfg.DefaultTenant = "central"
+	useSettings(t, cfg)
+	resolver, err := tenant.NewResolver(cfg, TenantClaim)
+	if err != nil {
+		t.Fatal("invalid tenants configuration:", err)
+	}
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current, _ := tenant.FromContext(r.Context())
+		w.Write([]byte(current.Name))
+	}))
+	northToken, err := IssueToken([]byte(cfg.JWT.Secret), LoginCredentials{ID: "1", GrantType: "admin", Tenant: "north"}, time.Hour, time.Now())
+	assert.NoError(t, err)
+
+	serve := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	//token bez pola tenant nie daje dostępu do żadnej filii
+	for _, path := range []string{"/north/api/News", "/central/api/News", "/api/News"} {
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, path, adminToken).Code, path)
+		assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, path, adminToken).Code, path)
+	}
+
+	//token filii north działa tylko w tej filii
+	recorder := serve(http.MethodPost, "/north/api/News", northToken)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "north", recorder.Body.String())
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "/central/api/News", northToken).Code)
+
+	//żądania anonimowe nadal wybierają filię prefiksem ścieżki
+	recorder = serve(http.MethodGet, "/north/api/News", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "north", recorder.Body.String())
+}
+
+// Test that news created in one tenant are not visible in another
+func TestTenantIsolation(t *testing.T) {
+	db, testConfig, err := RunTestingServer()
+	if err != nil {
+		t.Fatal("cannot run server on port 8080:", err)
+	}
+	defer db.Close()
+
+	cfg := testConfig
+	cfg.Tenants = []config.TenantConfig{
+		{Name: "central", SchemaName: testConfig.SchemaName + "_central"},
+		{Name: "north", SchemaName: testConfig.SchemaName + "_north"},
+	}
+	if err := database.CreateTenantTables(db, cfg); err != nil {
+		t.Fatal("cannot create tenant tables:", err)
+	}
+	resolver, err := tenant.NewResolver(cfg, TenantClaim)
+	if err != nil {
+		t.Fatal("invalid tenants configuration:", err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/News", GetAllNews(db, testConfig.SchemaName, testConfig.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/{id}", GetNewsByID(db, testConfig.SchemaName, testConfig.TableName)).Methods("GET")
+	router.HandleFunc("/api/News", CreateNews(db, testConfig.SchemaName, testConfig.TableName, time.Hour)).Methods("POST")
+	handler := resolver.Middleware(router)
+
+	//utworzenie newsa w filii central tokenem przypisanym do tej filii
+	centralToken, err := IssueToken([]byte(testConfig.JWT.Secret), LoginCredentials{ID: "1", GrantType: "admin", Tenant: "central"}, time.Hour, time.Now())
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/central/api/News", strings.NewReader(`{"content": "Biblioteka nieczynna w poniedziałek"}`))
+	req.Header.Set("Authorization", "Bearer "+centralToken)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	var created map[string]int
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &created))
+
+	//news nie jest widoczny w filii north
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/north/api/News", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var northNews []News
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &northNews))
+	for _, news := range northNews {
+		assert.NotEqual(t, "Biblioteka nieczynna w poniedziałek", news.Content)
+	}
+
+	//pobranie po identyfikatorze działa tylko w filii, w której news został utworzony
+	newsPath := "/api/News/" + strconv.Itoa(created["id"])
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/central"+newsPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/north"+newsPath, nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Oświadczenia tokenu JWT z identyfikatorem i rolą użytkownika (nazwy jak w tokenach wydawanych przez serwis logowania)
+const (
+	nameIdentifierClaim = "http://schemas.xmlsoap.org/ws/2005/05/identity/claims/nameidentifier"
+	roleClaim           = "http://schemas.microsoft.com/ws/2008/06/identity/claims/role"
+)
+
+// Wydanie tokenu podpisanego kluczem secret, ważnego przez ttl od now - do testów lokalnych,
+// gdy serwis logowania nie jest dostępny
+func IssueToken(secret []byte, claims LoginCredentials, ttl time.Duration, now time.Time) (string, error) {
+	if len(secret) == 0 {
+		return "", errors.New("jwt.secret is not configured")
+	}
+	mapClaims := jwt.MapClaims{
+		nameIdentifierClaim: claims.ID,
+		roleClaim:           claims.GrantType,
+		"nbf":               now.Unix(),
+		"exp":               now.Add(ttl).Unix(),
+	}
+	if claims.Tenant != "" {
+		mapClaims["tenant"] = claims.Tenant
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, mapClaims).SignedString(secret)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign token")
+	}
+	return token, nil
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that issued tokens are accepted by the token validation until they expire
+func TestIssueToken(t *testing.T) {
+	secret := []byte("local-key")
+	token, err := IssueToken(secret, LoginCredentials{ID: "42", GrantType: "admin", Tenant: "centrala"}, time.Hour, time.Now())
+	assert.NoError(t, err)
+	claims, err := validateTokenWithKey(token, secret)
+	assert.NoError(t, err)
+	assert.Equal(t, &LoginCredentials{ID: "42", GrantType: "admin", Tenant: "centrala"}, claims)
+
+	_, err = validateTokenWithKey(token, []byte("other-key"))
+	assert.Error(t, err)
+
+	expired, err := IssueToken(secret, LoginCredentials{ID: "42", GrantType: "admin"}, time.Hour, time.Now().Add(-2*time.Hour))
+	assert.NoError(t, err)
+	_, err = validateTokenWithKey(expired, secret)
+	assert.Error(t, err)
+
+	_, err = IssueToken(nil, LoginCredentials{ID: "42", GrantType: "admin"}, time.Hour, time.Now())
+	assert.Error(t, err)
+}
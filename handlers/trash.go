@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/outbox"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// News przeniesiony do kosza
+type DeletedNews struct {
+	News
+	DeletedAt string `json:"deletedAt"`
+	DeletedBy string `json:"deletedBy"`
+}
+
+func GetTrash(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		// Kosz dostępny jest tylko dla administratorów
+		if _, ok := authorize(w, r, "admin"); !ok {
+			return
+		}
+
+		query := fmt.Sprintf(`SELECT "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility", "DeletedAt", "DeletedBy" FROM "%s"."%s" WHERE "DeletedAt" IS NOT NULL ORDER BY "DeletedAt" DESC`, schemaName, tableName)
+		rows, err := db.QueryContext(r.Context(), query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rows.Close()
+
+		trash := make([]DeletedNews, 0)
+		for rows.Next() {
+			var news DeletedNews
+			err := rows.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.Visibility, &news.DeletedAt, &news.DeletedBy)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			trash = append(trash, news)
+		}
+
+		jsonData, err := json.Marshal(trash)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(jsonData)
+	}
+}
+
+func RestoreNews(db *sql.DB, schemaName, tableName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schemaName := schemaFor(r, schemaName)
+
+		claims, ok := authorize(w, r, "admin")
+		if !ok {
+			return
+		}
+
+		vars := mux.Vars(r)
+		newsID, err := strconv.Atoi(vars["id"])
+		if err != nil {
+			http.Error(w, "Invalid news ID", http.StatusBadRequest)
+			return
+		}
+
+		// Przywrócenie newsa z kosza wraz z wpisem audytu i zdarzeniem w tabeli outbox
+		tx, err := db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+
+		selectQuery := fmt.Sprintf(`SELECT "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "Visibility", "DeletedAt", "DeletedBy" FROM "%s"."%s" WHERE "Id"=$1 AND "DeletedAt" IS NOT NULL FOR UPDATE`, schemaName, tableName)
+		var before DeletedNews
+		err = tx.QueryRowContext(r.Context(), selectQuery, newsID).Scan(&before.ID, &before.Content, &before.CreatedDate, &before.AuthorID, &before.LastUpdate, &before.Visibility, &before.DeletedAt, &before.DeletedBy)
+		if err == sql.ErrNoRows {
+			http.Error(w, "News not found in trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		query := fmt.Sprintf(`UPDATE "%s"."%s" SET "DeletedAt"=NULL, "DeletedBy"=NULL WHERE "Id"=$1`, schemaName, tableName)
+		_, err = tx.ExecContext(r.Context(), query, newsID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		err = recordChange(tx, r, schemaName, tableName, claims, outbox.NewsRestored, newsID, before, before.News)
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("News został przywrócony"))
+	}
+}
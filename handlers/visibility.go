@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Poziomy widoczności newsa
+const (
+	VisibilityPublic  = "public"  // wszyscy, również bez tokenu
+	VisibilityReaders = "readers" // zalogowani użytkownicy z dowolną rolą
+	VisibilityStaff   = "staff"   // pracownicy (admin, employee)
+)
+
+var visibilityLevels = []string{VisibilityPublic, VisibilityReaders, VisibilityStaff}
+
+func isVisibility(visibility string) bool {
+	for _, level := range visibilityLevels {
+		if visibility == level {
+			return true
+		}
+	}
+	return false
+}
+
+// Poziomy widoczności dostępne dla użytkownika (nil oznacza użytkownika anonimowego)
+func visibleLevels(claims *LoginCredentials) []string {
+	if claims == nil {
+		return []string{VisibilityPublic}
+	}
+	if hasRole(claims, "admin", "employee") {
+		return visibilityLevels
+	}
+	return []string{VisibilityPublic, VisibilityReaders}
+}
+
+// Warunek SQL ograniczający newsy do widocznych dla użytkownika. Kolumna nie jest kwalifikowana
+// aliasem, dlatego warunek można dołączyć do każdego zapytania, w którym tylko tabela newsów ma kolumnę "Visibility".
+func visibilityFilter(claims *LoginCredentials) string {
+	levels := visibleLevels(claims)
+	quoted := make([]string, 0, len(levels))
+	for _, level := range levels {
+		quoted = append(quoted, "'"+level+"'")
+	}
+	return fmt.Sprintf(`"Visibility" IN (%s)`, strings.Join(quoted, ", "))
+}
+
+// Odczytanie opcjonalnego tokenu zapytań odczytu. W przypadku niepoprawnego tokenu
+// zapisuje odpowiedź 401 i zwraca false, brak tokenu oznacza użytkownika anonimowego.
+func readerClaims(w http.ResponseWriter, r *http.Request) (*LoginCredentials, bool) {
+	claims, err := optionalClaims(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test mapping of JWT roles to visibility levels
+func TestVisibleLevels(t *testing.T) {
+	assert.Equal(t, []string{VisibilityPublic}, visibleLevels(nil))
+	assert.Equal(t, []string{VisibilityPublic, VisibilityReaders}, visibleLevels(&LoginCredentials{ID: "1", GrantType: "reader"}))
+	assert.Equal(t, visibilityLevels, visibleLevels(&LoginCredentials{ID: "1", GrantType: "employee"}))
+	assert.Equal(t, visibilityLevels, visibleLevels(&LoginCredentials{ID: "1", GrantType: "admin"}))
+
+	assert.Equal(t, `"Visibility" IN ('public')`, visibilityFilter(nil))
+	assert.Equal(t, `"Visibility" IN ('public', 'readers', 'staff')`, visibilityFilter(&LoginCredentials{ID: "1", GrantType: "admin"}))
+}
+
+// Test that an invalid token on a read endpoint is rejected instead of treated as anonymous
+func TestGetAllNewsInvalidToken(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	recorder := httptest.NewRecorder()
+	GetAllNews(nil, "test", "test").ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test rejecting an unknown visibility level when creating news
+func TestCreateNewsUnknownVisibility(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/News", strings.NewReader(`{"content": "Test", "visibility": "everyone"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder := httptest.NewRecorder()
+	CreateNews(nil, "test", "test", time.Hour).ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+// Test that updating only the visibility does not wipe the content of the news
+func TestUpdateNewsWithoutContent(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/api/News/5", strings.NewReader(`{"visibility": "staff"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "5"})
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	recorder := httptest.NewRecorder()
+	UpdateNews(nil, "test", "test").ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "News content cannot be empty")
+}
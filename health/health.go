@@ -0,0 +1,187 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sprawdzenie jednego warunku gotowości serwisu (np. połączenia z bazą)
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	fn      CheckFunc
+}
+
+// Checker obsługuje endpointy /healthz i /readyz. Serwis jest gotowy, gdy wszystkie zarejestrowane
+// sprawdzenia kończą się bez błędu w swoim limicie czasu, a serwis nie jest w trakcie zamykania.
+type Checker struct {
+	mu       sync.Mutex
+	checks   []check
+	draining bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Dodanie sprawdzenia gotowości. Timeout równy 0 oznacza brak limitu.
+func (c *Checker) Register(name string, timeout time.Duration, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, fn: fn})
+}
+
+// Oznaczenie rozpoczęcia zamykania - od tej chwili /readyz zwraca 503, aby nowy ruch trafiał do innych instancji
+func (c *Checker) SetDraining() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draining = true
+}
+
+// Wynik pojedynczego sprawdzenia
+type CheckResult struct {
+	Status     string `json:"status"` // ok lub fail
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Odpowiedź endpointów zdrowia
+type Report struct {
+	Status string                 `json:"status"` // ok lub unavailable
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Wykonanie wszystkich sprawdzeń równolegle
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]check(nil), c.checks...)
+	draining := c.draining
+	c.mu.Unlock()
+
+	report := Report{Status: "ok", Checks: make(map[string]CheckResult, len(checks)+1)}
+	if draining {
+		report.Status = "unavailable"
+		report.Checks["shutdown"] = CheckResult{Status: "fail", Error: "service is shutting down"}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, ch := range checks {
+		wg.Add(1)
+		go func(ch check) {
+			defer wg.Done()
+			result := run(ctx, ch)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[ch.name] = result
+			if result.Status != "ok" {
+				report.Status = "unavailable"
+			}
+		}(ch)
+	}
+	wg.Wait()
+	return report
+}
+
+func run(ctx context.Context, ch check) CheckResult {
+	if ch.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ch.timeout)
+		defer cancel()
+	}
+	start := time.Now()
+
+	// Sprawdzenie, które nie respektuje kontekstu, nie może zablokować odpowiedzi dłużej niż timeout
+	done := make(chan error, 1)
+	go func() { done <- ch.fn(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "check did not finish in time")
+	}
+
+	result := CheckResult{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// GET /healthz - proces działa i obsługuje żądania. Nie sprawdza zależności, aby awaria bazy nie powodowała restartu.
+func (c *Checker) Liveness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, Report{Status: "ok"})
+	}
+}
+
+// GET /readyz - serwis może przyjmować ruch. Zwraca 503 ze szczegółami, jeśli którekolwiek sprawdzenie się nie powiodło.
+func (c *Checker) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, c.Check(r.Context()))
+	}
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == "ok" {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(jsonData)
+}
+
+// Workers śledzi zadania działające w tle. Zadanie, które zakończyło się przed zamykaniem serwisu, oznacza brak gotowości.
+type Workers struct {
+	mu      sync.Mutex
+	running map[string]int
+	stopped []string
+}
+
+func NewWorkers() *Workers {
+	return &Workers{running: make(map[string]int)}
+}
+
+// Zarejestrowanie uruchomionego zadania. Zwrócona funkcja powinna zostać wywołana po jego zakończeniu.
+func (w *Workers) Start(name string) func() {
+	w.mu.Lock()
+	w.running[name]++
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.running[name]--
+		if w.running[name] == 0 {
+			delete(w.running, name)
+		}
+		w.stopped = append(w.stopped, name)
+	}
+}
+
+// Sprawdzenie gotowości: żadne zadanie w tle nie zakończyło działania
+func (w *Workers) Check(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.stopped) > 0 {
+		stopped := append([]string(nil), w.stopped...)
+		sort.Strings(stopped)
+		return errors.Errorf("background workers stopped: %v", stopped)
+	}
+	return nil
+}
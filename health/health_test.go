@@ -0,0 +1,68 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func readiness(t *testing.T, checker *Checker) (int, Report) {
+	recorder := httptest.NewRecorder()
+	checker.Readiness().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+	return recorder.Code, report
+}
+
+// Test reporting per-check results and failing on errors and timeouts
+func TestReadiness(t *testing.T) {
+	checker := NewChecker()
+	checker.Register("database", time.Second, func(ctx context.Context) error { return nil })
+	code, report := readiness(t, checker)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", report.Checks["database"].Status)
+
+	checker.Register("schema", time.Second, func(ctx context.Context) error { return errors.New("missing News_views") })
+	checker.Register("slow", 20*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	start := time.Now()
+	code, report = readiness(t, checker)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", report.Status)
+	assert.Equal(t, "ok", report.Checks["database"].Status)
+	assert.Equal(t, "missing News_views", report.Checks["schema"].Error)
+	assert.Contains(t, report.Checks["slow"].Error, "did not finish in time")
+}
+
+// Test that the service reports not ready while shutting down but stays alive
+func TestDraining(t *testing.T) {
+	checker := NewChecker()
+	checker.SetDraining()
+	code, report := readiness(t, checker)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "fail", report.Checks["shutdown"].Status)
+
+	recorder := httptest.NewRecorder()
+	checker.Liveness().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// Test detecting a background worker that stopped
+func TestWorkers(t *testing.T) {
+	workers := NewWorkers()
+	stopRelay := workers.Start("outbox:news")
+	workers.Start("views")
+	assert.NoError(t, workers.Check(context.Background()))
+
+	stopRelay()
+	assert.EqualError(t, workers.Check(context.Background()), "background workers stopped: [outbox:news]")
+}
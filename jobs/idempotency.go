@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/database"
+	"news/logging"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Usunięcie wygasłych kluczy idempotencji wraz z zapisanymi odpowiedziami
+func PurgeIdempotencyKeys(ctx context.Context, db *sql.DB, schemaName, tableName string) (int64, error) {
+	query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "ExpiresAt" < NOW()`, schemaName, database.IdempotencyTableName(tableName))
+	result, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge idempotency keys")
+	}
+	return result.RowsAffected()
+}
+
+// Cykliczne usuwanie wygasłych kluczy idempotencji aż do anulowania kontekstu
+func RunIdempotencyPurge(ctx context.Context, db *sql.DB, schemaName, tableName string, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := PurgeIdempotencyKeys(ctx, db, schemaName, tableName)
+		if err != nil {
+			logging.Error("idempotency purge error", "schema", schemaName, "error", err)
+		} else if purged > 0 {
+			logging.Debug("idempotency purge removed keys", "schema", schemaName, "count", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
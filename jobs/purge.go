@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/audit"
+	"news/logging"
+	"news/outbox"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Stan newsa w koszu zapisywany w dzienniku audytu przed trwałym usunięciem
+type purgedNews struct {
+	ID          int    `json:"id"`
+	Content     string `json:"content"`
+	CreatedDate string `json:"createdDate"`
+	LastUpdate  string `json:"lastUpdate"`
+	AuthorID    string `json:"authorId"`
+	DeletedAt   string `json:"deletedAt"`
+	DeletedBy   string `json:"deletedBy"`
+}
+
+// Trwałe usunięcie newsów, które leżą w koszu dłużej niż olderThan.
+// Dla każdego usuniętego newsa w tej samej transakcji zapisywany jest wpis audytu i zdarzenie news.purged.
+func PurgeTrash(ctx context.Context, db *sql.DB, schemaName, tableName string, olderThan time.Duration) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin purge transaction")
+	}
+	defer tx.Rollback()
+
+	// Granica liczona jest w bazie, w tej samej strefie czasowej co NOW() zapisane w "DeletedAt"
+	query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "DeletedAt" IS NOT NULL AND "DeletedAt" < NOW() - $1 * INTERVAL '1 second' RETURNING "Id", "Content", "CreatedDate", "AuthorId", "LastUpdate", "DeletedAt", "DeletedBy"`, schemaName, tableName)
+	rows, err := tx.QueryContext(ctx, query, olderThan.Seconds())
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to purge trash")
+	}
+	var purged []purgedNews
+	for rows.Next() {
+		var news purgedNews
+		err := rows.Scan(&news.ID, &news.Content, &news.CreatedDate, &news.AuthorID, &news.LastUpdate, &news.DeletedAt, &news.DeletedBy)
+		if err != nil {
+			rows.Close()
+			return 0, errors.Wrap(err, "failed to scan purged news")
+		}
+		purged = append(purged, news)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errors.Wrap(err, "failed to purge trash")
+	}
+
+	for _, news := range purged {
+		err := audit.Record(ctx, tx, schemaName, tableName, audit.Entry{
+			ActorID:   audit.SystemActor,
+			ActorRole: audit.SystemActor,
+			Action:    outbox.NewsPurged,
+			NewsID:    news.ID,
+			Before:    news,
+		})
+		if err != nil {
+			return 0, err
+		}
+		event, err := outbox.NewEvent(outbox.NewsPurged, news.ID, map[string]int{"id": news.ID})
+		if err != nil {
+			return 0, err
+		}
+		if err := outbox.Enqueue(ctx, tx, schemaName, tableName, event); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit purge transaction")
+	}
+	return len(purged), nil
+}
+
+// Cykliczne czyszczenie kosza aż do anulowania kontekstu
+func RunTrashPurge(ctx context.Context, db *sql.DB, schemaName, tableName string, olderThan, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := PurgeTrash(ctx, db, schemaName, tableName, olderThan)
+		if err != nil {
+			logging.Error("trash purge error", "schema", schemaName, "error", err)
+		} else if purged > 0 {
+			logging.Info("trash purge removed news", "schema", schemaName, "count", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
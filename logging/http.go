@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Nagłówek z identyfikatorem żądania
+const RequestIDHeader = "X-Request-ID"
+
+// Maksymalna długość identyfikatora przyjmowanego od klienta
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// Identyfikator żądania z kontekstu (pusty poza obsługą żądania)
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Middleware nadające żądaniu identyfikator. Identyfikator z nagłówka X-Request-ID (np. od proxy) jest
+// przejmowany, jeśli ma poprawny format; w przeciwnym razie generowany jest nowy. Identyfikator zwracany
+// jest w odpowiedzi i dołączany do każdego wpisu logu z loggera kontekstu żądania.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = WithFields(ctx, "request_id", id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Identyfikator od klienta trafia do logów i dziennika audytu, dlatego dozwolone są tylko znaki drukowalne ASCII bez spacji
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Middleware zapisujące log dostępu po obsłużeniu każdego żądania: metoda, ścieżka, kod odpowiedzi,
+// rozmiar odpowiedzi i czas obsługi. Odpowiedzi 5xx logowane są na poziomie error.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		kv := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		}
+		if r.URL.RawQuery != "" {
+			kv = append(kv, "query", redactQuery(r.URL.Query()))
+		}
+		logger := FromContext(r.Context())
+		if recorder.status >= http.StatusInternalServerError {
+			logger.Error("request", kv...)
+		} else {
+			logger.Info("request", kv...)
+		}
+	})
+}
+
+// Parametry zapytania z ukrytymi wartościami sekretów (np. ?token=...)
+func redactQuery(query url.Values) string {
+	for key, values := range query {
+		for i := range values {
+			values[i] = Redact(key, values[i]).(string)
+		}
+	}
+	return query.Encode()
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += n
+	return n, err
+}
+
+// Przekazanie Flush, aby odpowiedzi strumieniowe działały również z middleware
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Dostęp do opakowanego ResponseWriter dla http.ResponseController (np. zmiana terminu zapisu)
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
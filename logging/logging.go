@@ -0,0 +1,245 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Poziomy logowania
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(name string) (Level, bool) {
+	for i, levelName := range levelNames {
+		if levelName == name {
+			return Level(i), true
+		}
+	}
+	return LevelInfo, false
+}
+
+var minLevel = int32(LevelInfo)
+
+// Ustawienie minimalnego poziomu logowanych komunikatów (zmieniany przy przeładowaniu konfiguracji).
+// Nieznane poziomy są ignorowane.
+func SetLevel(name string) {
+	if level, ok := ParseLevel(name); ok {
+		atomic.StoreInt32(&minLevel, int32(level))
+	}
+}
+
+// Czy komunikaty o danym poziomie są logowane
+func Enabled(level Level) bool {
+	return int32(level) >= atomic.LoadInt32(&minLevel)
+}
+
+// Formaty logów
+const (
+	FormatText = "text" // klucz=wartość, jedna linia na wpis
+	FormatJSON = "json" // jeden obiekt JSON na linię
+)
+
+// Logger zapisuje wpisy z komunikatem i parami klucz-wartość. Wartości kluczy wyglądających na sekrety
+// (hasła, tokeny, nagłówek Authorization) oraz tokeny JWT w treści są ukrywane.
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+type output struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	now    func() time.Time
+}
+
+func New(w io.Writer, format string) *Logger {
+	return &Logger{out: &output{w: w, format: format, now: time.Now}}
+}
+
+var std atomic.Value
+
+func init() {
+	std.Store(New(os.Stderr, FormatText))
+}
+
+// Logger używany przez funkcje pakietu i przez FromContext, gdy kontekst nie ma własnego loggera
+func Default() *Logger {
+	return std.Load().(*Logger)
+}
+
+func SetDefault(l *Logger) {
+	std.Store(l)
+}
+
+// Logger z dodatkowymi polami dołączanymi do każdego wpisu
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	fields = append(fields, kv...)
+	return &Logger{out: l.out, fields: fields}
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+func (l *Logger) Info(msg string, kv ...interface{})  { l.log(LevelInfo, msg, kv) }
+func (l *Logger) Warn(msg string, kv ...interface{})  { l.log(LevelWarn, msg, kv) }
+func (l *Logger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func Debug(msg string, kv ...interface{}) { Default().log(LevelDebug, msg, kv) }
+func Info(msg string, kv ...interface{})  { Default().log(LevelInfo, msg, kv) }
+func Warn(msg string, kv ...interface{})  { Default().log(LevelWarn, msg, kv) }
+func Error(msg string, kv ...interface{}) { Default().log(LevelError, msg, kv) }
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	pairs := append(append(make([]interface{}, 0, len(l.fields)+len(kv)), l.fields...), kv...)
+
+	var buf bytes.Buffer
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	now := l.out.now().UTC().Format(time.RFC3339Nano)
+	if l.out.format == FormatJSON {
+		buf.WriteString(`{"time":` + jsonValue(now) + `,"level":` + jsonValue(level.String()) + `,"msg":` + jsonValue(redactString(msg)))
+		forEachPair(pairs, func(key string, value interface{}) {
+			buf.WriteString("," + jsonValue(key) + ":" + jsonValue(value))
+		})
+		buf.WriteString("}\n")
+	} else {
+		buf.WriteString("time=" + now + " level=" + level.String() + " msg=" + textValue(redactString(msg)))
+		forEachPair(pairs, func(key string, value interface{}) {
+			buf.WriteString(" " + key + "=" + textValue(value))
+		})
+		buf.WriteByte('\n')
+	}
+	l.out.w.Write(buf.Bytes())
+}
+
+// Przejście par klucz-wartość z ukryciem sekretów. Wartość bez klucza zapisywana jest pod kluczem "!badkey".
+func forEachPair(kv []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok || i+1 == len(kv) {
+			fn("!badkey", Redact("", kv[i]))
+			i--
+			continue
+		}
+		fn(key, Redact(key, kv[i+1]))
+	}
+}
+
+const redacted = "[REDACTED]"
+
+var (
+	sensitiveKey = regexp.MustCompile(`(?i)pass|secret|token|authorization|cookie|dsn|credential`)
+	bearerValue  = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	jwtValue     = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+)
+
+// Ukrycie wartości pola, jeśli klucz wskazuje na sekret, oraz tokenów w tekście
+func Redact(key string, value interface{}) interface{} {
+	if key != "" && sensitiveKey.MatchString(key) {
+		return redacted
+	}
+	switch v := value.(type) {
+	case string:
+		return redactString(v)
+	case error:
+		return redactString(v.Error())
+	case fmt.Stringer:
+		return redactString(v.String())
+	}
+	return value
+}
+
+func redactString(s string) string {
+	s = bearerValue.ReplaceAllString(s, "${1}"+redacted)
+	return jwtValue.ReplaceAllString(s, redacted)
+}
+
+func jsonValue(value interface{}) string {
+	switch v := value.(type) {
+	case time.Duration:
+		value = v.String()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return string(data)
+}
+
+func textValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+type loggerKey struct{}
+
+// Kontekst z loggerem (np. z identyfikatorem żądania)
+func WithLogger(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// Logger z kontekstu lub domyślny
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
+
+// Kontekst z loggerem uzupełnionym o pola
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(kv...))
+}
+
+// Przekierowanie standardowego pakietu log (np. błędów http.Server i bibliotek) do domyślnego loggera
+func RedirectStdLog() {
+	log.SetFlags(0)
+	log.SetOutput(writer{level: LevelWarn})
+}
+
+// *log.Logger zapisujący każdą linię jako wpis o danym poziomie
+func StdLogger(level Level) *log.Logger {
+	return log.New(writer{level: level}, "", 0)
+}
+
+type writer struct {
+	level Level
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	Default().log(w.level, strings.TrimRight(string(p), "\n"), nil)
+	return len(p), nil
+}
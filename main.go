@@ -1,11 +1,26 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"flag"
 	"net/http"
 	"news/config"
 	"news/database"
 	"news/handlers"
+	"news/health"
+	"news/jobs"
+	"news/logging"
+	"news/metrics"
+	"news/outbox"
+	"news/ratelimit"
+	"news/server"
+	"news/tenant"
+	"news/tracing"
+	"news/views"
+	"os"
+	"sync"
+	"time"
 
 	apiHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -13,42 +28,222 @@ import (
 	"github.com/pkg/errors"
 )
 
+const (
+	// Co jaki czas sprawdzana jest zmiana pliku konfiguracyjnego
+	configWatchInterval = 10 * time.Second
+	// Co jaki czas usuwane są nieużywane kubełki limitów żądań z bazy
+	rateLimitCleanupInterval = 5 * time.Minute
+)
+
 func main() {
-	err := RunServer()
+	if len(os.Args) > 1 && os.Args[1] == "help" {
+		usage(os.Stdout)
+		return
+	}
+	cmd, args, err := findCommand(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		usage(os.Stderr)
+		fatal(err)
+	}
+	if err := cmd.run(args); err != nil {
+		if err == flag.ErrHelp {
+			return
+		}
+		fatal(err)
 	}
 }
 
-func RunServer() error {
+func fatal(err error) {
+	logging.Error(err.Error())
+	os.Exit(1)
+}
 
-	config, err := config.GetConfig()
+// Uruchomienie serwisu do czasu anulowania ctx. Przy zamykaniu najpierw kończone są trwające żądania,
+// następnie zadania w tle (z zapisem zebranych wyświetleń), a na końcu zamykane jest połączenie z bazą.
+func RunServer(ctx context.Context, cfg config.Config) error {
+	// Filia żądania ustalana na podstawie prefiksu ścieżki, nagłówka Host lub tokenu JWT
+	tenants, err := tenant.NewResolver(cfg, handlers.TenantClaim)
 	if err != nil {
-		return errors.Wrap(err, "failed to get config from file")
+		return errors.Wrap(err, "invalid tenants configuration")
+	}
+
+	// Czas i błędy zapytań do bazy w metrykach
+	if cfg.Metrics.Enabled {
+		database.AddQueryHook(metrics.QueryHook)
+	}
+
+	// Śledzenie żądań i wykonywanych w nich zapytań do bazy
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		tracer, err = tracing.NewTracer(cfg.Tracing)
+		if err != nil {
+			return errors.Wrap(err, "invalid tracing configuration")
+		}
+		database.AddQueryHook(tracer.QueryHook)
 	}
-	db, err := database.ConnectDB(config)
+
+	// Baza może startować razem z serwisem (np. docker compose) - kilka prób z rosnącym odstępem
+	db, err := openDB(ctx, cfg)
 	if err != nil {
-		return errors.Wrap(err, "failed to connect to the database")
+		return err
 	}
 	defer db.Close()
 
-	err = database.CreateNewsTable(db, config)
+	// Tabele tworzone są w schemacie każdej filii
+	err = database.CreateTenantTables(db, cfg)
 	if err != nil {
-		return errors.Wrap(err, "failed to create News table")
+		return errors.Wrap(err, "failed to create tables")
 	}
 
+	// Przekazywanie zdarzeń z tabeli outbox w tle
+	publisher, err := outbox.NewPublisher(cfg.Outbox)
+	if err != nil {
+		return errors.Wrap(err, "failed to create outbox publisher")
+	}
+
+	// Zadania w tle mają własny kontekst - są zatrzymywane dopiero po zakończeniu żądań HTTP
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	defer func() {
+		stopWorkers()
+		workers.Wait()
+	}()
+	running := health.NewWorkers()
+	startWorker := func(name string, run func(context.Context)) {
+		workers.Add(1)
+		stopped := running.Start(name)
+		go func() {
+			defer workers.Done()
+			defer stopped()
+			run(workersCtx)
+		}()
+	}
+
+	// Eksport spanów kończy się po zakończeniu żądań, więc trafiają do niego również spany ostatnich żądań
+	if tracer != nil {
+		startWorker("tracing", tracer.Run)
+	}
+
+	for _, schemaName := range cfg.Schemas() {
+		schemaName := schemaName
+		relay := outbox.NewRelay(db, schemaName, cfg.TableName, publisher,
+			time.Duration(cfg.Outbox.IntervalSeconds)*time.Second, cfg.Outbox.BatchSize, cfg.Outbox.MaxAttempts)
+		startWorker("outbox:"+schemaName, relay.Run)
+
+		// Trwałe usuwanie newsów z kosza po upływie skonfigurowanego czasu
+		if cfg.Trash.PurgeAfterDays > 0 {
+			startWorker("trash:"+schemaName, func(ctx context.Context) {
+				jobs.RunTrashPurge(ctx, db, schemaName, cfg.TableName,
+					time.Duration(cfg.Trash.PurgeAfterDays)*24*time.Hour,
+					time.Duration(cfg.Trash.PurgeIntervalMinutes)*time.Minute)
+			})
+		}
+
+		// Usuwanie wygasłych kluczy idempotencji
+		startWorker("idempotency:"+schemaName, func(ctx context.Context) {
+			jobs.RunIdempotencyPurge(ctx, db, schemaName, cfg.TableName,
+				time.Duration(cfg.Idempotency.PurgeIntervalMinutes)*time.Minute)
+		})
+	}
+
+	// Limity żądań w pamięci procesu lub we wspólnej tabeli w bazie
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter()
+	if cfg.RateLimit.Enabled && cfg.RateLimit.Store == config.RateLimitStorePostgres {
+		pgLimiter := &ratelimit.PostgresLimiter{DB: db, SchemaName: cfg.SchemaName, TableName: cfg.TableName}
+		startWorker("ratelimit", func(ctx context.Context) {
+			pgLimiter.RunCleanup(ctx, cfg.Schemas(), ratelimit.CurrentIdleTime, rateLimitCleanupInterval)
+		})
+		limiter = pgLimiter
+	}
+
+	// Liczniki wyświetleń zapisywane do bazy paczkami
+	viewCounter := views.NewCounter(db, cfg.TableName,
+		time.Duration(cfg.Views.DedupWindowMinutes)*time.Minute,
+		time.Duration(cfg.Views.FlushIntervalSeconds)*time.Second)
+	startWorker("views", viewCounter.Run)
+
 	router := mux.NewRouter()
+	if tracer != nil {
+		router.Use(tracer.Middleware)
+	}
 	methods := apiHandlers.AllowedMethods([]string{"OPTIONS", "DELETE", "GET", "HEAD", "POST", "PUT"})
-	origins := apiHandlers.AllowedOrigins([]string{"*"})
+	// Dozwolone adresy sprawdzane przy każdym żądaniu, aby zmiana cors.allowedOrigins działała bez restartu
+	origins := apiHandlers.AllowedOriginValidator(handlers.OriginAllowed)
 	credentials := apiHandlers.AllowCredentials()
 
-	// Endpointy
-	router.HandleFunc("/api/News", handlers.GetAllNews(db, config.SchemaName, config.TableName)).Methods("GET")
-	router.HandleFunc("/api/News/{id}", handlers.GetNewsByID(db, config.SchemaName, config.TableName)).Methods("GET")
-	router.HandleFunc("/api/News", handlers.CreateNews(db, config.SchemaName, config.TableName)).Methods("POST")
-	router.HandleFunc("/api/News/{id}", handlers.UpdateNews(db, config.SchemaName, config.TableName)).Methods("PUT")
-	router.HandleFunc("/api/News/{id}", handlers.DeleteNews(db, config.SchemaName, config.TableName)).Methods("DELETE")
+	registerRoutes(router, db, cfg, viewCounter)
+
+	// Sprawdzenia gotowości dla /readyz
+	checkTimeout := time.Duration(cfg.Health.CheckTimeoutSeconds) * time.Second
+	checker := health.NewChecker()
+	checker.Register("database", checkTimeout, db.PingContext)
+	checker.Register("schema", checkTimeout, func(ctx context.Context) error {
+		return database.CheckSchema(ctx, db, cfg)
+	})
+	checker.Register("workers", checkTimeout, running.Check)
+
+	// Endpointy zdrowia i metryk nie zależą od filii ani CORS - odpytuje je orkiestrator i Prometheus
+	root := http.NewServeMux()
+	root.Handle("/healthz", checker.Liveness())
+	root.Handle("/readyz", checker.Readiness())
+	metricsPath := ""
+	if cfg.Metrics.Enabled {
+		metricsPath = cfg.Metrics.Path
+	}
+	root.Handle(handlers.OpenAPIPath, handlers.ServeOpenAPI(metricsPath))
+	root.Handle(handlers.SwaggerUIPath, handlers.SwaggerUI(handlers.OpenAPIPath))
+	root.Handle(handlers.SwaggerUIAssetsPath, handlers.SwaggerUIAssets())
+	if cfg.Metrics.Enabled {
+		router.Use(metrics.Middleware)
+		metrics.RegisterDatabase(metrics.Default, db, cfg, checkTimeout, time.Duration(cfg.Metrics.ItemsCacheSeconds)*time.Second)
+		root.Handle(cfg.Metrics.Path, metrics.Default.Handler())
+	}
+	// Limit żądań sprawdzany jest po ustaleniu filii, a przed CORS, aby odpowiedź 429 była czytelna dla przeglądarki
+	var limited http.Handler = router
+	if cfg.RateLimit.Enabled {
+		limited = ratelimit.Middleware(limiter, ratelimit.CurrentBudgets, handlers.RateLimitKey)(router)
+	}
+
+	// Każde żądanie API otrzymuje identyfikator (X-Request-ID) i trafia do logu dostępu
+	api := apiHandlers.CORS(credentials, methods, origins)(tenants.Middleware(limited))
+	root.Handle("/", logging.RequestID(logging.AccessLog(api)))
+
+	srv, err := server.New(cfg.Server, root)
+	if err != nil {
+		return errors.Wrap(err, "invalid server configuration")
+	}
+	srv.OnShutdown = checker.SetDraining
+	logging.Info("Serwer NewsService został uruchomiony", "address", cfg.Server.Address)
+	return srv.Run(ctx)
+}
 
-	log.Println("Serwer NewsService został uruchomiony na porcie 8080")
-	return http.ListenAndServe(":8080", apiHandlers.CORS(credentials, methods, origins)(router))
+// Rejestracja endpointów API. Każdy endpoint musi mieć opis w dokumencie OpenAPI (handlers/openapi.go) - sprawdza to test.
+func registerRoutes(router *mux.Router, db *sql.DB, cfg config.Config, viewCounter *views.Counter) {
+	router.HandleFunc("/api/News", handlers.GetAllNews(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/import", handlers.ImportNews(db, cfg.SchemaName, cfg.TableName, cfg.Import.MaxRows)).Methods("POST")
+	router.HandleFunc("/api/News/export", handlers.ExportNews(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/trash", handlers.GetTrash(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/unread", handlers.GetUnreadNews(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/News/{id}/restore", handlers.RestoreNews(db, cfg.SchemaName, cfg.TableName)).Methods("POST")
+	router.HandleFunc("/api/News/popular", handlers.GetPopularNews(db, cfg.SchemaName, cfg.TableName, cfg.Views.PopularPeriods, cfg.Views.PopularMaxCount)).Methods("GET")
+	router.HandleFunc("/api/News/featured", handlers.GetFeaturedNews(db, cfg.SchemaName, cfg.TableName, cfg.Featured.MaxCount)).Methods("GET")
+	router.HandleFunc("/api/News/{id}", handlers.CountViews(viewCounter, cfg.SchemaName, handlers.GetNewsByID(db, cfg.SchemaName, cfg.TableName))).Methods("GET")
+	router.HandleFunc("/api/News/bulk", handlers.BulkNews(db, cfg.SchemaName, cfg.TableName, cfg.Bulk.MaxOperations)).Methods("POST")
+	router.HandleFunc("/api/News", handlers.CreateNews(db, cfg.SchemaName, cfg.TableName, time.Duration(cfg.Idempotency.TTLHours)*time.Hour)).Methods("POST")
+	router.HandleFunc("/api/News/{id}", handlers.UpdateNews(db, cfg.SchemaName, cfg.TableName)).Methods("PUT")
+	router.HandleFunc("/api/News/{id}", handlers.DeleteNews(db, cfg.SchemaName, cfg.TableName)).Methods("DELETE")
+	router.HandleFunc("/api/News/{id}/comments", handlers.Feature(config.FeatureComments, handlers.GetComments(db, cfg.SchemaName, cfg.TableName))).Methods("GET")
+	router.HandleFunc("/api/News/{id}/comments", handlers.Feature(config.FeatureComments, handlers.CreateComment(db, cfg.SchemaName, cfg.TableName))).Methods("POST")
+	router.HandleFunc("/api/News/{id}/comments/settings", handlers.Feature(config.FeatureComments, handlers.UpdateCommentSettings(db, cfg.SchemaName, cfg.TableName))).Methods("PUT")
+	router.HandleFunc("/api/News/{id}/comments/{commentId}/approve", handlers.Feature(config.FeatureComments, handlers.ApproveComment(db, cfg.SchemaName, cfg.TableName))).Methods("POST")
+	router.HandleFunc("/api/News/{id}/comments/{commentId}/hide", handlers.Feature(config.FeatureComments, handlers.HideComment(db, cfg.SchemaName, cfg.TableName))).Methods("POST")
+	router.HandleFunc("/api/News/{id}/comments/{commentId}", handlers.Feature(config.FeatureComments, handlers.DeleteComment(db, cfg.SchemaName, cfg.TableName))).Methods("DELETE")
+	router.HandleFunc("/api/News/{id}/reactions/{reaction}", handlers.Feature(config.FeatureReactions, handlers.AddReaction(db, cfg.SchemaName, cfg.TableName))).Methods("PUT")
+	router.HandleFunc("/api/News/{id}/reactions/{reaction}", handlers.Feature(config.FeatureReactions, handlers.RemoveReaction(db, cfg.SchemaName, cfg.TableName))).Methods("DELETE")
+	router.HandleFunc("/api/News/{id}/read", handlers.MarkAsRead(db, cfg.SchemaName, cfg.TableName)).Methods("POST")
+	router.HandleFunc("/api/News/{id}/pin", handlers.PinNews(db, cfg.SchemaName, cfg.TableName)).Methods("PUT")
+	router.HandleFunc("/api/News/{id}/featured", handlers.FeatureNews(db, cfg.SchemaName, cfg.TableName)).Methods("PUT")
+	router.HandleFunc("/api/audit", handlers.GetAuditLog(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/stats", handlers.GetStatistics(db, cfg.SchemaName, cfg.TableName)).Methods("GET")
+	router.HandleFunc("/api/admin/db/stats", handlers.GetPoolStats(db)).Methods("GET")
 }
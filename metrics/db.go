@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/config"
+	"news/database"
+	"news/logging"
+	"time"
+)
+
+var (
+	dbDuration = Default.NewHistogramVec("news_db_query_duration_seconds",
+		"Database query latency by statement type and table.", DefaultBuckets, "operation", "table")
+	dbErrors = Default.NewCounterVec("news_db_query_errors_total",
+		"Number of failed database queries by statement type and table.", "operation", "table")
+)
+
+// Hook instrumentacji bazy mierzący czas i błędy zapytań (zob. database.AddQueryHook)
+func QueryHook(ctx context.Context, stmt database.Statement) (context.Context, func(int64, error)) {
+	start := time.Now()
+	return ctx, func(_ int64, err error) {
+		dbDuration.Observe(time.Since(start).Seconds(), stmt.Operation, stmt.Table)
+		if err != nil {
+			dbErrors.Inc(stmt.Operation, stmt.Table)
+		}
+	}
+}
+
+// Rejestracja metryk puli połączeń i liczby newsów w schemacie każdej filii, wyliczanych przy odczycie /metrics.
+// Zapytania o liczbę newsów mają limit czasu timeout, aby awaria bazy nie blokowała odczytu pozostałych metryk,
+// a ich wynik używany jest ponownie przez cacheTTL (zwykle odstęp między odczytami Prometheusa).
+func RegisterDatabase(r *Registry, db *sql.DB, cfg config.Config, timeout, cacheTTL time.Duration) {
+	r.Collect(func() []Sample {
+		stats := db.Stats()
+		return []Sample{
+			{Name: "news_db_pool_max_open_connections", Help: "Maximum number of open connections (0 means unlimited).", Type: "gauge", Value: float64(stats.MaxOpenConnections)},
+			{Name: "news_db_pool_open_connections", Help: "Number of open connections.", Type: "gauge", Value: float64(stats.OpenConnections)},
+			{Name: "news_db_pool_in_use_connections", Help: "Number of connections in use.", Type: "gauge", Value: float64(stats.InUse)},
+			{Name: "news_db_pool_idle_connections", Help: "Number of idle connections.", Type: "gauge", Value: float64(stats.Idle)},
+			{Name: "news_db_pool_wait_total", Help: "Number of times a query waited for a free connection.", Type: "counter", Value: float64(stats.WaitCount)},
+			{Name: "news_db_pool_wait_seconds_total", Help: "Time spent waiting for a free connection.", Type: "counter", Value: stats.WaitDuration.Seconds()},
+			{Name: "news_db_pool_closed_total", Help: "Connections closed by pool limits.", Type: "counter", Labels: map[string]string{"reason": "max_idle"}, Value: float64(stats.MaxIdleClosed)},
+			{Name: "news_db_pool_closed_total", Help: "Connections closed by pool limits.", Type: "counter", Labels: map[string]string{"reason": "max_idle_time"}, Value: float64(stats.MaxIdleTimeClosed)},
+			{Name: "news_db_pool_closed_total", Help: "Connections closed by pool limits.", Type: "counter", Labels: map[string]string{"reason": "max_lifetime"}, Value: float64(stats.MaxLifetimeClosed)},
+		}
+	})
+
+	r.Collect(Cached(cacheTTL, func() []Sample {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var samples []Sample
+		for _, schemaName := range cfg.Schemas() {
+			counts, err := countNews(ctx, db, schemaName, cfg.TableName)
+			if err != nil {
+				logging.Error("failed to count news for metrics", "schema", schemaName, "error", err)
+				continue
+			}
+			samples = append(samples, newsSamples(schemaName, counts)...)
+		}
+		return samples
+	}))
+}
+
+// Widoczności newsa (zob. ograniczenie CHECK kolumny "Visibility"). Seria dla każdej widoczności
+// wypisywana jest również przy zerowej liczbie, aby nie znikała z Prometheusa.
+var visibilities = []string{"public", "readers", "staff"}
+
+// Stany newsa liczone w metryce news_items
+var newsStates = []string{"published", "trashed", "pinned", "featured"}
+
+// Liczba newsów jednego schematu według widoczności i stanu
+func countNews(ctx context.Context, db *sql.DB, schemaName, tableName string) (map[string]map[string]int64, error) {
+	query := fmt.Sprintf(`SELECT "Visibility", COUNT(*) FILTER (WHERE "DeletedAt" IS NULL), COUNT(*) FILTER (WHERE "DeletedAt" IS NOT NULL),
+		COUNT(*) FILTER (WHERE "DeletedAt" IS NULL AND "Pinned"), COUNT(*) FILTER (WHERE "DeletedAt" IS NULL AND "Featured")
+		FROM "%s"."%s" GROUP BY "Visibility"`, schemaName, tableName)
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]map[string]int64)
+	for rows.Next() {
+		var visibility string
+		var published, trashed, pinned, featured int64
+		if err := rows.Scan(&visibility, &published, &trashed, &pinned, &featured); err != nil {
+			return nil, err
+		}
+		counts[visibility] = map[string]int64{"published": published, "trashed": trashed, "pinned": pinned, "featured": featured}
+	}
+	return counts, rows.Err()
+}
+
+// Próbki metryki news_items dla liczby newsów jednego schematu
+func newsSamples(schemaName string, counts map[string]map[string]int64) []Sample {
+	samples := make([]Sample, 0, len(visibilities)*len(newsStates))
+	for _, visibility := range visibilities {
+		for _, state := range newsStates {
+			samples = append(samples, Sample{
+				Name:   "news_items",
+				Help:   "Number of news by visibility (public, readers, staff) and state (published, trashed, pinned, featured).",
+				Type:   "gauge",
+				Labels: map[string]string{"schema": schemaName, "visibility": visibility, "state": state},
+				Value:  float64(counts[visibility][state]),
+			})
+		}
+	}
+	return samples
+}
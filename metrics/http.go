@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var (
+	httpRequests = Default.NewCounterVec("news_http_requests_total",
+		"Number of HTTP requests by route, method and status code.", "method", "route", "status")
+	httpDuration = Default.NewHistogramVec("news_http_request_duration_seconds",
+		"HTTP request latency by route and method.", DefaultBuckets, "method", "route")
+	httpInFlight = Default.NewGaugeVec("news_http_requests_in_flight",
+		"Number of HTTP requests being served.")
+)
+
+// Middleware routera mux zliczające żądania i czas ich obsługi. Trasa opisywana jest szablonem
+// (np. /api/News/{id}), a nie ścieżką żądania, aby liczba serii nie rosła z każdym identyfikatorem.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		httpInFlight.Add(1)
+		defer httpInFlight.Add(-1)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		httpRequests.Inc(r.Method, route, strconv.Itoa(recorder.status))
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Przekazanie Flush, aby odpowiedzi strumieniowe działały również z middleware
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Dostęp do opakowanego ResponseWriter dla http.ResponseController (np. zmiana terminu zapisu)
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,333 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry przechowuje metryki i wypisuje je w formacie tekstowym Prometheusa.
+// Metryki z etykietami tworzone są przy pierwszym użyciu danej kombinacji wartości etykiet.
+type Registry struct {
+	mu         sync.Mutex
+	metrics    map[string]metric
+	collectors []func() []Sample
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Rejestr używany przez middleware HTTP i instrumentację bazy
+var Default = NewRegistry()
+
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[m.name()]; ok {
+		panic("metric " + m.name() + " registered twice")
+	}
+	r.metrics[m.name()] = m
+}
+
+// Wartość metryki wyliczana w chwili odczytu (np. statystyki puli połączeń)
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string // gauge lub counter
+	Labels map[string]string
+	Value  float64
+}
+
+// Dodanie funkcji zwracającej metryki wyliczane przy każdym odczycie /metrics
+func (r *Registry) Collect(fn func() []Sample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, fn)
+}
+
+// Funkcja zbierająca metryki, której wynik używany jest ponownie przez ttl. Służy do kosztownych zapytań,
+// aby częste odczyty /metrics (np. z kilku instancji Prometheusa) nie obciążały bazy. Równoczesne odczyty
+// czekają na jedno wyliczenie, a ttl równy 0 oznacza wyliczanie przy każdym odczycie.
+func Cached(ttl time.Duration, fn func() []Sample) func() []Sample {
+	return cached(ttl, time.Now, fn)
+}
+
+func cached(ttl time.Duration, now func() time.Time, fn func() []Sample) func() []Sample {
+	if ttl <= 0 {
+		return fn
+	}
+	var (
+		mu        sync.Mutex
+		samples   []Sample
+		expiresAt time.Time
+	)
+	return func() []Sample {
+		mu.Lock()
+		defer mu.Unlock()
+		if now().Before(expiresAt) {
+			return samples
+		}
+		samples = fn()
+		expiresAt = now().Add(ttl)
+		return samples
+	}
+}
+
+// Wypisanie wszystkich metryk w formacie tekstowym Prometheusa
+func (r *Registry) Write(out io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	collectors := append([]func() []Sample(nil), r.collectors...)
+	r.mu.Unlock()
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		m.write(w)
+	}
+
+	// Próbki z kolektorów grupowane są po nazwie, aby nagłówki HELP i TYPE wystąpiły raz
+	var samples []Sample
+	for _, collect := range collectors {
+		samples = append(samples, collect()...)
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Name < samples[j].Name })
+	for i, sample := range samples {
+		if i == 0 || samples[i-1].Name != sample.Name {
+			writeHeader(w, sample.Name, sample.Help, sample.Type)
+		}
+		writeSample(w, sample.Name, sample.Labels, sample.Value)
+	}
+	return w.Flush()
+}
+
+// Handler endpointu /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(help, "\n", " "), name, typ)
+}
+
+func writeSample(w *bufio.Writer, name string, labels map[string]string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		w.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(key + "=" + strconv.Quote(labels[key]))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Wspólna obsługa serii metryki o danych nazwach etykiet
+type vec struct {
+	metricName string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string][]string // klucz serii -> wartości etykiet
+}
+
+func newVec(name, help string, labelNames []string) vec {
+	return vec{metricName: name, help: help, labelNames: labelNames, series: make(map[string][]string)}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+// Klucz serii dla wartości etykiet. Wywoływane z zablokowanym v.mu.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.metricName, len(v.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := v.series[key]; !ok {
+		v.series[key] = append([]string(nil), values...)
+	}
+	return key
+}
+
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) labels(key string, extra ...string) map[string]string {
+	labels := make(map[string]string, len(v.labelNames)+1)
+	for i, name := range v.labelNames {
+		labels[name] = v.series[key][i]
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		labels[extra[i]] = extra[i+1]
+	}
+	return labels
+}
+
+// Licznik rosnący (np. liczba żądań)
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labelNames), values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[c.key(labelValues)] += value
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metricName, c.help, "counter")
+	for _, key := range c.sortedKeys() {
+		writeSample(w, c.metricName, c.labels(key), c.values[key])
+	}
+}
+
+// Wartość chwilowa (np. liczba trwających żądań)
+type GaugeVec struct {
+	vec
+	values map[string]float64
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{vec: newVec(name, help, labelNames), values: make(map[string]float64)}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(labelValues)] += value
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.values[g.key(labelValues)] = value
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.metricName, g.help, "gauge")
+	for _, key := range g.sortedKeys() {
+		writeSample(w, g.metricName, g.labels(key), g.values[key])
+	}
+}
+
+// Domyślne przedziały histogramów czasu (w sekundach)
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram (np. czas obsługi żądań)
+type HistogramVec struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64 // liczba obserwacji w każdym przedziale (nieskumulowana)
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec:     newVec(name, help, labelNames),
+		buckets: buckets,
+		counts:  make(map[string][]uint64),
+		sums:    make(map[string]float64),
+		totals:  make(map[string]uint64),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := h.key(labelValues)
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		counts[i]++
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metricName, h.help, "histogram")
+	for _, key := range h.sortedKeys() {
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += h.counts[key][i]
+			writeSample(w, h.metricName+"_bucket", h.labels(key, "le", formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, h.metricName+"_bucket", h.labels(key, "le", "+Inf"), float64(h.totals[key]))
+		writeSample(w, h.metricName+"_sum", h.labels(key), h.sums[key])
+		writeSample(w, h.metricName+"_count", h.labels(key), float64(h.totals[key]))
+	}
+}
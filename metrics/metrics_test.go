@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the Prometheus text format of counters, gauges, histograms and collected samples
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "route")
+	requests.Inc("/api/News")
+	requests.Add(2, "/api/News")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.Observe(0.05, "/api/News")
+	latency.Observe(0.5, "/api/News")
+	latency.Observe(3, "/api/News")
+	r.Collect(func() []Sample {
+		return []Sample{{Name: "test_pool_open", Help: "Open.", Type: "gauge", Value: 4}}
+	})
+
+	var out bytes.Buffer
+	assert.NoError(t, r.Write(&out))
+	assert.Equal(t, `# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1",route="/api/News"} 1
+test_latency_seconds_bucket{le="1",route="/api/News"} 2
+test_latency_seconds_bucket{le="+Inf",route="/api/News"} 3
+test_latency_seconds_sum{route="/api/News"} 3.55
+test_latency_seconds_count{route="/api/News"} 3
+# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/api/News"} 3
+# HELP test_pool_open Open.
+# TYPE test_pool_open gauge
+test_pool_open 4
+`, out.String())
+}
+
+// Test labelling requests with the route template instead of the raw path
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/News/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/News/42", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/News/43", nil))
+
+	var out bytes.Buffer
+	assert.NoError(t, Default.Write(&out))
+	assert.Contains(t, out.String(), `news_http_requests_total{method="GET",route="/api/News/{id}",status="404"} 2`)
+	assert.NotContains(t, out.String(), "/api/News/42")
+	assert.True(t, strings.Contains(out.String(), `news_http_request_duration_seconds_count{method="GET",route="/api/News/{id}"} 2`))
+}
+
+// Test reusing collected samples until the cache expires
+func TestCached(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	calls := 0
+	collect := cached(15*time.Second, func() time.Time { return now }, func() []Sample {
+		calls++
+		return []Sample{{Name: "test_items", Type: "gauge", Value: float64(calls)}}
+	})
+
+	assert.Equal(t, float64(1), collect()[0].Value)
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, float64(1), collect()[0].Value)
+	now = now.Add(5 * time.Second)
+	assert.Equal(t, float64(2), collect()[0].Value)
+	assert.Equal(t, 2, calls)
+
+	// Bez czasu ważności wyniki wyliczane są przy każdym odczycie
+	collect = Cached(0, func() []Sample {
+		calls++
+		return nil
+	})
+	collect()
+	collect()
+	assert.Equal(t, 4, calls)
+}
+
+// Test that news counts are reported for every visibility, including missing ones
+func TestNewsSamples(t *testing.T) {
+	samples := newsSamples("central", map[string]map[string]int64{
+		"public": {"published": 5, "trashed": 1, "pinned": 2, "featured": 1},
+		"staff":  {"published": 3},
+	})
+	assert.Len(t, samples, 12)
+	values := make(map[string]float64)
+	for _, sample := range samples {
+		assert.Equal(t, "central", sample.Labels["schema"])
+		values[sample.Labels["visibility"]+"/"+sample.Labels["state"]] = sample.Value
+	}
+	assert.Equal(t, float64(5), values["public/published"])
+	assert.Equal(t, float64(2), values["public/pinned"])
+	assert.Equal(t, float64(3), values["staff/published"])
+	assert.Equal(t, float64(0), values["staff/trashed"])
+	assert.Equal(t, float64(0), values["readers/published"])
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"news/database"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Typy zdarzeń domenowych dotyczących newsów
+const (
+	NewsCreated  = "news.created"
+	NewsUpdated  = "news.updated"
+	NewsDeleted  = "news.deleted"
+	NewsRestored = "news.restored"
+	NewsPurged   = "news.purged"
+)
+
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	NewsID    int             `json:"newsId"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Schema    string          `json:"schema,omitempty"` // schemat filii, z której pochodzi zdarzenie (uzupełniany przy wysyłce)
+}
+
+// Utworzenie zdarzenia z unikalnym identyfikatorem, który pozwala odbiorcom odrzucać duplikaty
+func NewEvent(eventType string, newsID int, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, errors.Wrap(err, "failed to marshal event payload")
+	}
+	id, err := newEventID()
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:        id,
+		Type:      eventType,
+		NewsID:    newsID,
+		Payload:   data,
+		CreatedAt: time.Now().UTC(),
+	}, nil
+}
+
+// Zapisanie zdarzenia w tabeli outbox w ramach transakcji, w której zmieniany jest news
+func Enqueue(ctx context.Context, tx *sql.Tx, schemaName, tableName string, event Event) error {
+	query := fmt.Sprintf(`INSERT INTO "%s"."%s" ("EventId", "EventType", "NewsId", "Payload", "CreatedDate") VALUES ($1, $2, $3, $4, $5)`,
+		schemaName, database.OutboxTableName(tableName))
+	_, err := tx.ExecContext(ctx, query, event.ID, event.Type, event.NewsID, []byte(event.Payload), event.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, "failed to enqueue outbox event")
+	}
+	return nil
+}
+
+// Identyfikator zdarzenia w formacie UUID v4
+func newEventID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", errors.Wrap(err, "failed to generate event id")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
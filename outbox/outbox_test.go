@@ -0,0 +1,200 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	failFor map[string]bool
+	sent    []string
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, event Event) error {
+	if p.failFor[event.ID] {
+		return errors.New("publish failed")
+	}
+	p.sent = append(p.sent, event.ID)
+	return nil
+}
+
+// Test unique event identifiers
+func TestNewEvent(t *testing.T) {
+	first, err := NewEvent(NewsCreated, 1, map[string]int{"id": 1})
+	assert.NoError(t, err)
+	second, err := NewEvent(NewsCreated, 1, map[string]int{"id": 1})
+	assert.NoError(t, err)
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	assert.Regexp(t, uuid, first.ID)
+	assert.NotEqual(t, first.ID, second.ID)
+	assert.JSONEq(t, `{"id":1}`, string(first.Payload))
+}
+
+// Test ordering of events for a single news item after a failure
+func TestPublishInOrder(t *testing.T) {
+	pending := []pendingEvent{
+		{rowID: 1, event: Event{ID: "a1", NewsID: 1}},
+		{rowID: 2, event: Event{ID: "b1", NewsID: 2}},
+		{rowID: 3, event: Event{ID: "a2", NewsID: 1}},
+		{rowID: 4, event: Event{ID: "b2", NewsID: 2}},
+	}
+	publisher := &recordingPublisher{failFor: map[string]bool{"a1": true}}
+
+	results := publishInOrder(context.Background(), publisher, pending)
+
+	//zdarzenie a2 nie może zostać wysłane przed a1
+	assert.Equal(t, []string{"b1", "b2"}, publisher.sent)
+	assert.Len(t, results, 3)
+	assert.Error(t, results[0].err)
+	assert.Equal(t, int64(1), results[0].rowID)
+	for _, result := range results[1:] {
+		assert.NoError(t, result.err)
+	}
+}
+
+// Test releasing events of a claimed batch that were not published after an earlier failure
+func TestSkippedEvents(t *testing.T) {
+	pending := []pendingEvent{
+		{rowID: 1, event: Event{ID: "a1", NewsID: 1}},
+		{rowID: 2, event: Event{ID: "b1", NewsID: 2}},
+		{rowID: 3, event: Event{ID: "a2", NewsID: 1}},
+	}
+	results := publishInOrder(context.Background(), &recordingPublisher{failFor: map[string]bool{"a1": true}}, pending)
+	assert.Equal(t, []int64{3}, skippedEvents(pending, results))
+	assert.Empty(t, skippedEvents(pending[1:2], results))
+
+	// Rezerwacja obejmuje czas wysłania całej paczki
+	assert.Greater(t, claimLease(100), 100*publishTimeout)
+}
+
+// Test dropping an event once it has failed the configured number of times
+func TestRelayExhausted(t *testing.T) {
+	relay := NewRelay(nil, "news", "News", nil, 0, 0, 3)
+	failed := func(attempts int) publishResult {
+		return publishResult{pendingEvent: pendingEvent{rowID: 1, attempts: attempts}, err: errors.New("publish failed")}
+	}
+	assert.False(t, relay.exhausted(failed(0)))
+	assert.False(t, relay.exhausted(failed(1)))
+	assert.True(t, relay.exhausted(failed(2)))
+
+	// Brak limitu w konfiguracji oznacza wartość domyślną
+	assert.Equal(t, 10, NewRelay(nil, "news", "News", nil, 0, 0, 0).MaxAttempts)
+
+	// Porzucone zdarzenie nie blokuje już kolejnych zdarzeń newsa - nie trafia do paczki
+	publisher := &recordingPublisher{}
+	results := publishInOrder(context.Background(), publisher, []pendingEvent{{rowID: 2, attempts: 1, event: Event{ID: "a2", NewsID: 1}}})
+	assert.Equal(t, []string{"a2"}, publisher.sent)
+	assert.Equal(t, 1, results[0].attempts)
+}
+
+// Test HTTP publisher sending the event id as idempotency key
+func TestHTTPPublisher(t *testing.T) {
+	var received Event
+	var key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	event, err := NewEvent(NewsUpdated, 7, map[string]string{"content": "test"})
+	assert.NoError(t, err)
+
+	publisher := &HTTPPublisher{URL: server.URL}
+	assert.NoError(t, publisher.Publish(context.Background(), event))
+	assert.Equal(t, event.ID, key)
+	assert.Equal(t, event.ID, received.ID)
+	assert.Equal(t, 7, received.NewsID)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	publisher = &HTTPPublisher{URL: failing.URL}
+	assert.Error(t, publisher.Publish(context.Background(), event))
+}
+
+// Test NATS publisher against a minimal protocol server
+func TestNATSPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("cannot listen:", err)
+	}
+	defer listener.Close()
+
+	lines := make(chan string, 20)
+	go func() {
+		defer close(lines)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`INFO {"server_id":"test","version":"2.10.0","headers":true,"max_payload":1048576}` + "\r\n"))
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			lines <- line
+			if line == "PING" {
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+
+	event, err := NewEvent(NewsDeleted, 3, map[string]int{"id": 3})
+	assert.NoError(t, err)
+
+	publisher := &NATSPublisher{Address: "nats://" + listener.Addr().String(), Subject: "news.events"}
+	assert.NoError(t, publisher.Publish(context.Background(), event))
+	publisher.Close()
+
+	var received []string
+	for line := range lines {
+		received = append(received, line)
+	}
+	require.NotEmpty(t, received)
+	assert.True(t, strings.HasPrefix(received[0], "CONNECT "))
+	assert.Contains(t, received[0], `"headers":true`)
+	// Wiadomość z nagłówkiem identyfikatora zdarzenia
+	for i, line := range received {
+		if strings.HasPrefix(line, "HPUB ") {
+			assert.True(t, strings.HasPrefix(line, "HPUB news.events.news.deleted "))
+			require.Greater(t, len(received), i+2)
+			assert.Equal(t, "NATS/1.0", received[i+1])
+			assert.Equal(t, "Nats-Msg-Id: "+event.ID, received[i+2])
+			return
+		}
+	}
+	t.Fatalf("no HPUB message in %q", received)
+}
+
+// Test publisher selection from config
+func TestNewPublisher(t *testing.T) {
+	publisher, err := NewPublisher(config.OutboxConfig{})
+	assert.NoError(t, err)
+	assert.IsType(t, LogPublisher{}, publisher)
+
+	_, err = NewPublisher(config.OutboxConfig{Publisher: "http"})
+	assert.Error(t, err)
+
+	_, err = NewPublisher(config.OutboxConfig{Publisher: "kafka"})
+	assert.Error(t, err)
+}
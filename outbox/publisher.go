@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"news/config"
+	"news/logging"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
+
+// Publisher przekazuje zdarzenie do zewnętrznego odbiorcy. Zdarzenie może zostać
+// wysłane więcej niż raz, dlatego odbiorcy powinni rozpoznawać duplikaty po Event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// Utworzenie publishera na podstawie konfiguracji
+func NewPublisher(cfg config.OutboxConfig) (Publisher, error) {
+	switch cfg.Publisher {
+	case "", "log":
+		return LogPublisher{}, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, errors.New("outbox http publisher requires url")
+		}
+		return &HTTPPublisher{URL: cfg.URL, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "nats":
+		if cfg.URL == "" {
+			return nil, errors.New("outbox nats publisher requires url")
+		}
+		return &NATSPublisher{Address: cfg.URL, Subject: cfg.Subject}, nil
+	default:
+		return nil, fmt.Errorf("unknown outbox publisher %q", cfg.Publisher)
+	}
+}
+
+// LogPublisher wypisuje zdarzenia do logu serwera
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(ctx context.Context, event Event) error {
+	logging.Info("outbox event", "id", event.ID, "type", event.Type, "news_id", event.NewsID, "payload", string(event.Payload))
+	return nil
+}
+
+// HTTPPublisher wysyła zdarzenia jako JSON metodą POST pod wskazany adres
+type HTTPPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func (p *HTTPPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create event request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.ID)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to send event")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("event receiver responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// NATSPublisher publikuje zdarzenia na temat Subject.<typ zdarzenia> klientem nats.go.
+// Jeśli serwer obsługuje nagłówki, identyfikator zdarzenia trafia do Nats-Msg-Id,
+// co pozwala JetStream odrzucać ponowione wiadomości.
+type NATSPublisher struct {
+	Address string
+	Subject string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func (p *NATSPublisher) Publish(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal event")
+	}
+	conn, err := p.connection()
+	if err != nil {
+		return err
+	}
+
+	subject := event.Type
+	if p.Subject != "" {
+		subject = p.Subject + "." + event.Type
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = body
+	if conn.HeadersSupported() {
+		msg.Header.Set(nats.MsgIdHdr, event.ID)
+	}
+	if err := conn.PublishMsg(msg); err != nil {
+		return errors.Wrap(err, "failed to publish nats message")
+	}
+
+	// Flush (PING/PONG) potwierdza, że serwer przetworzył wiadomość
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	if err := conn.FlushWithContext(ctx); err != nil {
+		return errors.Wrap(err, "failed to flush nats message")
+	}
+	return nil
+}
+
+// Połączenie z serwerem NATS nawiązywane przy pierwszej publikacji. Po zerwaniu
+// połączenia klient łączy się ponownie sam, a wiadomości czekają w jego buforze.
+func (p *NATSPublisher) connection() (*nats.Conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil && !p.conn.IsClosed() {
+		return p.conn, nil
+	}
+	conn, err := nats.Connect(p.Address, nats.Name("news-outbox"), nats.Timeout(10*time.Second))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to nats")
+	}
+	p.conn = conn
+	return conn, nil
+}
+
+// Zamknięcie połączenia z serwerem NATS
+func (p *NATSPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return nil
+}
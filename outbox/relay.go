@@ -0,0 +1,247 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/database"
+	"news/logging"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Relay cyklicznie odczytuje nieopublikowane zdarzenia z tabeli outbox i przekazuje
+// je do Publishera. Zdarzenie oznaczane jest jako opublikowane dopiero po udanym
+// wysłaniu, więc po awarii może zostać wysłane ponownie (at-least-once). Zdarzenie, którego
+// nie udało się wysłać MaxAttempts razy, jest porzucane (kolumna "FailedDate"), aby nie
+// blokowało kolejnych zdarzeń tego newsa.
+type Relay struct {
+	DB          *sql.DB
+	SchemaName  string
+	TableName   string
+	Publisher   Publisher
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+}
+
+func NewRelay(db *sql.DB, schemaName, tableName string, publisher Publisher, interval time.Duration, batchSize, maxAttempts int) *Relay {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 10
+	}
+	return &Relay{
+		DB:          db,
+		SchemaName:  schemaName,
+		TableName:   tableName,
+		Publisher:   publisher,
+		Interval:    interval,
+		BatchSize:   batchSize,
+		MaxAttempts: maxAttempts,
+	}
+}
+
+// Uruchomienie pętli przekazywania zdarzeń aż do anulowania kontekstu
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayOnce(ctx); err != nil {
+			logging.Error("outbox relay error", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type pendingEvent struct {
+	rowID    int64
+	attempts int // liczba wcześniejszych prób
+	event    Event
+}
+
+type publishResult struct {
+	pendingEvent
+	err error
+}
+
+// Czy po nieudanej próbie zdarzenie ma zostać porzucone
+func (r *Relay) exhausted(result publishResult) bool {
+	return result.attempts+1 >= r.MaxAttempts
+}
+
+// Czas wysyłania jednego zdarzenia
+const publishTimeout = 30 * time.Second
+
+// Jednorazowe przekazanie paczki zdarzeń. Zwraca liczbę opublikowanych zdarzeń.
+// Paczka jest rezerwowana w krótkiej transakcji, wysyłana poza transakcją, a wynik
+// zapisywany w drugiej krótkiej transakcji, więc wysyłka nie blokuje połączenia z bazą.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	pending, err := r.claim(ctx)
+	if err != nil || len(pending) == 0 {
+		return 0, err
+	}
+	results := publishInOrder(ctx, r.Publisher, pending)
+	// Wynik zapisywany jest również przy zamykaniu serwisu, aby wysłane zdarzenia nie zostały wysłane ponownie
+	return r.record(context.WithoutCancel(ctx), pending, results)
+}
+
+// Czas rezerwacji paczki - po jego upływie (np. po awarii instancji) zdarzenia może przejąć inna instancja
+func claimLease(events int) time.Duration {
+	return time.Duration(events)*publishTimeout + time.Minute
+}
+
+// Rezerwacja paczki zdarzeń do wysłania
+func (r *Relay) claim(ctx context.Context) ([]pendingEvent, error) {
+	outboxTable := database.OutboxTableName(r.TableName)
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to begin outbox transaction")
+	}
+	defer tx.Rollback()
+
+	// Blokada doradcza szereguje rezerwacje instancji serwisu. Zdarzenie nie jest rezerwowane, dopóki
+	// wcześniejsze zdarzenie tego newsa jest zarezerwowane przez inną instancję, dzięki czemu zachowana
+	// jest kolejność zdarzeń dla danego newsa
+	var locked bool
+	lockKey := fmt.Sprintf("%s.%s", r.SchemaName, outboxTable)
+	err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock(hashtext($1))`, lockKey).Scan(&locked)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to acquire outbox lock")
+	}
+	if !locked {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`SELECT "Id", "Attempts", "EventId", "EventType", "NewsId", "Payload", "CreatedDate" FROM "%[1]s"."%[2]s" o
+		WHERE "PublishedDate" IS NULL AND "FailedDate" IS NULL AND ("ClaimedUntil" IS NULL OR "ClaimedUntil" < NOW())
+		AND NOT EXISTS (SELECT 1 FROM "%[1]s"."%[2]s" e WHERE e."NewsId"=o."NewsId" AND e."Id"<o."Id"
+			AND e."PublishedDate" IS NULL AND e."FailedDate" IS NULL AND e."ClaimedUntil" >= NOW())
+		ORDER BY "Id" LIMIT $1`,
+		r.SchemaName, outboxTable)
+	rows, err := tx.QueryContext(ctx, query, r.BatchSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read outbox events")
+	}
+	var pending []pendingEvent
+	var ids []int64
+	for rows.Next() {
+		var p pendingEvent
+		var payload []byte
+		err := rows.Scan(&p.rowID, &p.attempts, &p.event.ID, &p.event.Type, &p.event.NewsID, &payload, &p.event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, errors.Wrap(err, "failed to scan outbox event")
+		}
+		p.event.Payload = payload
+		p.event.Schema = r.SchemaName
+		pending = append(pending, p)
+		ids = append(ids, p.rowID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read outbox events")
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	update := fmt.Sprintf(`UPDATE "%s"."%s" SET "ClaimedUntil"=NOW() + $1 * INTERVAL '1 second' WHERE "Id" = ANY($2)`, r.SchemaName, outboxTable)
+	if _, err := tx.ExecContext(ctx, update, claimLease(len(pending)).Seconds(), pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "failed to claim outbox events")
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "failed to commit outbox transaction")
+	}
+	return pending, nil
+}
+
+// Zapisanie wyniku wysyłki i zwolnienie rezerwacji paczki, również zdarzeń pominiętych
+// po błędzie wcześniejszego zdarzenia tego samego newsa
+func (r *Relay) record(ctx context.Context, pending []pendingEvent, results []publishResult) (int, error) {
+	outboxTable := database.OutboxTableName(r.TableName)
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to begin outbox transaction")
+	}
+	defer tx.Rollback()
+
+	published := 0
+	for _, result := range results {
+		if result.err != nil {
+			exhausted := r.exhausted(result)
+			update := fmt.Sprintf(`UPDATE "%s"."%s" SET "Attempts"="Attempts"+1, "LastError"=$1, "FailedDate"=CASE WHEN $2 THEN NOW() END, "ClaimedUntil"=NULL WHERE "Id"=$3`, r.SchemaName, outboxTable)
+			if _, err := tx.ExecContext(ctx, update, result.err.Error(), exhausted, result.rowID); err != nil {
+				return 0, errors.Wrap(err, "failed to record outbox failure")
+			}
+			if exhausted {
+				logging.Error("outbox event dropped after too many attempts", "schema", r.SchemaName, "id", result.event.ID,
+					"type", result.event.Type, "news_id", result.event.NewsID, "attempts", result.attempts+1, "error", result.err)
+			}
+			continue
+		}
+		update := fmt.Sprintf(`UPDATE "%s"."%s" SET "PublishedDate"=NOW(), "Attempts"="Attempts"+1, "LastError"=NULL, "ClaimedUntil"=NULL WHERE "Id"=$1`, r.SchemaName, outboxTable)
+		if _, err := tx.ExecContext(ctx, update, result.rowID); err != nil {
+			return 0, errors.Wrap(err, "failed to mark outbox event as published")
+		}
+		published++
+	}
+	if skipped := skippedEvents(pending, results); len(skipped) > 0 {
+		update := fmt.Sprintf(`UPDATE "%s"."%s" SET "ClaimedUntil"=NULL WHERE "Id" = ANY($1)`, r.SchemaName, outboxTable)
+		if _, err := tx.ExecContext(ctx, update, pq.Array(skipped)); err != nil {
+			return 0, errors.Wrap(err, "failed to release outbox events")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "failed to commit outbox transaction")
+	}
+	return published, nil
+}
+
+// Zdarzenia paczki, których nie próbowano wysłać
+func skippedEvents(pending []pendingEvent, results []publishResult) []int64 {
+	attempted := make(map[int64]bool, len(results))
+	for _, result := range results {
+		attempted[result.rowID] = true
+	}
+	var skipped []int64
+	for _, p := range pending {
+		if !attempted[p.rowID] {
+			skipped = append(skipped, p.rowID)
+		}
+	}
+	return skipped
+}
+
+// Publikacja zdarzeń w kolejności zapisu. Po pierwszym błędzie dla danego newsa
+// kolejne zdarzenia tego newsa są pomijane do następnej próby, aby nie zmienić ich kolejności.
+func publishInOrder(ctx context.Context, publisher Publisher, pending []pendingEvent) []publishResult {
+	results := make([]publishResult, 0, len(pending))
+	blocked := make(map[int]bool)
+	for _, p := range pending {
+		if blocked[p.event.NewsID] {
+			continue
+		}
+		publishCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		err := publisher.Publish(publishCtx, p.event)
+		cancel()
+		if err != nil {
+			blocked[p.event.NewsID] = true
+		}
+		results = append(results, publishResult{pendingEvent: p, err: err})
+	}
+	return results
+}
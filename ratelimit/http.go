@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"news/logging"
+	"news/metrics"
+	"strconv"
+	"time"
+)
+
+var rejected = metrics.Default.NewCounterVec("news_rate_limit_rejected_total",
+	"Number of requests rejected by the rate limiter by budget.", "budget")
+
+// Middleware ograniczające liczbę żądań klienta wskazanego przez key. Żądania GET, HEAD i OPTIONS
+// korzystają z limitu read, pozostałe z limitu write. Odpowiedzi zawierają nagłówki RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset i RateLimit-Policy, a po przekroczeniu limitu zwracany jest
+// kod 429 z nagłówkiem Retry-After. Błąd limitera (np. niedostępna baza) nie blokuje żądań.
+// Limity pobierane są funkcją budgets przy każdym żądaniu (np. CurrentBudgets), aby działało ich przeładowanie.
+func Middleware(limiter Limiter, budgets func() (read, write Budget), key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			read, write := budgets()
+			budget := write
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				budget = read
+			}
+
+			result, err := limiter.Allow(r.Context(), key(r), budget)
+			if err != nil {
+				logging.FromContext(r.Context()).Error("rate limiter unavailable, request allowed", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := w.Header()
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", seconds(result.Reset))
+			header.Set("RateLimit-Policy", strconv.Itoa(budget.Burst)+";w="+seconds(budget.Period))
+			if !result.Allowed {
+				rejected.Inc(budget.Name)
+				header.Set("Retry-After", seconds(result.RetryAfter))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Liczba sekund zaokrąglona w górę, aby klient nie ponowił żądania przed czasem
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
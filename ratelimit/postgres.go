@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/database"
+	"news/logging"
+	"news/tenant"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Limiter przechowujący kubełki w tabeli bazy, dzięki czemu wszystkie instancje serwisu
+// egzekwują wspólny limit. Kubełek uzupełniany i pobierany jest jednym zapytaniem (upsert
+// z blokadą wiersza), a czas liczony jest zegarem bazy, więc różnice zegarów instancji nie mają wpływu.
+// Kubełki przechowywane są w schemacie filii żądania.
+type PostgresLimiter struct {
+	DB         *sql.DB
+	SchemaName string // schemat używany, gdy żądanie nie ma filii
+	TableName  string
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, budget Budget) (Result, error) {
+	schemaName := l.SchemaName
+	if t, ok := tenant.FromContext(ctx); ok {
+		schemaName = t.SchemaName
+	}
+
+	// Uzupełnienie (stan z bazy + czas od ostatniego żądania * tempo, najwyżej Burst) i pobranie żetonu
+	refilled := `LEAST($2::double precision, b."Tokens" + GREATEST(EXTRACT(EPOCH FROM NOW() - b."UpdatedAt")::double precision, 0) * $3::double precision)`
+	query := fmt.Sprintf(`INSERT INTO "%[1]s"."%[2]s" AS b ("Key", "Tokens", "Allowed", "UpdatedAt") VALUES ($1, $2::double precision - 1, TRUE, NOW())
+		ON CONFLICT ("Key") DO UPDATE SET
+			"Tokens" = CASE WHEN %[3]s >= 1 THEN %[3]s - 1 ELSE %[3]s END,
+			"Allowed" = %[3]s >= 1,
+			"UpdatedAt" = NOW()
+		RETURNING "Tokens", "Allowed"`, schemaName, database.RateLimitsTableName(l.TableName), refilled)
+
+	var tokens float64
+	var allowed bool
+	err := l.DB.QueryRowContext(ctx, query, budget.Name+":"+key, float64(budget.Burst), budget.rate()).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, errors.Wrap(err, "failed to check rate limit")
+	}
+	return newResult(budget, tokens, allowed), nil
+}
+
+// Usuwanie co interval kubełków nieużywanych dłużej niż idle (po tym czasie każdy kubełek jest pełny)
+// we wszystkich schematach, aż do anulowania ctx. Idle sprawdzany jest przy każdym czyszczeniu, bo limity mogą się zmienić.
+func (l *PostgresLimiter) RunCleanup(ctx context.Context, schemas []string, idle func() time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, schemaName := range schemas {
+				query := fmt.Sprintf(`DELETE FROM "%s"."%s" WHERE "UpdatedAt" < NOW() - $1 * INTERVAL '1 second'`,
+					schemaName, database.RateLimitsTableName(l.TableName))
+				if _, err := l.DB.ExecContext(ctx, query, idle().Seconds()); err != nil {
+					logging.Error("rate limit cleanup error", "schema", schemaName, "error", err)
+				}
+			}
+		}
+	}
+}
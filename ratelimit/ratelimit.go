@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"news/config"
+	"news/settings"
+	"sync"
+	"time"
+)
+
+// Limit żądań w modelu kubełka żetonów: kubełek mieści Burst żetonów i uzupełnia się
+// o Requests żetonów na Period. Każde żądanie zużywa jeden żeton.
+type Budget struct {
+	Name     string // read lub write, część klucza kubełka
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func BudgetFromConfig(name string, cfg config.RateLimitBudget) Budget {
+	burst := cfg.Burst
+	if burst == 0 {
+		burst = cfg.Requests
+	}
+	return Budget{Name: name, Requests: cfg.Requests, Period: time.Duration(cfg.PeriodSeconds) * time.Second, Burst: burst}
+}
+
+// Aktualne limity odczytu i zapisu - odczytywane przy każdym żądaniu, bo mogą zmienić się po przeładowaniu konfiguracji
+func CurrentBudgets() (read, write Budget) {
+	s := settings.Current()
+	return BudgetFromConfig("read", s.RateLimitRead), BudgetFromConfig("write", s.RateLimitWrite)
+}
+
+// Czas, po którym kubełek bez żądań jest pełny w każdym z aktualnych limitów
+func CurrentIdleTime() time.Duration {
+	read, write := CurrentBudgets()
+	if write.RefillTime() > read.RefillTime() {
+		return write.RefillTime()
+	}
+	return read.RefillTime()
+}
+
+// Czas uzupełnienia pustego kubełka - po tym czasie bez żądań stan kubełka można usunąć
+func (b Budget) RefillTime() time.Duration {
+	return time.Duration(float64(b.Burst) / b.rate() * float64(time.Second))
+}
+
+// Liczba żetonów dodawanych na sekundę
+func (b Budget) rate() float64 {
+	return float64(b.Requests) / b.Period.Seconds()
+}
+
+// Wynik sprawdzenia limitu
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // czas do pełnego uzupełnienia kubełka
+	RetryAfter time.Duration // czas do następnego dozwolonego żądania (tylko gdy Allowed jest false)
+}
+
+func newResult(b Budget, tokens float64, allowed bool) Result {
+	rate := b.rate()
+	result := Result{
+		Allowed:   allowed,
+		Limit:     b.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     time.Duration((float64(b.Burst) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return result
+}
+
+// Uzupełnienie kubełka po upływie elapsed i pobranie żetonu, jeśli jest dostępny
+func take(b Budget, tokens float64, elapsed time.Duration) (float64, bool) {
+	if elapsed > 0 {
+		tokens = math.Min(float64(b.Burst), tokens+elapsed.Seconds()*b.rate())
+	}
+	if tokens >= 1 {
+		return tokens - 1, true
+	}
+	return tokens, false
+}
+
+// Limiter sprawdza i zużywa limit dla klucza (np. user:42 lub ip:10.0.0.1)
+type Limiter interface {
+	Allow(ctx context.Context, key string, budget Budget) (Result, error)
+}
+
+// Co tyle wywołań Allow usuwane są pełne kubełki, aby pamięć nie rosła z liczbą klientów
+const pruneEvery = 1000
+
+// Limiter przechowujący kubełki w pamięci procesu - każda instancja serwisu ma własny limit
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	budget  Budget
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string, budget Budget) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+
+	l.calls++
+	if l.calls%pruneEvery == 0 {
+		l.prune(now)
+	}
+
+	key = budget.Name + ":" + key
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(budget.Burst), updated: now, budget: budget}
+		l.buckets[key] = b
+	}
+	var allowed bool
+	b.tokens, allowed = take(budget, b.tokens, now.Sub(b.updated))
+	b.updated = now
+	// Po przeładowaniu konfiguracji kubełek przechodzi na nowy limit, także przy usuwaniu pełnych kubełków
+	b.budget = budget
+	return newResult(budget, b.tokens, allowed), nil
+}
+
+// Usunięcie kubełków, które zdążyły się uzupełnić - ich brak jest równoważny pełnemu kubełkowi
+func (l *MemoryLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*b.budget.rate() >= float64(b.budget.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
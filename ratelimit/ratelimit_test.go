@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Limiter w pamięci z zegarem sterowanym przez test
+func testLimiter() (*MemoryLimiter, *time.Time) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+// Test the token bucket: burst, refill over time and separate buckets per key and budget
+func TestMemoryLimiter(t *testing.T) {
+	limiter, now := testLimiter()
+	write := BudgetFromConfig("write", config.RateLimitBudget{Requests: 6, PeriodSeconds: 60, Burst: 3})
+	read := BudgetFromConfig("read", config.RateLimitBudget{Requests: 60, PeriodSeconds: 60})
+	assert.Equal(t, 60, read.Burst)
+	ctx := context.Background()
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		result, err := limiter.Allow(ctx, "user:1", write)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+	result, _ := limiter.Allow(ctx, "user:1", write)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 10*time.Second, result.RetryAfter)
+	assert.Equal(t, 30*time.Second, result.Reset)
+
+	// Inny klient i limit odczytu mają własne kubełki
+	result, _ = limiter.Allow(ctx, "user:2", write)
+	assert.True(t, result.Allowed)
+	result, _ = limiter.Allow(ctx, "user:1", read)
+	assert.True(t, result.Allowed)
+
+	// Po 10 sekundach przybywa jeden żeton, a kubełek nie przekracza pojemności
+	*now = now.Add(10 * time.Second)
+	result, _ = limiter.Allow(ctx, "user:1", write)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	*now = now.Add(time.Hour)
+	result, _ = limiter.Allow(ctx, "user:1", write)
+	assert.Equal(t, 2, result.Remaining)
+
+	// Pełne kubełki są usuwane
+	*now = now.Add(write.RefillTime())
+	limiter.prune(*now)
+	assert.Len(t, limiter.buckets, 0)
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, Budget) (Result, error) {
+	return Result{}, errors.New("database unavailable")
+}
+
+// Test response headers, the 429 response and separate budgets for read and write requests
+func TestMiddleware(t *testing.T) {
+	limiter, _ := testLimiter()
+	read := BudgetFromConfig("read", config.RateLimitBudget{Requests: 100, PeriodSeconds: 60})
+	write := BudgetFromConfig("write", config.RateLimitBudget{Requests: 1, PeriodSeconds: 30})
+	key := func(r *http.Request) string { return "ip:10.0.0.7" }
+	budgets := func() (Budget, Budget) { return read, write }
+	handler := Middleware(limiter, budgets, key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/News", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", recorder.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "1;w=30", recorder.Header().Get("RateLimit-Policy"))
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/api/News/1", nil))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "30", recorder.Header().Get("Retry-After"))
+
+	// Odczyt korzysta z osobnego limitu
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/News", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "99", recorder.Header().Get("RateLimit-Remaining"))
+
+	// Przeładowany limit obowiązuje od następnego żądania, bez tworzenia middleware od nowa
+	write = BudgetFromConfig("write", config.RateLimitBudget{Requests: 10, PeriodSeconds: 30, Burst: 5})
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/News", nil))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "5", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "5;w=30", recorder.Header().Get("RateLimit-Policy"))
+
+	// Awaria limitera nie blokuje ruchu
+	handler = Middleware(failingLimiter{}, budgets, key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/News", nil))
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("RateLimit-Limit"))
+}
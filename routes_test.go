@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"news/handlers"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that every route registered in the router is described in the OpenAPI document and vice versa
+func TestOpenAPICoversRoutes(t *testing.T) {
+	cfg := config.Defaults()
+	router := mux.NewRouter()
+	// Handlery nie są wywoływane, więc baza i licznik wyświetleń nie są potrzebne
+	registerRoutes(router, nil, cfg, nil)
+
+	// Dokument pobrany tak jak przez klienta
+	rr := httptest.NewRecorder()
+	handlers.ServeOpenAPI(cfg.Metrics.Path)(rr, httptest.NewRequest(http.MethodGet, handlers.OpenAPIPath, nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var document struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &document))
+	assert.Equal(t, "3.0.3", document.OpenAPI)
+
+	registered := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		for _, method := range methods {
+			method = strings.ToLower(method)
+			registered[method+" "+path] = true
+			_, ok := document.Paths[path][method]
+			assert.True(t, ok, "%s %s is missing in the OpenAPI document", strings.ToUpper(method), path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, registered)
+
+	// Endpointy spoza routera API rejestrowane są bezpośrednio w RunServer
+	root := map[string]bool{"/healthz": true, "/readyz": true, cfg.Metrics.Path: true, handlers.OpenAPIPath: true, handlers.SwaggerUIPath: true}
+	for path, operations := range document.Paths {
+		if root[path] {
+			continue
+		}
+		for method := range operations {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not registered", strings.ToUpper(method), path)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"news/config"
+	"news/logging"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Serwer HTTP z kontrolowanym zamykaniem. Po anulowaniu kontekstu Run przestaje przyjmować
+// nowe połączenia, powiadamia długotrwałe połączenia (np. strumienie SSE) przez Stopping
+// i czeka na dokończenie trwających żądań, najdłużej ShutdownTimeout.
+type Server struct {
+	HTTP            *http.Server
+	Redirect        *http.Server // przekierowanie HTTP -> HTTPS, nil jeśli wyłączone
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	// Wywoływane na początku zamykania, jeszcze przed ShutdownDelay (np. zgłoszenie braku gotowości)
+	OnShutdown func()
+
+	stopping chan struct{}
+}
+
+func New(cfg config.ServerConfig, handler http.Handler) (*Server, error) {
+	s := &Server{
+		ShutdownDelay:   seconds(cfg.ShutdownDelaySeconds),
+		ShutdownTimeout: seconds(cfg.ShutdownTimeoutSeconds),
+		stopping:        make(chan struct{}),
+	}
+	s.HTTP = &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadTimeout:       seconds(cfg.ReadTimeoutSeconds),
+		ReadHeaderTimeout: seconds(cfg.ReadHeaderTimeoutSeconds),
+		WriteTimeout:      seconds(cfg.WriteTimeoutSeconds),
+		IdleTimeout:       seconds(cfg.IdleTimeoutSeconds),
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		ErrorLog:          logging.StdLogger(logging.LevelWarn),
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), stoppingKey{}, s.stopping)
+		},
+	}
+
+	if cfg.TLS.Enabled() {
+		tlsConfig, err := NewTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		s.HTTP.TLSConfig = tlsConfig
+		if cfg.TLS.RedirectAddress != "" {
+			s.Redirect = &http.Server{
+				Addr:              cfg.TLS.RedirectAddress,
+				Handler:           RedirectHandler(cfg.Address),
+				ReadHeaderTimeout: s.HTTP.ReadHeaderTimeout,
+				IdleTimeout:       s.HTTP.IdleTimeout,
+				ErrorLog:          s.HTTP.ErrorLog,
+			}
+		}
+	}
+	return s, nil
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// Obsługa połączeń na skonfigurowanym adresie do czasu anulowania ctx
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.HTTP.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", s.HTTP.Addr)
+	}
+
+	if s.Redirect != nil {
+		redirectListener, err := net.Listen("tcp", s.Redirect.Addr)
+		if err != nil {
+			listener.Close()
+			return errors.Wrapf(err, "failed to listen on %s", s.Redirect.Addr)
+		}
+		go func() {
+			if err := s.Redirect.Serve(redirectListener); err != http.ErrServerClosed {
+				logging.Error("redirect server error", "error", err)
+			}
+		}()
+		// Przekierowania nie mają trwających żądań wartych oczekiwania
+		defer s.Redirect.Close()
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Obsługa połączeń z podanego listenera do czasu anulowania ctx
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	served := make(chan error, 1)
+	go func() {
+		if s.HTTP.TLSConfig != nil {
+			// Certyfikat dostarcza TLSConfig.GetCertificate, dlatego ścieżki plików są puste
+			served <- s.HTTP.ServeTLS(listener, "", "")
+			return
+		}
+		served <- s.HTTP.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Przez ShutdownDelay serwer nadal obsługuje ruch, aby orkiestrator zdążył zauważyć brak gotowości
+	// i przestał kierować nowe żądania do tej instancji
+	if s.OnShutdown != nil {
+		s.OnShutdown()
+	}
+	if s.ShutdownDelay > 0 {
+		logging.Info("Zamykanie serwera", "delay", s.ShutdownDelay.String())
+		time.Sleep(s.ShutdownDelay)
+	}
+
+	logging.Info("Zamykanie serwera, oczekiwanie na zakończenie trwających żądań")
+	close(s.stopping)
+	shutdownCtx := context.Background()
+	if s.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, s.ShutdownTimeout)
+		defer cancel()
+	}
+	if err := s.HTTP.Shutdown(shutdownCtx); err != nil {
+		// Połączenia, które nie zakończyły się w wyznaczonym czasie, są zamykane
+		s.HTTP.Close()
+		return errors.Wrap(err, "graceful shutdown did not finish")
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+type stoppingKey struct{}
+
+// Kanał zamykany w chwili rozpoczęcia zamykania serwera. Handlery utrzymujące połączenie
+// (np. strumienie SSE) powinny wtedy zakończyć odpowiedź, aby nie blokować zamknięcia.
+// Dla żądań spoza Server zwracany jest nil, z którego odczyt nigdy się nie kończy.
+func Stopping(ctx context.Context) <-chan struct{} {
+	stopping, _ := ctx.Value(stoppingKey{}).(chan struct{})
+	return stopping
+}
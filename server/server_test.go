@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"news/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startServer(t *testing.T, cfg config.ServerConfig, handler http.Handler) (string, context.CancelFunc, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	s, err := New(cfg, handler)
+	assert.NoError(t, err)
+	go func() { done <- s.Serve(ctx, listener) }()
+	return "http://" + listener.Addr().String(), cancel, done
+}
+
+// Test that shutdown waits for an in-flight request to finish
+func TestGracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	url, cancel, done := startServer(t, config.ServerConfig{ShutdownTimeoutSeconds: 5}, handler)
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		response <- string(body)
+	}()
+
+	<-started
+	cancel()
+	assert.Equal(t, "done", <-response)
+	assert.NoError(t, <-done)
+}
+
+// Test that long-lived handlers are notified when the server stops
+func TestStoppingNotifiesStreams(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-Stopping(r.Context()):
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+		}
+	})
+	url, cancel, done := startServer(t, config.ServerConfig{ShutdownTimeoutSeconds: 2}, handler)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	start := time.Now()
+	cancel()
+	assert.Equal(t, http.StatusOK, <-status)
+	assert.NoError(t, <-done)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.Nil(t, Stopping(context.Background()))
+}
+
+// Test applying timeouts and limits from the configuration
+func TestNew(t *testing.T) {
+	cfg := config.Defaults().Server
+	s, err := New(cfg, http.NotFoundHandler())
+	assert.NoError(t, err)
+	assert.Nil(t, s.HTTP.TLSConfig)
+	assert.Nil(t, s.Redirect)
+	assert.Equal(t, ":8080", s.HTTP.Addr)
+	assert.Equal(t, 15*time.Second, s.HTTP.ReadTimeout)
+	assert.Equal(t, 120*time.Second, s.HTTP.IdleTimeout)
+	assert.Equal(t, 1<<20, s.HTTP.MaxHeaderBytes)
+	assert.Equal(t, 30*time.Second, s.ShutdownTimeout)
+}
+
+// Test that the server keeps serving during the shutdown delay after reporting not ready
+func TestShutdownDelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	s, err := New(config.ServerConfig{ShutdownTimeoutSeconds: 1}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.NoError(t, err)
+	s.ShutdownDelay = 200 * time.Millisecond
+	notified := make(chan struct{})
+	s.OnShutdown = func() { close(notified) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, listener) }()
+	cancel()
+
+	<-notified
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.NoError(t, <-done)
+}
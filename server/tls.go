@@ -0,0 +1,121 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"news/config"
+	"news/logging"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertReloader dostarcza certyfikat serwera dla połączeń TLS i wczytuje go ponownie, gdy pliki
+// certyfikatu lub klucza zostaną podmienione (np. po odnowieniu certyfikatu). Jeśli nowe pliki są
+// niepoprawne, nadal używany jest poprzedni certyfikat.
+type CertReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	version [2]time.Time
+	checked time.Time
+}
+
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	reloader := &CertReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (c *CertReloader) load() error {
+	version := c.fileVersion()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load TLS certificate")
+	}
+	c.cert, c.version, c.checked = &cert, version, time.Now()
+	return nil
+}
+
+func (c *CertReloader) fileVersion() [2]time.Time {
+	var version [2]time.Time
+	for i, path := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(path); err == nil {
+			version[i] = info.ModTime()
+		}
+	}
+	return version
+}
+
+// Funkcja dla tls.Config.GetCertificate. Zmiana plików sprawdzana jest najwyżej raz na interval.
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) >= c.interval {
+		c.checked = time.Now()
+		if c.fileVersion() != c.version {
+			if err := c.load(); err != nil {
+				logging.Error("Nie udało się wczytać nowego certyfikatu, używany jest poprzedni", "cert_file", c.certFile, "error", err)
+			} else {
+				logging.Info("Wczytano nowy certyfikat TLS", "cert_file", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+// Konfiguracja TLS serwera: certyfikat z automatycznym przeładowaniem i opcjonalna weryfikacja certyfikatów klientów
+func NewTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	certs, err := NewCertReloader(cfg.CertFile, cfg.KeyFile, seconds(cfg.CertCheckIntervalSeconds))
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+
+	switch cfg.ClientAuth {
+	case config.ClientAuthOptional:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return tlsConfig, nil
+	}
+	pem, err := ioutil.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read client CA file")
+	}
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	return tlsConfig, nil
+}
+
+// Handler przekierowujący żądania HTTP na ten sam adres w HTTPS. Port HTTPS pobierany jest z httpsAddress.
+func RedirectHandler(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
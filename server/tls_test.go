@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Zapis certyfikatu z kluczem w formacie PEM. Bez parent certyfikat jest samopodpisany.
+func writeCert(t *testing.T, dir, name, commonName string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return cert, key, certFile, keyFile
+}
+
+// Test picking up a rotated certificate and keeping the old one when the new files are broken
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	_, _, certFile, keyFile := writeCert(t, dir, "server", "first", nil, nil)
+	reloader, err := NewCertReloader(certFile, keyFile, 0)
+	assert.NoError(t, err)
+	cert, _ := reloader.GetCertificate(nil)
+	first, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "first", first.Subject.CommonName)
+
+	writeCert(t, dir, "server", "second", nil, nil)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	cert, _ = reloader.GetCertificate(nil)
+	second, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", second.Subject.CommonName)
+
+	assert.NoError(t, ioutil.WriteFile(keyFile, []byte("broken"), 0600))
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	cert, err = reloader.GetCertificate(nil)
+	assert.NoError(t, err)
+	current, _ := x509.ParseCertificate(cert.Certificate[0])
+	assert.Equal(t, "second", current.Subject.CommonName)
+}
+
+// Test serving HTTPS with a required client certificate
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caFile, _ := writeCert(t, dir, "ca", "Test CA", nil, nil)
+	_, _, serverCert, serverKey := writeCert(t, dir, "server", "localhost", ca, caKey)
+	_, _, clientCert, clientKey := writeCert(t, dir, "client", "catalog-service", ca, caKey)
+
+	cfg := config.ServerConfig{
+		ShutdownTimeoutSeconds: 1,
+		TLS: config.TLSConfig{
+			CertFile:     serverCert,
+			KeyFile:      serverKey,
+			ClientAuth:   config.ClientAuthRequire,
+			ClientCAFile: caFile,
+		},
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	})
+	s, err := New(cfg, handler)
+	assert.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, listener) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	assert.NoError(t, err)
+	url := "https://" + listener.Addr().String()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{pair}}}}
+	resp, err := client.Get(url)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "catalog-service", string(body))
+	}
+
+	// Bez certyfikatu klienta połączenie jest odrzucane
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = client.Get(url)
+	assert.Error(t, err)
+}
+
+// Test redirecting plain HTTP requests to HTTPS
+func TestRedirectHandler(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	RedirectHandler(":8443").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://news.example:8080/api/News?limit=5", nil))
+	assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+	assert.Equal(t, "https://news.example:8443/api/News?limit=5", recorder.Header().Get("Location"))
+
+	recorder = httptest.NewRecorder()
+	RedirectHandler(":443").ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://news.example/api/News", nil))
+	assert.Equal(t, "https://news.example/api/News", recorder.Header().Get("Location"))
+}
@@ -0,0 +1,115 @@
+package settings
+
+import (
+	"context"
+	"news/config"
+	"news/logging"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reloader przeładowuje konfigurację z pliku po sygnale SIGHUP lub zmianie pliku.
+// Niepoprawna konfiguracja jest odrzucana, a serwis działa dalej z poprzednimi ustawieniami.
+// Zmiany pól bez tagu reload są tylko logowane - wymagają restartu serwisu.
+type Reloader struct {
+	load func() (config.Config, error)
+
+	mu     sync.Mutex
+	config config.Config
+}
+
+// Reloader z konfiguracją, z którą uruchomiono serwis. Funkcja load składa i waliduje nową konfigurację (np. Flags.Load).
+func NewReloader(initial config.Config, load func() (config.Config, error)) *Reloader {
+	Store(FromConfig(initial))
+	return &Reloader{load: load, config: initial}
+}
+
+// Przeładowanie konfiguracji. Zwraca listę zmian lub błąd, jeśli nowa konfiguracja została odrzucona.
+func (r *Reloader) Reload() ([]config.Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.load()
+	if err != nil {
+		logging.Error("Odrzucono nową konfigurację, serwis działa z poprzednią", "error", err)
+		return nil, err
+	}
+
+	changes := config.Diff(r.config, cfg)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		if change.Reloaded {
+			logging.Info("Zmieniono ustawienie", "change", change)
+		} else {
+			logging.Warn("Zmiana wymaga restartu serwisu", "change", change)
+		}
+	}
+
+	// Przejmowane są tylko pola z tagiem reload. Pozostałe zachowują dotychczasową wartość,
+	// dzięki czemu kolejne przeładowania nadal zgłaszają, że serwis wymaga restartu.
+	applied := r.config
+	applied.CORS = cfg.CORS
+	applied.LogLevel = cfg.LogLevel
+	applied.JWT = cfg.JWT
+	applied.Features = cfg.Features
+	applied.Server.TLS.ClientRoles = cfg.Server.TLS.ClientRoles
+	applied.Server.TLS.ClientTenants = cfg.Server.TLS.ClientTenants
+	applied.Server.TrustedProxies = cfg.Server.TrustedProxies
+	applied.RateLimit.Read = cfg.RateLimit.Read
+	applied.RateLimit.Write = cfg.RateLimit.Write
+	Store(FromConfig(applied))
+	r.config = applied
+	return changes, nil
+}
+
+// Przeładowywanie konfiguracji po sygnale SIGHUP oraz po zmianie pliku path (sprawdzanej co interval)
+// aż do anulowania ctx. Interval równy 0 wyłącza obserwowanie pliku.
+func (r *Reloader) Watch(ctx context.Context, path string, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	last := fileVersion(path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logging.Info("Otrzymano SIGHUP, przeładowanie konfiguracji")
+			last = fileVersion(path)
+			r.Reload()
+		case <-tick:
+			if version := fileVersion(path); version != last {
+				last = version
+				logging.Info("Plik konfiguracyjny został zmieniony, przeładowanie konfiguracji", "path", path)
+				r.Reload()
+			}
+		}
+	}
+}
+
+type version struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileVersion(path string) version {
+	info, err := os.Stat(path)
+	if err != nil {
+		return version{}
+	}
+	return version{modTime: info.ModTime(), size: info.Size()}
+}
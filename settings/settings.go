@@ -0,0 +1,107 @@
+package settings
+
+import (
+	"net"
+	"news/config"
+	"news/logging"
+	"sync/atomic"
+)
+
+// Ustawienia, które można zmienić bez restartu serwisu. Handlery odczytują je przy każdym żądaniu
+// przez Current, a Reloader podmienia całą wartość atomowo po poprawnym przeładowaniu konfiguracji.
+type Settings struct {
+	AllowedOrigins []string
+	LogLevel       string
+	JWTSecrets     [][]byte // aktualny klucz, a po nim poprzednie
+	Features       map[string]bool
+	ClientRoles    map[string]string // podmiot certyfikatu klienta -> rola
+	ClientTenants  map[string]string // podmiot certyfikatu klienta -> filia
+	TrustedProxies []*net.IPNet      // proxy, którym wolno podać adres klienta w X-Forwarded-For
+	RateLimitRead  config.RateLimitBudget
+	RateLimitWrite config.RateLimitBudget
+}
+
+var current atomic.Value
+
+// Ustawienia zbudowane z konfiguracji
+func FromConfig(cfg config.Config) *Settings {
+	s := &Settings{
+		AllowedOrigins: append([]string(nil), cfg.CORS.AllowedOrigins...),
+		LogLevel:       cfg.LogLevel,
+		RateLimitRead:  cfg.RateLimit.Read,
+		RateLimitWrite: cfg.RateLimit.Write,
+		Features:       make(map[string]bool, len(cfg.Features)),
+		ClientRoles:    make(map[string]string, len(cfg.Server.TLS.ClientRoles)),
+		ClientTenants:  make(map[string]string, len(cfg.Server.TLS.ClientTenants)),
+	}
+	for _, secret := range append([]string{cfg.JWT.Secret}, cfg.JWT.PreviousSecrets...) {
+		if secret != "" {
+			s.JWTSecrets = append(s.JWTSecrets, []byte(secret))
+		}
+	}
+	for feature, enabled := range cfg.Features {
+		s.Features[feature] = enabled
+	}
+	for subject, role := range cfg.Server.TLS.ClientRoles {
+		s.ClientRoles[subject] = role
+	}
+	for subject, tenant := range cfg.Server.TLS.ClientTenants {
+		s.ClientTenants[subject] = tenant
+	}
+	// Konfiguracja jest sprawdzona przez Validate, więc błędne wpisy nie powinny tu trafić
+	s.TrustedProxies, _ = config.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	return s
+}
+
+// Aktualne ustawienia. Przed pierwszym Store zwracane są ustawienia z wartości domyślnych konfiguracji.
+func Current() *Settings {
+	if s, ok := current.Load().(*Settings); ok {
+		return s
+	}
+	return defaults
+}
+
+var defaults = FromConfig(config.Defaults())
+
+// Podmiana aktualnych ustawień
+func Store(s *Settings) {
+	current.Store(s)
+	logging.SetLevel(s.LogLevel)
+}
+
+// Czy funkcja jest włączona (brak wpisu w konfiguracji oznacza funkcję włączoną)
+func (s *Settings) Enabled(feature string) bool {
+	enabled, ok := s.Features[feature]
+	return !ok || enabled
+}
+
+// Czy żądania z danego adresu (nagłówek Origin) są dozwolone przez CORS
+func (s *Settings) OriginAllowed(origin string) bool {
+	for _, allowed := range s.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// Czy komunikaty o danym poziomie powinny być logowane
+func (s *Settings) LogEnabled(level string) bool {
+	messageLevel, _ := logging.ParseLevel(level)
+	minLevel, _ := logging.ParseLevel(s.LogLevel)
+	return messageLevel >= minLevel
+}
+
+// Czy adres należy do zaufanego proxy
+func (s *Settings) TrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range s.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
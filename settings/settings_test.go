@@ -0,0 +1,77 @@
+package settings
+
+import (
+	"io/ioutil"
+	"news/config"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test building runtime settings from the configuration
+func TestFromConfig(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.CORS.AllowedOrigins = []string{"https://library.example"}
+	cfg.JWT.Secret = "current"
+	cfg.JWT.PreviousSecrets = []string{"old"}
+	cfg.Features = map[string]bool{config.FeatureReactions: false}
+	cfg.Server.TrustedProxies = []string{"10.0.0.0/8", "192.0.2.1"}
+	cfg.RateLimit.Read.Requests = 500
+
+	s := FromConfig(cfg)
+	assert.Equal(t, [][]byte{[]byte("current"), []byte("old")}, s.JWTSecrets)
+	assert.True(t, s.OriginAllowed("https://library.example"))
+	assert.False(t, s.OriginAllowed("https://evil.example"))
+	assert.False(t, s.Enabled(config.FeatureReactions))
+	assert.True(t, s.Enabled(config.FeatureComments))
+	assert.True(t, s.LogEnabled("info"))
+	assert.False(t, s.LogEnabled("debug"))
+	assert.True(t, s.TrustedProxy("10.1.2.3"))
+	assert.True(t, s.TrustedProxy("192.0.2.1"))
+	assert.False(t, s.TrustedProxy("192.0.2.2"))
+	assert.False(t, s.TrustedProxy("not-an-ip"))
+	assert.Equal(t, 500, s.RateLimitRead.Requests)
+	assert.Equal(t, cfg.RateLimit.Write, s.RateLimitWrite)
+
+	assert.True(t, FromConfig(config.Defaults()).OriginAllowed("https://any.example"))
+}
+
+// Test that a reload applies runtime settings, keeps structural fields and rejects invalid configs
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	load := func() (config.Config, error) {
+		os.Setenv(config.PathEnv, path)
+		defer os.Unsetenv(config.PathEnv)
+		return config.Load(nil)
+	}
+
+	write(`{"host": "db", "user": "news", "dbname": "news", "schemaName": "news", "tableName": "News"}`)
+	initial, err := load()
+	assert.NoError(t, err)
+	reloader := NewReloader(initial, load)
+	t.Cleanup(func() { Store(FromConfig(config.Defaults())) })
+
+	write(`{"host": "db2", "user": "news", "dbname": "news", "schemaName": "news", "tableName": "News",
+		"logLevel": "debug", "cors": {"allowedOrigins": ["https://library.example"]},
+		"rateLimit": {"enabled": false, "write": {"requests": 5, "periodSeconds": 60}}}`)
+	changes, err := reloader.Reload()
+	assert.NoError(t, err)
+	assert.Len(t, changes, 5)
+	assert.Equal(t, "debug", Current().LogLevel)
+	assert.False(t, Current().OriginAllowed("https://evil.example"))
+	assert.Equal(t, "db", reloader.config.Host)
+	// Limity są przeładowywane, a ich włączenie wymaga restartu
+	assert.Equal(t, 5, Current().RateLimitWrite.Requests)
+	assert.True(t, reloader.config.RateLimit.Enabled)
+
+	// Niepoprawna konfiguracja nie zmienia aktualnych ustawień
+	write(`{"host": "db", "user": "news", "dbname": "news", "schemaName": "news", "tableName": "News", "logLevel": "loud"}`)
+	_, err = reloader.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "debug", Current().LogLevel)
+}
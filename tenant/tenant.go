@@ -0,0 +1,180 @@
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"news/config"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Nazwa jedynej filii, gdy konfiguracja nie zawiera listy filii
+const DefaultName = "default"
+
+var (
+	ErrUnknownTenant  = errors.New("unknown tenant")
+	ErrTenantMismatch = errors.New("tenant mismatch")
+	ErrNoTenant       = errors.New("tenant could not be resolved")
+	ErrMissingClaim   = errors.New("identity is not assigned to a tenant")
+)
+
+// Filia biblioteki i schemat bazy z jej danymi
+type Tenant struct {
+	Name       string
+	SchemaName string
+}
+
+// Odczytanie nazwy filii z tożsamości żądania (token JWT lub certyfikat klienta). Zwraca false, jeśli
+// żądanie nie ma poprawnej tożsamości, oraz pustą nazwę, jeśli tożsamość nie jest przypisana do filii.
+type ClaimFunc func(r *http.Request) (string, bool)
+
+// Resolver ustala filię żądania na podstawie prefiksu ścieżki (/{filia}/api/...), nagłówka Host
+// oraz nazwy filii z tożsamości żądania. Jeśli źródła wskazują różne filie, żądanie jest odrzucane.
+// Gdy skonfigurowano filie, uwierzytelnione żądanie bez przypisanej filii jest odrzucane, aby token
+// bez oświadczenia tenant nie dawał dostępu do dowolnej filii.
+type Resolver struct {
+	tenants       map[string]Tenant
+	hosts         map[string]string
+	defaultTenant string
+	claim         ClaimFunc
+	requireClaim  bool
+}
+
+func NewResolver(cfg config.Config, claim ClaimFunc) (*Resolver, error) {
+	resolver := &Resolver{
+		tenants:       make(map[string]Tenant),
+		hosts:         make(map[string]string),
+		defaultTenant: cfg.DefaultTenant,
+		claim:         claim,
+		requireClaim:  len(cfg.Tenants) > 0,
+	}
+
+	// Bez listy filii serwis działa jak dotychczas - na jednym schemacie z konfiguracji
+	if len(cfg.Tenants) == 0 {
+		resolver.tenants[DefaultName] = Tenant{Name: DefaultName, SchemaName: cfg.SchemaName}
+		resolver.defaultTenant = DefaultName
+		return resolver, nil
+	}
+
+	schemas := make(map[string]string)
+	for _, tenantConfig := range cfg.Tenants {
+		name := tenantConfig.Name
+		if name == "" || name == "api" || strings.Contains(name, "/") {
+			return nil, errors.Errorf("invalid tenant name %q", name)
+		}
+		if tenantConfig.SchemaName == "" {
+			return nil, errors.Errorf("tenant %s has no schema", name)
+		}
+		if _, ok := resolver.tenants[name]; ok {
+			return nil, errors.Errorf("duplicate tenant %s", name)
+		}
+		if other, ok := schemas[tenantConfig.SchemaName]; ok {
+			return nil, errors.Errorf("tenants %s and %s share schema %s", other, name, tenantConfig.SchemaName)
+		}
+		schemas[tenantConfig.SchemaName] = name
+		resolver.tenants[name] = Tenant{Name: name, SchemaName: tenantConfig.SchemaName}
+
+		for _, host := range tenantConfig.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := resolver.hosts[host]; ok {
+				return nil, errors.Errorf("host %s is assigned to tenants %s and %s", host, other, name)
+			}
+			resolver.hosts[host] = name
+		}
+	}
+	if resolver.defaultTenant != "" {
+		if _, ok := resolver.tenants[resolver.defaultTenant]; !ok {
+			return nil, errors.Errorf("default tenant %s is not configured", resolver.defaultTenant)
+		}
+	}
+	return resolver, nil
+}
+
+// Ustalenie filii żądania. Zwraca również ścieżkę bez prefiksu filii.
+func (res *Resolver) Resolve(r *http.Request) (Tenant, string, error) {
+	path := r.URL.Path
+	var names []string
+
+	// Prefiks ścieżki /{filia}/api/...
+	if parts := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2); len(parts) == 2 && strings.HasPrefix(parts[1], "api/") {
+		if _, ok := res.tenants[parts[0]]; ok {
+			names = append(names, parts[0])
+			path = "/" + parts[1]
+		}
+	}
+
+	// Nagłówek Host
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if name, ok := res.hosts[host]; ok {
+		names = append(names, name)
+	}
+
+	// Tożsamość żądania - niepoprawny token jest pomijany, odrzucą go handlery wymagające uwierzytelnienia
+	if res.claim != nil {
+		if name, ok := res.claim(r); ok {
+			switch {
+			case name != "":
+				if _, ok := res.tenants[name]; !ok {
+					return Tenant{}, path, ErrUnknownTenant
+				}
+				names = append(names, name)
+			case res.requireClaim:
+				return Tenant{}, path, ErrMissingClaim
+			}
+		}
+	}
+
+	if len(names) > 0 {
+		for _, name := range names {
+			if name != names[0] {
+				return Tenant{}, path, ErrTenantMismatch
+			}
+		}
+		return res.tenants[names[0]], path, nil
+	}
+	if res.defaultTenant != "" {
+		return res.tenants[res.defaultTenant], path, nil
+	}
+	return Tenant{}, path, ErrNoTenant
+}
+
+// Middleware zapisujące filię w kontekście żądania i usuwające prefiks filii ze ścieżki
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t, path, err := res.Resolve(r)
+		switch err {
+		case nil:
+		case ErrTenantMismatch, ErrUnknownTenant, ErrMissingClaim:
+			http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r = r.WithContext(WithTenant(r.Context(), t))
+		if path != r.URL.Path {
+			url := *r.URL
+			url.Path = path
+			url.RawPath = ""
+			r.URL = &url
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type contextKey struct{}
+
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(Tenant)
+	return t, ok
+}
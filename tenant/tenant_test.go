@@ -0,0 +1,167 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"news/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testConfig() config.Config {
+	return config.Config{
+		SchemaName: "news",
+		Tenants: []config.TenantConfig{
+			{Name: "central", SchemaName: "central", Hosts: []string{"central.library.example"}},
+			{Name: "north", SchemaName: "north", Hosts: []string{"north.library.example"}},
+		},
+	}
+}
+
+// Claim function returning the tenant from the X-Test-Tenant header, the request is authenticated when the header is present
+func headerClaim(r *http.Request) (string, bool) {
+	values, ok := r.Header["X-Test-Tenant"]
+	if !ok {
+		return "", false
+	}
+	return values[0], true
+}
+
+// Test resolving the tenant from the path prefix, host header and token claim
+func TestResolve(t *testing.T) {
+	resolver, err := NewResolver(testConfig(), headerClaim)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/north/api/News/1", nil)
+	tenant, path, err := resolver.Resolve(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "north", tenant.SchemaName)
+	assert.Equal(t, "/api/News/1", path)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Host = "Central.Library.Example:8080"
+	tenant, path, err = resolver.Resolve(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "central", tenant.Name)
+	assert.Equal(t, "/api/News", path)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("X-Test-Tenant", "north")
+	tenant, _, err = resolver.Resolve(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "north", tenant.Name)
+}
+
+// Test that a request cannot mix tenants from different sources
+func TestResolveIsolation(t *testing.T) {
+	resolver, err := NewResolver(testConfig(), headerClaim)
+	assert.NoError(t, err)
+
+	// Token filii north użyty na adresie filii central
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Host = "central.library.example"
+	req.Header.Set("X-Test-Tenant", "north")
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrTenantMismatch, err)
+
+	// Prefiks ścieżki innej filii niż host
+	req = httptest.NewRequest(http.MethodGet, "/north/api/News", nil)
+	req.Host = "central.library.example"
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrTenantMismatch, err)
+
+	// Token filii, która nie jest obsługiwana przez ten proces
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("X-Test-Tenant", "south")
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrUnknownTenant, err)
+
+	// Bez żadnej wskazówki i bez filii domyślnej
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrNoTenant, err)
+
+	// Uwierzytelnione żądanie bez przypisanej filii nie może wybrać filii prefiksem ani hostem
+	req = httptest.NewRequest(http.MethodGet, "/north/api/News", nil)
+	req.Header.Set("X-Test-Tenant", "")
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrMissingClaim, err)
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Host = "central.library.example"
+	req.Header.Set("X-Test-Tenant", "")
+	_, _, err = resolver.Resolve(req)
+	assert.Equal(t, ErrMissingClaim, err)
+}
+
+// Test the default tenant and single-tenant fallback
+func TestResolveDefault(t *testing.T) {
+	cfg := testConfig()
+	cfg.DefaultTenant = "central"
+	resolver, err := NewResolver(cfg, nil)
+	assert.NoError(t, err)
+	tenant, _, err := resolver.Resolve(httptest.NewRequest(http.MethodGet, "/api/News", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "central", tenant.SchemaName)
+
+	resolver, err = NewResolver(config.Config{SchemaName: "news"}, headerClaim)
+	assert.NoError(t, err)
+	tenant, _, err = resolver.Resolve(httptest.NewRequest(http.MethodGet, "/api/News", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, Tenant{Name: DefaultName, SchemaName: "news"}, tenant)
+
+	// Bez listy filii token nie musi wskazywać filii
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("X-Test-Tenant", "")
+	tenant, _, err = resolver.Resolve(req)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultName, tenant.Name)
+}
+
+// Test rejecting ambiguous tenant configuration
+func TestNewResolverValidation(t *testing.T) {
+	cfg := testConfig()
+	cfg.Tenants[1].SchemaName = "central"
+	_, err := NewResolver(cfg, nil)
+	assert.Error(t, err)
+
+	cfg = testConfig()
+	cfg.Tenants[1].Hosts = []string{"central.library.example"}
+	_, err = NewResolver(cfg, nil)
+	assert.Error(t, err)
+
+	cfg = testConfig()
+	cfg.Tenants[0].Name = "api"
+	_, err = NewResolver(cfg, nil)
+	assert.Error(t, err)
+
+	cfg = testConfig()
+	cfg.DefaultTenant = "south"
+	_, err = NewResolver(cfg, nil)
+	assert.Error(t, err)
+}
+
+// Test that the middleware stores the tenant in the context and strips the path prefix
+func TestMiddleware(t *testing.T) {
+	resolver, err := NewResolver(testConfig(), headerClaim)
+	assert.NoError(t, err)
+
+	var got Tenant
+	var gotPath string
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+		gotPath = r.URL.Path
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/central/api/News", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "central", got.SchemaName)
+	assert.Equal(t, "/api/News", gotPath)
+
+	req := httptest.NewRequest(http.MethodGet, "/central/api/News", nil)
+	req.Header.Set("X-Test-Tenant", "north")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+}
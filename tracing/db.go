@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"news/database"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Hook instrumentacji bazy tworzący span dla zapytań wykonywanych w ramach śledzonego żądania
+// (zob. database.AddQueryHook). Zapytania zadań w tle nie mają spanu rodzica i nie są śledzone.
+func (t *Tracer) QueryHook(ctx context.Context, stmt database.Statement) (context.Context, func(int64, error)) {
+	if !trace.SpanFromContext(ctx).SpanContext().IsSampled() {
+		return ctx, func(int64, error) {}
+	}
+
+	name := stmt.Operation
+	attributes := []attribute.KeyValue{semconv.DBSystemNamePostgreSQL, semconv.DBOperationName(stmt.Operation), semconv.DBQueryText(stmt.Query)}
+	if stmt.Table != "" {
+		name += " " + stmt.Table
+		attributes = append(attributes, semconv.DBCollectionName(stmt.Table))
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	return ctx, func(rows int64, err error) {
+		if rows >= 0 {
+			span.SetAttributes(attribute.Int64("db.response.rows_affected", rows))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,79 @@
+package tracing
+
+import (
+	"context"
+	"news/config"
+	"news/logging"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Zakończone spany wysyłane są paczkami co flushInterval; przy pełnej kolejce eksportera nowe spany
+// są odrzucane, aby niedostępny odbiornik nie zwiększał zużycia pamięci ani nie spowalniał żądań.
+const (
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+)
+
+// Tracer tworzy spany OpenTelemetry dla żądań HTTP i zapytań do bazy (zob. Middleware i QueryHook)
+type Tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// Utworzenie tracera z eksporterem wybranym w konfiguracji: "stdout" wypisuje każdy span jako linię JSON,
+// a "otlp" wysyła spany protokołem OTLP/HTTP na adres cfg.Endpoint (zwykle http://collector:4318/v1/traces).
+func NewTracer(cfg config.TracingConfig) (*Tracer, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case config.TracingExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TracingExporterOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.Endpoint),
+			otlptracehttp.WithTimeout(exportTimeout))
+	default:
+		return nil, errors.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create span exporter")
+	}
+	// Błędy eksportu zgłaszane są przez SDK w tle - trafiają do logu serwisu
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logging.Error("failed to export spans", "error", err)
+	}))
+	processor := sdktrace.NewBatchSpanProcessor(exporter, sdktrace.WithBatchTimeout(flushInterval), sdktrace.WithExportTimeout(exportTimeout))
+	return New(cfg.ServiceName, cfg.SamplePercent, processor), nil
+}
+
+// Utworzenie tracera przekazującego zakończone spany do processor. Ślad rozpoczynany przez serwis
+// próbkowany jest z prawdopodobieństwem samplePercent, a spany z rodzicem dziedziczą jego decyzję.
+func New(service string, samplePercent int, processor sdktrace.SpanProcessor) *Tracer {
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(samplePercent)/100))),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	return &Tracer{provider: provider, tracer: provider.Tracer("news"), propagator: propagation.TraceContext{}}
+}
+
+// Oczekiwanie na anulowanie ctx, a następnie wysłanie pozostałych spanów i zamknięcie eksportera
+func (t *Tracer) Run(ctx context.Context) {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(shutdownCtx); err != nil {
+		logging.Error("failed to flush spans", "error", err)
+	}
+}
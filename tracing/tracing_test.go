@@ -0,0 +1,159 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"news/config"
+	"news/database"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Tracer zapisujący zakończone spany w pamięci
+func newTestTracer(samplePercent int) (*Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return New("news", samplePercent, sdktrace.NewSimpleSpanProcessor(exporter)), exporter
+}
+
+// Wartości atrybutów spanu według klucza
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	values := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+// Test continuing the caller's trace and creating a child span for a database query
+func TestMiddlewareAndQueryHook(t *testing.T) {
+	tracer, exporter := newTestTracer(100)
+	router := mux.NewRouter()
+	router.Use(tracer.Middleware)
+	router.HandleFunc("/api/News/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, finish := tracer.QueryHook(r.Context(), database.ParseStatement(`UPDATE "north"."News" SET "Pinned" = true`))
+		finish(1, nil)
+		_, finish = tracer.QueryHook(r.Context(), database.ParseStatement(`SELECT 1 FROM "north"."News_comments"`))
+		finish(-1, errors.New("connection reset"))
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodPut, "/api/News/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	update, query, server := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "PUT /api/News/{id}", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.True(t, server.Parent.IsRemote())
+	assert.Equal(t, "/api/News/{id}", attributes(server)["http.route"].AsString())
+	assert.Equal(t, "/api/News/7", attributes(server)["url.path"].AsString())
+	assert.Equal(t, int64(http.StatusInternalServerError), attributes(server)["http.response.status_code"].AsInt64())
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "500 Internal Server Error"}, server.Status)
+
+	assert.Equal(t, "update News", update.Name)
+	assert.Equal(t, trace.SpanKindClient, update.SpanKind)
+	assert.Equal(t, server.SpanContext.TraceID(), update.SpanContext.TraceID())
+	assert.Equal(t, server.SpanContext.SpanID(), update.Parent.SpanID())
+	assert.Equal(t, "News", attributes(update)["db.collection.name"].AsString())
+	assert.Equal(t, int64(1), attributes(update)["db.response.rows_affected"].AsInt64())
+	assert.Equal(t, codes.Unset, update.Status.Code)
+
+	assert.Equal(t, "select News_comments", query.Name)
+	assert.NotContains(t, attributes(query), attribute.Key("db.response.rows_affected"))
+	assert.Equal(t, sdktrace.Status{Code: codes.Error, Description: "connection reset"}, query.Status)
+}
+
+// Test that unsampled traces and queries outside requests are not exported
+func TestSampling(t *testing.T) {
+	tracer, exporter := newTestTracer(0)
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, finish := tracer.QueryHook(r.Context(), database.ParseStatement(`SELECT 1`))
+		finish(-1, nil)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/News", nil))
+	_, finish := tracer.QueryHook(context.Background(), database.ParseStatement(`SELECT 1`))
+	finish(-1, nil)
+	assert.Empty(t, exporter.GetSpans())
+
+	// Decyzja o próbkowaniu z nagłówka traceparent ma pierwszeństwo przed samplePercent
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, exporter.GetSpans(), 2)
+
+	// Niepoprawny nagłówek rozpoczyna nowy ślad
+	tracer, exporter = newTestTracer(100)
+	req = httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	req.Header.Set("traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	tracer.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	if spans := exporter.GetSpans(); assert.Len(t, spans, 1) {
+		assert.False(t, spans[0].Parent.IsValid())
+	}
+}
+
+// Test exporting spans over OTLP/HTTP and flushing queued spans on shutdown
+func TestOTLPExporter(t *testing.T) {
+	var received coltracepb.ExportTraceServiceRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, proto.Unmarshal(body, &received))
+	}))
+	defer collector.Close()
+
+	tracer, err := NewTracer(config.TracingConfig{Exporter: config.TracingExporterOTLP, Endpoint: collector.URL + "/v1/traces",
+		ServiceName: "news-test", SamplePercent: 100})
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracer.Run(ctx)
+		close(done)
+	}()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/News", nil)
+	tracer.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), req)
+	cancel()
+	<-done
+
+	if !assert.Len(t, received.ResourceSpans, 1) {
+		return
+	}
+	resourceSpans := received.ResourceSpans[0]
+	var service string
+	for _, kv := range resourceSpans.Resource.Attributes {
+		if kv.Key == "service.name" {
+			service = kv.Value.GetStringValue()
+		}
+	}
+	assert.Equal(t, "news-test", service)
+	if assert.Len(t, resourceSpans.ScopeSpans, 1) && assert.Len(t, resourceSpans.ScopeSpans[0].Spans, 1) {
+		assert.Equal(t, "GET unmatched", resourceSpans.ScopeSpans[0].Spans[0].Name)
+	}
+
+	_, err = NewTracer(config.TracingConfig{Exporter: "jaeger"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+package views
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"news/database"
+	"news/logging"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Counter zlicza wyświetlenia newsów w pamięci i co FlushInterval zapisuje je paczką do bazy,
+// osobno dla schematu każdej filii. Ponowne wyświetlenie tego samego newsa przez tego samego
+// klienta w ciągu Window nie jest liczone.
+type Counter struct {
+	DB            *sql.DB
+	TableName     string
+	Window        time.Duration
+	FlushInterval time.Duration
+
+	mu      sync.Mutex
+	seen    map[string]time.Time
+	pending map[string]map[int]int64 // schemat -> Id newsa -> liczba wyświetleń
+	now     func() time.Time
+}
+
+func NewCounter(db *sql.DB, tableName string, window, flushInterval time.Duration) *Counter {
+	if window <= 0 {
+		window = 30 * time.Minute
+	}
+	if flushInterval <= 0 {
+		flushInterval = 10 * time.Second
+	}
+	return &Counter{
+		DB:            db,
+		TableName:     tableName,
+		Window:        window,
+		FlushInterval: flushInterval,
+		seen:          make(map[string]time.Time),
+		pending:       make(map[string]map[int]int64),
+		now:           time.Now,
+	}
+}
+
+// Zarejestrowanie wyświetlenia newsa ze schematu filii przez klienta. Zwraca false, jeśli wyświetlenie
+// zostało pominięte jako powtórzone w oknie deduplikacji.
+func (c *Counter) Record(schemaName string, newsID int, client string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	key := fmt.Sprintf("%s|%d|%s", schemaName, newsID, client)
+	if last, ok := c.seen[key]; ok && now.Sub(last) < c.Window {
+		return false
+	}
+	c.seen[key] = now
+	if c.pending[schemaName] == nil {
+		c.pending[schemaName] = make(map[int]int64)
+	}
+	c.pending[schemaName][newsID]++
+	return true
+}
+
+// Uruchomienie cyklicznego zapisu liczników. Po anulowaniu kontekstu zapisywane są pozostałe wyświetlenia.
+func (c *Counter) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := c.Flush(flushCtx); err != nil {
+				logging.Error("views flush error", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				logging.Error("views flush error", "error", err)
+			}
+		}
+	}
+}
+
+// Zapis zebranych wyświetleń do bazy - jedno zapytanie na schemat filii
+func (c *Counter) Flush(ctx context.Context) error {
+	var flushErr error
+	for schemaName, batch := range c.takePending() {
+		if err := c.flushSchema(ctx, schemaName, batch); err != nil {
+			// Przywrócenie niezapisanych wyświetleń do następnej próby
+			c.restorePending(schemaName, batch)
+			flushErr = err
+		}
+	}
+	return flushErr
+}
+
+func (c *Counter) flushSchema(ctx context.Context, schemaName string, batch map[int]int64) error {
+	ids := make([]int64, 0, len(batch))
+	counts := make([]int64, 0, len(batch))
+	for id, count := range batch {
+		ids = append(ids, int64(id))
+		counts = append(counts, count)
+	}
+
+	// Wyświetlenia newsów usuniętych w międzyczasie z bazy są pomijane
+	query := fmt.Sprintf(`INSERT INTO "%[1]s"."%[2]s" AS v ("NewsId", "Day", "Views")
+		SELECT u."Id", CURRENT_DATE, u."Views" FROM unnest($1::int[], $2::bigint[]) AS u("Id", "Views")
+		JOIN "%[1]s"."%[3]s" n ON n."Id" = u."Id"
+		ON CONFLICT ("NewsId", "Day") DO UPDATE SET "Views" = v."Views" + EXCLUDED."Views"`,
+		schemaName, database.ViewsTableName(c.TableName), c.TableName)
+	_, err := c.DB.ExecContext(ctx, query, pq.Array(ids), pq.Array(counts))
+	if err != nil {
+		return errors.Wrapf(err, "failed to flush views of schema %s", schemaName)
+	}
+	return nil
+}
+
+// Pobranie zebranych wyświetleń oraz usunięcie wygasłych wpisów deduplikacji
+func (c *Counter) takePending() map[string]map[int]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, last := range c.seen {
+		if now.Sub(last) >= c.Window {
+			delete(c.seen, key)
+		}
+	}
+	batch := c.pending
+	c.pending = make(map[string]map[int]int64)
+	return batch
+}
+
+func (c *Counter) restorePending(schemaName string, batch map[int]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[schemaName] == nil {
+		c.pending[schemaName] = make(map[int]int64)
+	}
+	for id, count := range batch {
+		c.pending[schemaName][id] += count
+	}
+}
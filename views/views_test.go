@@ -0,0 +1,54 @@
+package views
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test de-duplication of views from the same client within the window
+func TestCounterRecord(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	counter := NewCounter(nil, "test", 30*time.Minute, time.Second)
+	counter.now = func() time.Time { return now }
+
+	assert.True(t, counter.Record("test", 1, "ip:10.0.0.1"))
+	assert.False(t, counter.Record("test", 1, "ip:10.0.0.1"))
+	assert.True(t, counter.Record("test", 1, "ip:10.0.0.2"))
+	assert.True(t, counter.Record("test", 2, "ip:10.0.0.1"))
+
+	//po upływie okna wyświetlenie jest liczone ponownie
+	now = now.Add(31 * time.Minute)
+	assert.True(t, counter.Record("test", 1, "ip:10.0.0.1"))
+
+	batch := counter.takePending()
+	assert.Equal(t, map[string]map[int]int64{"test": {1: 3, 2: 1}}, batch)
+	assert.Empty(t, counter.takePending())
+}
+
+// Test pruning of expired de-duplication entries and restoring failed batches
+func TestCounterTakePending(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	counter := NewCounter(nil, "test", time.Minute, time.Second)
+	counter.now = func() time.Time { return now }
+
+	counter.Record("test", 1, "user:a")
+	now = now.Add(2 * time.Minute)
+	batch := counter.takePending()
+	assert.Empty(t, counter.seen)
+
+	counter.Record("test", 1, "user:b")
+	counter.restorePending("test", batch["test"])
+	assert.Equal(t, map[string]map[int]int64{"test": {1: 2}}, counter.takePending())
+}
+
+// Test that views of the same news id in different tenant schemas are counted separately
+func TestCounterSchemas(t *testing.T) {
+	counter := NewCounter(nil, "test", time.Minute, time.Second)
+
+	assert.True(t, counter.Record("central", 1, "user:a"))
+	assert.True(t, counter.Record("north", 1, "user:a"))
+	assert.False(t, counter.Record("north", 1, "user:a"))
+	assert.Equal(t, map[string]map[int]int64{"central": {1: 1}, "north": {1: 1}}, counter.takePending())
+}